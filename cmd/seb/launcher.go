@@ -0,0 +1,109 @@
+// Copyright 2026 Schibsted
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/schibsted/sebuild/v2/pkg/buildbuild"
+)
+
+// Cache hits and misses of a compiler launcher such as ccache.
+type launcherStats struct {
+	hits, misses int
+}
+
+func (s launcherStats) sub(o launcherStats) launcherStats {
+	return launcherStats{s.hits - o.hits, s.misses - o.misses}
+}
+
+// Returns the compiler launcher to print statistics for, if any.
+func statsLauncher(ops *buildbuild.GlobalOps) string {
+	if ops.Options.Quiet {
+		return ""
+	}
+	return ops.Config.CompilerLauncher
+}
+
+// Reads the current statistics of the launcher. Returns false for unknown
+// launchers or if the statistics can't be read.
+func readLauncherStats(launcher string) (launcherStats, bool) {
+	argv := strings.Fields(launcher)
+	switch filepath.Base(argv[0]) {
+	case "ccache":
+		out, err := exec.Command(argv[0], "--print-stats").Output()
+		if err != nil {
+			return launcherStats{}, false
+		}
+		return parseCcacheStats(out), true
+	case "sccache":
+		out, err := exec.Command(argv[0], "--show-stats", "--stats-format=json").Output()
+		if err != nil {
+			return launcherStats{}, false
+		}
+		return parseSccacheStats(out)
+	}
+	return launcherStats{}, false
+}
+
+// Parses the tab separated output of ccache --print-stats.
+func parseCcacheStats(out []byte) launcherStats {
+	var stats launcherStats
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "\t", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v, err := strconv.Atoi(kv[1])
+		if err != nil {
+			continue
+		}
+		switch kv[0] {
+		case "direct_cache_hit", "preprocessed_cache_hit":
+			stats.hits += v
+		case "cache_miss":
+			stats.misses += v
+		}
+	}
+	return stats
+}
+
+func parseSccacheStats(out []byte) (launcherStats, bool) {
+	var data struct {
+		Stats struct {
+			CacheHits struct {
+				Counts map[string]int `json:"counts"`
+			} `json:"cache_hits"`
+			CacheMisses struct {
+				Counts map[string]int `json:"counts"`
+			} `json:"cache_misses"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return launcherStats{}, false
+	}
+	var stats launcherStats
+	for _, v := range data.Stats.CacheHits.Counts {
+		stats.hits += v
+	}
+	for _, v := range data.Stats.CacheMisses.Counts {
+		stats.misses += v
+	}
+	return stats, true
+}
+
+func printLauncherStats(launcher string, stats launcherStats) {
+	total := stats.hits + stats.misses
+	if total <= 0 {
+		return
+	}
+	fmt.Printf("%s: %d hits, %d misses, %.1f%% hit rate\n", filepath.Base(strings.Fields(launcher)[0]), stats.hits, stats.misses, 100*float64(stats.hits)/float64(total))
+}
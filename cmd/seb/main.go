@@ -17,16 +17,27 @@ import (
 	"strings"
 
 	cmdasset "github.com/schibsted/sebuild/v2/internal/cmd/asset"
+	"github.com/schibsted/sebuild/v2/internal/cmd/cache"
 	copy_analyse "github.com/schibsted/sebuild/v2/internal/cmd/copy-analyse"
+	"github.com/schibsted/sebuild/v2/internal/cmd/exports"
+	gcov_report "github.com/schibsted/sebuild/v2/internal/cmd/gcov-report"
 	go_install "github.com/schibsted/sebuild/v2/internal/cmd/go-install"
 	"github.com/schibsted/sebuild/v2/internal/cmd/gobuild"
+	gocover_merge "github.com/schibsted/sebuild/v2/internal/cmd/gocover-merge"
 	gperf_enum "github.com/schibsted/sebuild/v2/internal/cmd/gperf-enum"
 	header_install "github.com/schibsted/sebuild/v2/internal/cmd/header-install"
 	"github.com/schibsted/sebuild/v2/internal/cmd/in"
 	"github.com/schibsted/sebuild/v2/internal/cmd/invars"
 	"github.com/schibsted/sebuild/v2/internal/cmd/link"
+	pgo_merge "github.com/schibsted/sebuild/v2/internal/cmd/pgo-merge"
 	python_install "github.com/schibsted/sebuild/v2/internal/cmd/python-install"
+	repro_check "github.com/schibsted/sebuild/v2/internal/cmd/repro-check"
 	"github.com/schibsted/sebuild/v2/internal/cmd/ronn"
+	"github.com/schibsted/sebuild/v2/internal/cmd/sandbox"
+	size_report "github.com/schibsted/sebuild/v2/internal/cmd/size-report"
+	split_debug "github.com/schibsted/sebuild/v2/internal/cmd/split-debug"
+	test_report "github.com/schibsted/sebuild/v2/internal/cmd/test-report"
+	test_runner "github.com/schibsted/sebuild/v2/internal/cmd/test-runner"
 	"github.com/schibsted/sebuild/v2/internal/cmd/touch"
 	"github.com/schibsted/sebuild/v2/pkg/buildbuild"
 )
@@ -77,6 +88,8 @@ func main() {
 	flag.Var(SetFlag(ops.Options.WithFlavors), "with-flavor", "Only generate this flavor. Can be used multiple times. Usually not needed as each flavor is also a ninja pseudo-target.")
 	flag.Var(SetFlag(ops.Options.WithoutFlavors), "without-flavor", "Don't generate this flavor. Can be used multiple times.")
 	flag.Var(SetFlag(ops.Config.Conditions), "condition", "Add build condition. Can be used multiple times.")
+	flag.BoolVar(&ops.Options.Sandbox, "sandbox", false, "Run rules in a sandbox in all flavors, to find undeclared inputs. Linux only.")
+	flag.StringVar(&ops.Options.Buildpath, "buildpath", "", "Build in this directory, overriding buildpath in CONFIG and the BUILDPATH environment variable.")
 	flag.BoolVar(&noexec, "noexec", false, "Don't execute ninja")
 	flag.StringVar(&topdir, "topdir", "", "Set top directory manually instead of scanning for Builddesc.top")
 	flag.Var((*ArrayFlag)(&ops.Config.Configvars), "configvars", "Add a configvars file. These are read before configvars files in CONFIG. Can be used multiple times.")
@@ -138,7 +151,7 @@ func main() {
 			if err != nil {
 				return nil
 			}
-			return RunNinja(ninja, ops.Config.Buildpath)
+			return RunNinja(ninja, ops.Config.Buildpath, statsLauncher(ops))
 		}
 	}
 
@@ -171,7 +184,7 @@ func main() {
 		return
 	}
 
-	log.Fatal(RunNinja("", ops.Config.Buildpath))
+	log.Fatal(RunNinja("", ops.Config.Buildpath, statsLauncher(ops)))
 }
 
 func mainTool() {
@@ -200,6 +213,28 @@ func mainTool() {
 		invars.Main(os.Args[3:]...)
 	case "asset":
 		cmdasset.Main(os.Args[3:]...)
+	case "cache":
+		cache.Main(os.Args[3:]...)
+	case "sandbox":
+		sandbox.Main(os.Args[3:]...)
+	case "repro-check":
+		repro_check.Main(os.Args[3:]...)
+	case "split-debug":
+		split_debug.Main(os.Args[3:]...)
+	case "exports":
+		exports.Main(os.Args[3:]...)
+	case "size-report":
+		size_report.Main(os.Args[3:]...)
+	case "test-runner":
+		test_runner.Main(os.Args[3:]...)
+	case "test-report":
+		test_report.Main(os.Args[3:]...)
+	case "gocover-merge":
+		gocover_merge.Main(os.Args[3:]...)
+	case "gcov-report":
+		gcov_report.Main(os.Args[3:]...)
+	case "pgo-merge":
+		pgo_merge.Main(os.Args[3:]...)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown tool %q.\n", os.Args[2])
 		os.Exit(1)
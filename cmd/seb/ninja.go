@@ -15,7 +15,10 @@ func FindNinja() (string, error) {
 	return exec.LookPath("ninja")
 }
 
-func RunNinja(ninja, bp string) error {
+// Runs ninja in the build path. If launcher is set, ninja is run as a child
+// process instead of replacing this one, to print the compiler launcher
+// statistics when it's done.
+func RunNinja(ninja, bp, launcher string) error {
 	if ninja == "" {
 		var err error
 		ninja, err = FindNinja()
@@ -27,5 +30,26 @@ func RunNinja(ninja, bp string) error {
 	ioutil.WriteFile(stamp, nil, 0666)
 	bnpath := filepath.Join(bp, "build.ninja")
 	argv := append([]string{"ninja", "-f", bnpath}, flag.Args()...)
-	return syscall.Exec(ninja, argv, os.Environ())
+	if launcher == "" {
+		return syscall.Exec(ninja, argv, os.Environ())
+	}
+
+	before, ok := readLauncherStats(launcher)
+	cmd := exec.Command(ninja, argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if ok {
+		if after, ok := readLauncherStats(launcher); ok {
+			printLauncherStats(launcher, after.sub(before))
+		}
+	}
+	if exit, isexit := err.(*exec.ExitError); isexit {
+		os.Exit(exit.ExitCode())
+	}
+	if err == nil {
+		os.Exit(0)
+	}
+	return err
 }
@@ -39,9 +39,13 @@ func Main(args ...string) {
 		"compiler/clang.ninja": assets.CompilerClangNinja,
 		"compiler/gcc.ninja":   assets.CompilerGccNinja,
 		"defaults.ninja":       assets.DefaultsNinja,
+		"flavor/asan.ninja":    assets.FlavorAsanNinja,
 		"flavor/dev.ninja":     assets.FlavorDevNinja,
 		"flavor/gcov.ninja":    assets.FlavorGcovNinja,
+		"flavor/msan.ninja":    assets.FlavorMsanNinja,
 		"flavor/release.ninja": assets.FlavorReleaseNinja,
+		"flavor/tsan.ninja":    assets.FlavorTsanNinja,
+		"flavor/ubsan.ninja":   assets.FlavorUbsanNinja,
 		"rules.ninja":          assets.RulesNinja,
 		"static.ninja":         assets.StaticNinja,
 	}
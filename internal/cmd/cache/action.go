@@ -0,0 +1,305 @@
+// Copyright 2026 Schibsted
+
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/depfile"
+)
+
+type action struct {
+	argv    []string
+	env     []string
+	inputs  []string
+	outputs []string
+	depfile string
+	side    []string // Extra output suffixes, e.g. the header written by bison.
+	version []string // Command printing the version of tools not found in argv, e.g. go version.
+}
+
+// List of depfile input lists seen for a manifest key, most recent first.
+type manifest [][]string
+
+// Returns the manifest key. Tool hashes are kept in memodir, see toolHash.
+func (act *action) manifestKey(memodir string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "seb-cache-v1\x00")
+	for _, a := range act.env {
+		fmt.Fprintf(h, "env %s\x00", a)
+	}
+	for _, a := range act.argv {
+		fmt.Fprintf(h, "arg %s\x00", a)
+	}
+	// Changing a tool, e.g. upgrading the compiler, must change the key.
+	// Wrappers like seb -tool link run other tools, so check all arguments
+	// looking like program names rather than files or flags. The contents
+	// are used so that the same tools on other machines give the same key.
+	for i, a := range act.argv {
+		if i > 0 && (a == "" || strings.ContainsAny(a[:1], "-@$") || strings.ContainsAny(a, "/=.")) {
+			continue
+		}
+		if bin, err := exec.LookPath(a); err == nil {
+			sum, err := toolHash(memodir, bin)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "tool %s\x00", sum)
+		}
+	}
+	// The go binary is run by gobuild and its GOROOT isn't in the depfile,
+	// so upgrading Go is only noticed through the version output.
+	if len(act.version) > 0 {
+		out, err := exec.Command(act.version[0], act.version[1:]...).Output()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "version %s\x00", out)
+	}
+	for _, o := range act.outputs {
+		fmt.Fprintf(h, "out %s\x00", o)
+	}
+	fmt.Fprintf(h, "depfile %s\x00", act.depfile)
+	if err := hashFiles(h, "in", act.inputs); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns the hash of the contents of the tool binary. Hashing a compiler
+// for every command would be slow, so the hash is kept in memodir keyed on
+// the path, size and modification time of the binary.
+func toolHash(memodir, bin string) (string, error) {
+	fi, err := os.Stat(bin)
+	if err != nil {
+		return "", err
+	}
+	memo := &store{dir: memodir}
+	mkey := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s %d %d", bin, fi.Size(), fi.ModTime().UnixNano()))))
+	if memodir != "" {
+		if data, err := ioutil.ReadFile(memo.localPath("tool", mkey)); err == nil && len(data) == sha256.Size*2 {
+			return string(data), nil
+		}
+	}
+	f, err := os.Open(bin)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if memodir != "" {
+		// Only an optimization, ignore errors.
+		memo.putLocal("tool", mkey, []byte(sum))
+	}
+	return sum, nil
+}
+
+func entryKey(mkey string, deps []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", mkey)
+	if err := hashFiles(h, "dep", deps); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Hashes the names and contents of the files. Directories are hashed
+// recursively.
+func hashFiles(h io.Writer, kind string, files []string) error {
+	for _, f := range files {
+		err := filepath.Walk(f, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			fh, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			fmt.Fprintf(h, "%s %s %d\x00", kind, path, info.Size())
+			_, err = io.Copy(h, fh)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Looks up the manifest and tries each depfile input list in it. Returns
+// true if an entry was found and the outputs restored.
+func (act *action) restore(st *store, mkey string) bool {
+	var m manifest
+	data, err := st.get("manifest", mkey)
+	if err != nil || json.Unmarshal(data, &m) != nil {
+		return false
+	}
+	for _, deps := range m {
+		ekey, err := entryKey(mkey, deps)
+		if err != nil {
+			continue
+		}
+		data, err := st.get("entry", ekey)
+		if err != nil {
+			continue
+		}
+		if err := extract(data, act.files()); err != nil {
+			fmt.Fprintf(os.Stderr, "Corrupt cache entry %s: %s\n", ekey, err)
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Stores the outputs of a successful run.
+func (act *action) save(st *store, mkey string) error {
+	var deps []string
+	if act.depfile != "" {
+		data, err := ioutil.ReadFile(act.depfile)
+		if err != nil || len(data) == 0 {
+			// Without the depfile we don't know all the inputs.
+			return err
+		}
+		deps = depfile.Parse(data)
+	}
+	ekey, err := entryKey(mkey, deps)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, f := range act.files() {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	data, err := archive(files)
+	if err != nil {
+		return err
+	}
+	if err := st.put("entry", ekey, data); err != nil {
+		return err
+	}
+
+	// Add the depfile inputs to the front of the manifest.
+	m := manifest{deps}
+	if old, err := st.get("manifest", mkey); err == nil {
+		var prev manifest
+		if json.Unmarshal(old, &prev) == nil {
+			for _, p := range prev {
+				if len(m) < maxManifestEntries && strings.Join(p, " ") != strings.Join(deps, " ") {
+					m = append(m, p)
+				}
+			}
+		}
+	}
+	mdata, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return st.put("manifest", mkey, mdata)
+}
+
+// All files that might be stored in an entry, the outputs, side outputs and
+// depfile.
+func (act *action) files() []string {
+	files := append([]string(nil), act.outputs...)
+	for _, o := range act.outputs {
+		for _, suff := range act.side {
+			files = append(files, strings.TrimSuffix(o, filepath.Ext(o))+suff)
+		}
+	}
+	if act.depfile != "" {
+		files = append(files, act.depfile)
+	}
+	return files
+}
+
+func archive(files []string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		hdr := &tar.Header{
+			Name: f,
+			Mode: int64(fi.Mode().Perm()),
+			Size: int64(len(data)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Writes the archived files. They get the current time as modification
+// time, making them newer than the inputs as ninja expects. Only the
+// allowed files are written, in case the cache has been tampered with.
+func extract(data []byte, allowed []string) error {
+	ok := make(map[string]bool)
+	for _, f := range allowed {
+		ok[f] = true
+	}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !ok[hdr.Name] {
+			return fmt.Errorf("unexpected file %s", hdr.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(hdr.Name), 0777); err != nil {
+			return err
+		}
+		tmp := hdr.Name + ".cache-tmp"
+		f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp, hdr.Name)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+}
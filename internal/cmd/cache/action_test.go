@@ -0,0 +1,190 @@
+// Copyright 2026 Schibsted
+
+package cache
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Changes to a new temporary directory, returning a function going back and
+// removing it.
+func chdirTemp(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	defer chdirTemp(t)()
+	writeFiles(t, map[string]string{
+		"src/a.c":     "#include \"a.h\"\n",
+		"src/a.h":     "int a;\n",
+		"obj/a.o":     "object",
+		"obj/a.gcno":  "notes",
+		"obj/a.o.d":   "obj/a.o: src/a.c src/a.h\n",
+		"cache/.keep": "",
+	})
+	act := &action{
+		argv:    []string{"cc", "-c", "src/a.c", "-o", "obj/a.o"},
+		inputs:  []string{"src/a.c"},
+		outputs: []string{"obj/a.o"},
+		depfile: "obj/a.o.d",
+		side:    []string{".gcno"},
+	}
+	st := &store{dir: "cache"}
+	mkey, err := act.manifestKey("cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := act.save(st, mkey); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []string{"obj/a.o", "obj/a.gcno", "obj/a.o.d"} {
+		os.Remove(f)
+	}
+	if !act.restore(st, mkey) {
+		t.Fatal("Expected a cache hit")
+	}
+	for f, expt := range map[string]string{"obj/a.o": "object", "obj/a.gcno": "notes", "obj/a.o.d": "obj/a.o: src/a.c src/a.h\n"} {
+		if data, err := ioutil.ReadFile(f); err != nil || string(data) != expt {
+			t.Errorf("Bad restored %s: %q, %v", f, data, err)
+		}
+	}
+
+	// A changed header from the depfile gives another entry.
+	writeFiles(t, map[string]string{"src/a.h": "long a;\n"})
+	if act.restore(st, mkey) {
+		t.Error("Expected a cache miss after changing a depfile input")
+	}
+	// While a changed declared input gives another manifest.
+	writeFiles(t, map[string]string{"src/a.h": "int a;\n", "src/a.c": "\n"})
+	if mkey2, err := act.manifestKey("cache"); err != nil || mkey2 == mkey {
+		t.Errorf("Expected another manifest key, got %v", err)
+	}
+}
+
+func TestSaveWithoutDepfile(t *testing.T) {
+	defer chdirTemp(t)()
+	writeFiles(t, map[string]string{"in": "x", "out": "y"})
+	act := &action{argv: []string{"cp", "in", "out"}, inputs: []string{"in"}, outputs: []string{"out"}, depfile: "out.d"}
+	st := &store{dir: "cache"}
+	if err := act.save(st, "00key"); err == nil {
+		t.Error("Expected an error without the depfile")
+	}
+	if act.restore(st, "00key") {
+		t.Error("Expected nothing stored without the depfile")
+	}
+}
+
+func TestToolHash(t *testing.T) {
+	defer chdirTemp(t)()
+	writeFiles(t, map[string]string{"a/cc": "compiler", "b/cc": "compiler", "c/cc": "other"})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes("b/cc", old, old)
+
+	ha, err := toolHash("memo", "a/cc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb, err := toolHash("", "b/cc"); err != nil || hb != ha {
+		t.Errorf("Expected the same hash for the same contents, got %q and %q", ha, hb)
+	}
+	if hc, err := toolHash("memo", "c/cc"); err != nil || hc == ha {
+		t.Errorf("Expected another hash for other contents")
+	}
+
+	// The memoized hash is used as long as the binary looks the same.
+	files, _ := filepath.Glob("memo/tool/*/*")
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 memoized hashes, got %v", files)
+	}
+	for _, f := range files {
+		ioutil.WriteFile(f, bytes.Repeat([]byte("0"), 64), 0666)
+	}
+	if h, _ := toolHash("memo", "a/cc"); h != string(bytes.Repeat([]byte("0"), 64)) {
+		t.Errorf("Memoized hash not used, got %q", h)
+	}
+	writeFiles(t, map[string]string{"a/cc": "new compiler"})
+	if h, _ := toolHash("memo", "a/cc"); h == ha || h == string(bytes.Repeat([]byte("0"), 64)) {
+		t.Errorf("Expected a new hash after changing the binary, got %q", h)
+	}
+}
+
+func tarData(t *testing.T, files ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f, Mode: 0644, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte("x"))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	defer chdirTemp(t)()
+	writeFiles(t, map[string]string{"obj/a.o": "object", "obj/a.o.d": "deps"})
+	data, err := archive([]string{"obj/a.o", "obj/a.o.d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll("obj")
+	if err := extract(data, []string{"obj/a.o", "obj/a.o.d"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile("obj/a.o"); err != nil || string(data) != "object" {
+		t.Errorf("Bad extracted file %q, %v", data, err)
+	}
+	if tmps, _ := filepath.Glob("obj/*.cache-tmp"); len(tmps) > 0 {
+		t.Errorf("Temporary files left %v", tmps)
+	}
+
+	for _, name := range []string{"../escape", "/tmp/escape", "obj/../../escape", "obj/other.o"} {
+		err := extract(tarData(t, "obj/a.o", name), []string{"obj/a.o", "obj/a.o.d"})
+		if err == nil || err.Error() != "unexpected file "+name {
+			t.Errorf("Expected %s to be rejected, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat("../escape"); err == nil {
+		t.Error("File written outside the directory")
+	}
+	if _, err := os.Stat("obj/other.o"); err == nil {
+		t.Error("Unexpected file written")
+	}
+
+	if err := extract([]byte("not a tar file, but long enough to not be a short read of one"), nil); err == nil {
+		t.Error("Expected an error for a corrupt entry")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2026 Schibsted
+
+// Package cache wraps a build command, restoring its outputs from a content
+// addressed cache instead of running it when possible.
+//
+// Ninja rules opt in by prefixing their command with $action_cache and
+// setting the environment variables SEB_CACHE_IN, SEB_CACHE_OUT and
+// optionally SEB_CACHE_DEPFILE, SEB_CACHE_SIDE and SEB_CACHE_VERSION. When
+// the cache is disabled $action_cache is empty and the variables are simply
+// ignored.
+// Setting SEB_CACHE_DISABLE in the environment disables it at run time.
+//
+// Since the inputs found in the depfile aren't known until the command has
+// run, the lookup is done in two steps, similar to the ccache direct mode.
+// The command line and declared inputs are hashed into a manifest key. The
+// manifest lists the depfile inputs of previous runs, and for each such list
+// the contents of those files are hashed together with the manifest key into
+// an entry key. The entry holds the outputs and the depfile.
+package cache
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/command"
+)
+
+var (
+	flagset = flag.NewFlagSet("cache", flag.ExitOnError)
+	dir     = flagset.String("dir", "", "Local cache directory.")
+	url     = flagset.String("url", "", "Base URL of an HTTP cache supporting GET and PUT.")
+	verbose = flagset.Bool("v", false, "Print cache hits and misses.")
+)
+
+// Limit the number of depfile input lists kept per manifest.
+const maxManifestEntries = 16
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool cache [-dir dir] [-url url] [--] [VAR=value...] command [args...]\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() < 1 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	env, argv := command.SplitEnv(flagset.Args())
+	if len(argv) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	act := &action{
+		argv:    argv,
+		env:     env,
+		inputs:  expandRsp(strings.Fields(os.Getenv("SEB_CACHE_IN"))),
+		outputs: strings.Fields(os.Getenv("SEB_CACHE_OUT")),
+		depfile: os.Getenv("SEB_CACHE_DEPFILE"),
+		side:    strings.Fields(os.Getenv("SEB_CACHE_SIDE")),
+		version: strings.Fields(os.Getenv("SEB_CACHE_VERSION")),
+	}
+	st := &store{dir: *dir, url: strings.TrimSuffix(*url, "/")}
+	if os.Getenv("SEB_CACHE_DISABLE") != "" {
+		// Used by seb -tool repro-check to really build everything.
+		st = &store{}
+	}
+
+	// Any errors computing the keys just disable caching for this run.
+	mkey, err := act.manifestKey(toolMemoDir(st))
+	enabled := err == nil && len(act.outputs) > 0 && (st.dir != "" || st.url != "")
+	if enabled {
+		if act.restore(st, mkey) {
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "cache hit: %s\n", strings.Join(act.outputs, " "))
+			}
+			return
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "cache miss: %s\n", strings.Join(act.outputs, " "))
+		}
+	}
+
+	code := command.Run(act.env, act.argv)
+	if code == 0 && enabled {
+		if err := act.save(st, mkey); err != nil && *verbose {
+			fmt.Fprintf(os.Stderr, "cache store failed: %s\n", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// Returns the directory keeping the tool hashes, the local cache directory
+// or else the user cache directory.
+func toolMemoDir(st *store) string {
+	if st.dir != "" {
+		return st.dir
+	}
+	if d, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(d, "seb")
+	}
+	return ""
+}
+
+// Inputs starting with @ are response files listing the actual inputs,
+// used by the link rules since the input list can be very long.
+func expandRsp(inputs []string) []string {
+	var ret []string
+	for _, in := range inputs {
+		if !strings.HasPrefix(in, "@") {
+			ret = append(ret, in)
+			continue
+		}
+		data, err := ioutil.ReadFile(in[1:])
+		if err != nil {
+			// Hashing will fail on the missing file and disable the cache.
+			ret = append(ret, in[1:])
+			continue
+		}
+		ret = append(ret, strings.Fields(string(data))...)
+	}
+	return ret
+}
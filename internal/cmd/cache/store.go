@@ -0,0 +1,107 @@
+// Copyright 2026 Schibsted
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errNotFound = errors.New("not found")
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// A local cache directory and/or an HTTP cache. Objects are stored as
+// <kind>/<key>, where kind is manifest or entry, or tool for the hashes kept
+// by toolHash. The local directory adds a level using the first two
+// characters of the key.
+type store struct {
+	dir string
+	url string
+}
+
+func (st *store) localPath(kind, key string) string {
+	return filepath.Join(st.dir, kind, key[:2], key)
+}
+
+func (st *store) get(kind, key string) ([]byte, error) {
+	if st.dir != "" {
+		data, err := ioutil.ReadFile(st.localPath(kind, key))
+		if err == nil {
+			return data, nil
+		}
+	}
+	if st.url == "" {
+		return nil, errNotFound
+	}
+	resp, err := client.Get(st.url + "/" + kind + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errNotFound
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if st.dir != "" && kind == "entry" {
+		// Keep a local copy, errors are fine since it's only an optimization.
+		st.putLocal(kind, key, data)
+	}
+	return data, nil
+}
+
+func (st *store) put(kind, key string, data []byte) error {
+	if st.dir != "" {
+		if err := st.putLocal(kind, key, data); err != nil {
+			return err
+		}
+	}
+	if st.url == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPut, st.url+"/"+kind+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s/%s: %s", kind, key, resp.Status)
+	}
+	return nil
+}
+
+// Writes atomically, several builds might share the directory.
+func (st *store) putLocal(kind, key string, data []byte) error {
+	p := st.localPath(kind, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
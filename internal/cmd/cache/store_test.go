@@ -0,0 +1,133 @@
+// Copyright 2026 Schibsted
+
+package cache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A minimal HTTP cache server keeping the objects in memory.
+type memServer struct {
+	sync.Mutex
+	objects  map[string][]byte
+	readonly bool
+}
+
+func (ms *memServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ms.Lock()
+	defer ms.Unlock()
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := ms.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case http.MethodPut:
+		if ms.readonly {
+			http.Error(w, "read only", http.StatusForbidden)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ms.objects[r.URL.Path] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "bad method", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestStoreHTTP(t *testing.T) {
+	ms := &memServer{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(ms)
+	defer srv.Close()
+
+	st := &store{url: srv.URL}
+	if _, err := st.get("entry", "abcd"); err != errNotFound {
+		t.Errorf("Expected errNotFound, got %v", err)
+	}
+	if err := st.put("entry", "abcd", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if string(ms.objects["/entry/abcd"]) != "data" {
+		t.Errorf("Bad stored objects %v", ms.objects)
+	}
+	if data, err := st.get("entry", "abcd"); err != nil || string(data) != "data" {
+		t.Errorf("Bad get %q, %v", data, err)
+	}
+
+	ms.readonly = true
+	if err := st.put("manifest", "abcd", []byte("m")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected a PUT error, got %v", err)
+	}
+}
+
+func TestStoreHTTPLocalCopy(t *testing.T) {
+	ms := &memServer{objects: map[string][]byte{
+		"/entry/abcd":    []byte("entry"),
+		"/manifest/abcd": []byte("manifest"),
+	}}
+	srv := httptest.NewServer(ms)
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st := &store{dir: dir, url: srv.URL}
+	for _, kind := range []string{"entry", "manifest"} {
+		if data, err := st.get(kind, "abcd"); err != nil || string(data) != kind {
+			t.Errorf("Bad get of %s %q, %v", kind, data, err)
+		}
+	}
+	// Entries are kept locally, manifests change and are always fetched.
+	if data, err := ioutil.ReadFile(st.localPath("entry", "abcd")); err != nil || string(data) != "entry" {
+		t.Errorf("Entry not copied locally, %v", err)
+	}
+	if _, err := os.Stat(st.localPath("manifest", "abcd")); err == nil {
+		t.Error("Manifest copied locally")
+	}
+
+	// The local copy is used without the server.
+	srv.Close()
+	if data, err := st.get("entry", "abcd"); err != nil || string(data) != "entry" {
+		t.Errorf("Bad local get %q, %v", data, err)
+	}
+}
+
+// A full round trip through the HTTP cache, as on another machine.
+func TestSaveRestoreHTTP(t *testing.T) {
+	ms := &memServer{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(ms)
+	defer srv.Close()
+	defer chdirTemp(t)()
+	writeFiles(t, map[string]string{"in": "x", "out": "y", "out.d": "out: in hdr\n", "hdr": "h"})
+
+	act := &action{argv: []string{"sh", "-c", "cp in out"}, inputs: []string{"in"}, outputs: []string{"out"}, depfile: "out.d"}
+	st := &store{url: srv.URL}
+	mkey, err := act.manifestKey("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := act.save(st, mkey); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove("out")
+	if !act.restore(st, mkey) {
+		t.Fatal("Expected a cache hit")
+	}
+	if data, err := ioutil.ReadFile("out"); err != nil || string(data) != "y" {
+		t.Errorf("Bad restored output %q, %v", data, err)
+	}
+}
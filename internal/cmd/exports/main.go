@@ -0,0 +1,189 @@
+// Copyright 2026 Schibsted
+
+// Package exports handles the symbol lists given to the exports argument of
+// MODULE.
+//
+// The lists have one symbol per line, with # starting a comment. The exports
+// list, which may use version script patterns, is turned into a linker
+// version script hiding every other symbol. The separate baseline lists the
+// exact names the dynamic symbol table of the linked module is checked
+// against, so that symbols aren't removed or added by accident.
+package exports
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	flagset       = flag.NewFlagSet("exports", flag.ExitOnError)
+	versionScript = flagset.Bool("version-script", false, "Write a linker version script exporting the symbols in the list.")
+	checkExports  = flagset.Bool("check", false, "Check the symbols exported by the module against the baseline, writing the stamp if they match.")
+)
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), `Usage: %[1]s -tool exports -version-script <list> <out>
+       %[1]s -tool exports -check <module> <baseline> <stamp>
+       %[1]s -tool exports <module>
+
+The last form prints the symbols exported by the module, in the baseline
+format.
+`, os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+
+	var err error
+	switch {
+	case *versionScript && flagset.NArg() == 2:
+		err = writeVersionScript(flagset.Arg(0), flagset.Arg(1))
+	case *checkExports && flagset.NArg() == 3:
+		var ok bool
+		ok, err = check(os.Stderr, flagset.Arg(0), flagset.Arg(1))
+		if err == nil && !ok {
+			os.Exit(1)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(flagset.Arg(2), nil, 0666)
+		}
+	case !*versionScript && !*checkExports && flagset.NArg() == 1:
+		var syms []string
+		syms, err = dynamicSymbols(flagset.Arg(0))
+		for _, s := range syms {
+			fmt.Println(s)
+		}
+	default:
+		flagset.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exports: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func readList(list string) ([]string, error) {
+	f, err := os.Open(list)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var syms []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			syms = append(syms, line)
+		}
+	}
+	return syms, scanner.Err()
+}
+
+func writeVersionScript(list, out string) error {
+	syms, err := readList(list)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	if len(syms) > 0 {
+		buf.WriteString("\tglobal:\n")
+		for _, s := range syms {
+			fmt.Fprintf(&buf, "\t\t%s;\n", s)
+		}
+	}
+	buf.WriteString("\tlocal:\n\t\t*;\n};\n")
+	return ioutil.WriteFile(out, buf.Bytes(), 0666)
+}
+
+// Returns the sorted names of the symbols defined and exported by the ELF
+// file.
+func dynamicSymbols(file string) ([]string, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dsyms, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var syms []string
+	for _, s := range dsyms {
+		if s.Name == "" || seen[s.Name] {
+			continue
+		}
+		// Version definitions are absolute symbols.
+		if s.Section == elf.SHN_UNDEF || s.Section == elf.SHN_ABS {
+			continue
+		}
+		if b := elf.ST_BIND(s.Info); b != elf.STB_GLOBAL && b != elf.STB_WEAK {
+			continue
+		}
+		if v := elf.ST_VISIBILITY(s.Other); v != elf.STV_DEFAULT && v != elf.STV_PROTECTED {
+			continue
+		}
+		seen[s.Name] = true
+		syms = append(syms, s.Name)
+	}
+	sort.Strings(syms)
+	return syms, nil
+}
+
+// Compares the symbols exported by the module with the baseline, printing
+// the differences to w.
+func check(w io.Writer, module, list string) (bool, error) {
+	want, err := readList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range want {
+		if strings.ContainsAny(s, "*?[") {
+			return false, fmt.Errorf("%s: the baseline must list symbol names, not patterns like %s", list, s)
+		}
+	}
+	have, err := dynamicSymbols(module)
+	if err != nil {
+		return false, err
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, s := range want {
+		wantSet[s] = true
+	}
+	haveSet := make(map[string]bool, len(have))
+	for _, s := range have {
+		haveSet[s] = true
+	}
+
+	ok := true
+	sort.Strings(want)
+	for _, s := range want {
+		if !haveSet[s] {
+			fmt.Fprintf(w, "%s: removed symbol %s listed in %s\n", module, s, list)
+			ok = false
+		}
+	}
+	for _, s := range have {
+		if !wantSet[s] {
+			fmt.Fprintf(w, "%s: added symbol %s not listed in %s\n", module, s, list)
+			ok = false
+		}
+	}
+	if !ok {
+		fmt.Fprintf(w, "If the change is intended, update %s, e.g. with seb -tool exports %s\n", list, module)
+	}
+	return ok, nil
+}
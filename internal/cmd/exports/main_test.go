@@ -0,0 +1,137 @@
+// Copyright 2026 Schibsted
+
+package exports
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteVersionScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	list := filepath.Join(dir, "exports.txt")
+	out := filepath.Join(dir, "exports.map")
+
+	ioutil.WriteFile(list, []byte("# Public API.\nfoo_init\n  foo_*  # Patterns work too.\n\nbar\n"), 0666)
+	if err := writeVersionScript(list, out); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(out)
+	if expt := "{\n\tglobal:\n\t\tfoo_init;\n\t\tfoo_*;\n\t\tbar;\n\tlocal:\n\t\t*;\n};\n"; string(data) != expt {
+		t.Errorf("Bad version script:\n%s", data)
+	}
+
+	// An empty list hides everything.
+	ioutil.WriteFile(list, []byte("# Nothing.\n"), 0666)
+	if err := writeVersionScript(list, out); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(out)
+	if expt := "{\n\tlocal:\n\t\t*;\n};\n"; string(data) != expt {
+		t.Errorf("Bad empty version script:\n%s", data)
+	}
+}
+
+// Builds a shared object from the source with the version script generated
+// from the exports list.
+func buildModule(t *testing.T, dir, src, exports string) string {
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("cc not found")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "mod.c"), []byte(src), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "exports.txt"), []byte(exports), 0666)
+	if err := writeVersionScript(filepath.Join(dir, "exports.txt"), filepath.Join(dir, "exports.map")); err != nil {
+		t.Fatal(err)
+	}
+	mod := filepath.Join(dir, "mod.so")
+	cmd := exec.Command("cc", "-shared", "-fPIC", "-Wl,--version-script="+filepath.Join(dir, "exports.map"), "-o", mod, filepath.Join(dir, "mod.c"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cc failed: %v\n%s", err, out)
+	}
+	return mod
+}
+
+const moduleSrc = `
+#include <stdio.h>
+int foo_init(void) { return puts("init"); }
+int foo_run(void) { return 1; }
+__attribute__((weak)) int foo_weak(void) { return 2; }
+__attribute__((visibility("hidden"))) int foo_hidden(void) { return 3; }
+int internal(void) { return 4; }
+int foo_data = 5;
+`
+
+func TestDynamicSymbols(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mod := buildModule(t, dir, moduleSrc, "foo_*\n")
+
+	syms, err := dynamicSymbols(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Undefined symbols like puts aren't exported.
+	if expt := []string{"foo_data", "foo_init", "foo_run", "foo_weak"}; !reflect.DeepEqual(syms, expt) {
+		t.Errorf("Bad symbols %q, expected %q", syms, expt)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mod := buildModule(t, dir, moduleSrc, "foo_init\nfoo_run\nfoo_data\n")
+	baseline := filepath.Join(dir, "baseline.txt")
+
+	for _, tc := range []struct {
+		name, baseline string
+		ok             bool
+		output         string
+	}{
+		{"match", "# The API.\nfoo_run\nfoo_data\nfoo_init\n", true, ""},
+		{"removed", "foo_data\nfoo_init\nfoo_run\nfoo_stop\n", false,
+			mod + ": removed symbol foo_stop listed in " + baseline + "\n"},
+		{"added", "foo_init\nfoo_run\n", false,
+			mod + ": added symbol foo_data not listed in " + baseline + "\n"},
+		{"both", "foo_init\nfoo_old\n", false,
+			mod + ": removed symbol foo_old listed in " + baseline + "\n" +
+				mod + ": added symbol foo_data not listed in " + baseline + "\n" +
+				mod + ": added symbol foo_run not listed in " + baseline + "\n"},
+	} {
+		ioutil.WriteFile(baseline, []byte(tc.baseline), 0666)
+		var buf bytes.Buffer
+		ok, err := check(&buf, mod, baseline)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if ok != tc.ok {
+			t.Errorf("%s: got %v", tc.name, ok)
+		}
+		if !tc.ok {
+			tc.output += "If the change is intended, update " + baseline + ", e.g. with seb -tool exports " + mod + "\n"
+		}
+		if buf.String() != tc.output {
+			t.Errorf("%s: bad output:\n%s", tc.name, buf.String())
+		}
+	}
+
+	ioutil.WriteFile(baseline, []byte("foo_*\n"), 0666)
+	if _, err := check(ioutil.Discard, mod, baseline); err == nil {
+		t.Error("Expected an error for a pattern in the baseline")
+	}
+}
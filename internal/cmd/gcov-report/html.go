@@ -0,0 +1,111 @@
+// Copyright 2026 Schibsted
+
+package gcov_report
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const htmlStyle = `<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: right; }
+td:first-child, th:first-child { text-align: left; }
+pre { margin: 0; }
+.hit { background: #dfd; }
+.miss { background: #fdd; }
+.count { color: #777; text-align: right; padding-right: 8px; }
+</style>
+`
+
+// Writes index.html with the summary and a page per source file under
+// files/.
+func writeHTML(dir string, files []*fileCov, dirs map[string]*Counts, total Counts) error {
+	err := writeFile(filepath.Join(dir, "index.html"), func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		fmt.Fprintf(bw, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>C and C++ coverage</title>\n%s</head><body>\n", htmlStyle)
+		fmt.Fprintf(bw, "<h1>C and C++ coverage</h1>\n<h2>Directories</h2>\n")
+		writeTableHeader(bw, "Directory")
+		for _, d := range sortedDirs(dirs) {
+			writeTableRow(bw, html.EscapeString(d), *dirs[d])
+		}
+		writeTableRow(bw, "<b>Total</b>", total)
+		fmt.Fprintf(bw, "</table>\n<h2>Files</h2>\n")
+		writeTableHeader(bw, "File")
+		for _, fc := range files {
+			link := fmt.Sprintf("<a href=\"files/%s.html\">%s</a>", html.EscapeString(fc.path), html.EscapeString(fc.path))
+			writeTableRow(bw, link, fc.counts())
+		}
+		fmt.Fprintf(bw, "</table>\n</body></html>\n")
+		return bw.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	for _, fc := range files {
+		page := filepath.Join(dir, "files", fc.path+".html")
+		if err := os.MkdirAll(filepath.Dir(page), 0777); err != nil {
+			return err
+		}
+		if err := writeFile(page, fc.writeHTML); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTableHeader(w io.Writer, title string) {
+	fmt.Fprintf(w, "<table>\n<tr><th>%s</th><th>Lines</th><th></th><th>Functions</th><th></th><th>Branches</th><th></th></tr>\n", title)
+}
+
+func writeTableRow(w io.Writer, name string, c Counts) {
+	fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%d/%d</td><td>%s</td><td>%d/%d</td><td>%s</td><td>%d/%d</td></tr>\n",
+		name,
+		percent(c.LinesHit, c.Lines), c.LinesHit, c.Lines,
+		percent(c.FunctionsHit, c.Functions), c.FunctionsHit, c.Functions,
+		percent(c.BranchesHit, c.Branches), c.BranchesHit, c.Branches)
+}
+
+// Writes the source annotated with the line counts. The source is read from
+// the current directory, if it's gone only the counts are shown.
+func (fc *fileCov) writeHTML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	name := html.EscapeString(fc.path)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n%s</head><body>\n<h1>%s</h1>\n", name, htmlStyle, name)
+	c := fc.counts()
+	fmt.Fprintf(bw, "<p>Lines %s, functions %s, branches %s</p>\n<table>\n",
+		percent(c.LinesHit, c.Lines), percent(c.FunctionsHit, c.Functions), percent(c.BranchesHit, c.Branches))
+
+	var src []string
+	if data, err := ioutil.ReadFile(fc.path); err == nil {
+		src = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	nlines := len(src)
+	if lines := fc.sortedLines(); len(lines) > 0 && lines[len(lines)-1] > nlines {
+		nlines = lines[len(lines)-1]
+	}
+	for l := 1; l <= nlines; l++ {
+		class, count := "", ""
+		if n, ok := fc.lines[l]; ok {
+			count = fmt.Sprint(n)
+			class = "hit"
+			if n == 0 {
+				class = "miss"
+			}
+		}
+		text := ""
+		if l <= len(src) {
+			text = html.EscapeString(src[l-1])
+		}
+		fmt.Fprintf(bw, "<tr class=\"%s\"><td class=\"count\">%d</td><td class=\"count\">%s</td><td><pre>%s</pre></td></tr>\n", class, l, count, text)
+	}
+	fmt.Fprintf(bw, "</table>\n</body></html>\n")
+	return bw.Flush()
+}
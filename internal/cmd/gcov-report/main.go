@@ -0,0 +1,497 @@
+// Copyright 2026 Schibsted
+
+// Package gcov_report collects the coverage of C and C++ code built in a gcov
+// flavor into a report.
+//
+// The .gcda files written when running the programs are found in the object
+// directory of the flavor and given to gcov, whose output is merged into an
+// lcov tracefile, an html report and a summary per source directory. With
+// gcc, the JSON format of gcov is used. With clang, llvm-cov gcov only writes
+// the text format, which lacks function and branch coverage.
+//
+// Installed headers are mapped back to their source using the # line
+// directive header-install puts first in them.
+package gcov_report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	flagset   = flag.NewFlagSet("gcov-report", flag.ExitOnError)
+	buildpath = flagset.String("buildpath", "build", "The build directory.")
+	gcovCmd   = flagset.String("gcov", "gcov", "The gcov command, e.g. gcov-12 or llvm-cov gcov.")
+	outdir    = flagset.String("out", "", "Directory to write the report to. Defaults to build/<flavor>/ccover.")
+)
+
+type branchKey struct {
+	line, index int
+}
+
+type funcCov struct {
+	name  string
+	line  int
+	count int64
+}
+
+type fileCov struct {
+	path     string
+	lines    map[int]int64
+	funcs    map[string]*funcCov
+	branches map[branchKey]int64
+}
+
+type Counts struct {
+	Lines        int `json:"lines"`
+	LinesHit     int `json:"lines_hit"`
+	Functions    int `json:"functions"`
+	FunctionsHit int `json:"functions_hit"`
+	Branches     int `json:"branches"`
+	BranchesHit  int `json:"branches_hit"`
+}
+
+type report struct {
+	top   string
+	files map[string]*fileCov
+	// The sources of installed headers, by path.
+	headerSources map[string]string
+}
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool gcov-report [options] <flavor>\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() != 1 || len(strings.Fields(*gcovCmd)) == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	flavor := flagset.Arg(0)
+	if *outdir == "" {
+		*outdir = filepath.Join(*buildpath, flavor, "ccover")
+	}
+	if err := run(flavor); err != nil {
+		fmt.Fprintf(os.Stderr, "gcov-report: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(flavor string) error {
+	top, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	rep := &report{
+		top:           top,
+		files:         make(map[string]*fileCov),
+		headerSources: make(map[string]string),
+	}
+	objdir := filepath.Join(*buildpath, "obj", flavor)
+	var gcdas []string
+	err = filepath.Walk(objdir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".gcda") {
+			gcdas = append(gcdas, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(gcdas) == 0 {
+		return fmt.Errorf("no coverage data found in %s, build with gcov and run the tests first", objdir)
+	}
+
+	gcov := strings.Fields(*gcovCmd)
+	useJSON := !strings.Contains(gcov[0], "llvm-cov")
+	// Keep the command lines reasonably short.
+	for len(gcdas) > 0 {
+		n := len(gcdas)
+		if n > 100 {
+			n = 100
+		}
+		if err := rep.runGcov(gcov, useJSON, gcdas[:n]); err != nil {
+			return err
+		}
+		gcdas = gcdas[n:]
+	}
+
+	if err := os.MkdirAll(*outdir, 0777); err != nil {
+		return err
+	}
+	files := rep.sortedFiles()
+	if err := writeFile(filepath.Join(*outdir, "coverage.info"), func(w io.Writer) error {
+		return writeLcov(w, files)
+	}); err != nil {
+		return err
+	}
+	dirs, total := summarize(files)
+	if err := writeFile(filepath.Join(*outdir, "summary.json"), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(struct {
+			Total       Counts             `json:"total"`
+			Directories map[string]*Counts `json:"directories"`
+		}{total, dirs})
+	}); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(*outdir, "summary.txt"), func(w io.Writer) error {
+		return writeSummary(w, dirs, total)
+	}); err != nil {
+		return err
+	}
+	if err := writeHTML(*outdir, files, dirs, total); err != nil {
+		return err
+	}
+	fmt.Printf("ccover: %s of lines, report in %s\n", percent(total.LinesHit, total.Lines), filepath.Join(*outdir, "index.html"))
+	return nil
+}
+
+func (rep *report) runGcov(gcov []string, useJSON bool, gcdas []string) error {
+	args := append([]string{}, gcov[1:]...)
+	if useJSON {
+		args = append(args, "-j", "-b")
+	}
+	args = append(args, "-t")
+	args = append(args, gcdas...)
+	cmd := exec.Command(gcov[0], args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		os.Stderr.Write(stderr.Bytes())
+		return fmt.Errorf("%s: %s", gcov[0], err)
+	}
+	if useJSON {
+		return rep.parseJSON(out)
+	}
+	return rep.parseText(out)
+}
+
+type gcovJSON struct {
+	CWD   string `json:"current_working_directory"`
+	Files []struct {
+		File      string
+		Functions []struct {
+			Name           string `json:"demangled_name"`
+			StartLine      int    `json:"start_line"`
+			ExecutionCount int64  `json:"execution_count"`
+		}
+		Lines []struct {
+			LineNumber int   `json:"line_number"`
+			Count      int64 `json:"count"`
+			Branches   []struct {
+				Count int64
+			}
+		}
+	}
+}
+
+func (rep *report) parseJSON(out []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var doc gcovJSON
+		if err := dec.Decode(&doc); err != nil {
+			return err
+		}
+		for _, f := range doc.Files {
+			file := f.File
+			if !filepath.IsAbs(file) && doc.CWD != "" {
+				file = filepath.Join(doc.CWD, file)
+			}
+			fc, offset := rep.file(file)
+			if fc == nil {
+				continue
+			}
+			for _, fn := range f.Functions {
+				fc.addFunc(fn.Name, fn.StartLine-offset, fn.ExecutionCount)
+			}
+			for _, l := range f.Lines {
+				line := l.LineNumber - offset
+				fc.lines[line] += l.Count
+				for i, b := range l.Branches {
+					fc.branches[branchKey{line, i}] += b.Count
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Parses the gcov text format, lines like "count:lineno:source" where count
+// is - for lines without code and ##### for lines not run.
+func (rep *report) parseText(out []byte) error {
+	var fc *fileCov
+	var offset int
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		count := strings.TrimSpace(parts[0])
+		lineno, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			continue
+		}
+		if lineno == 0 {
+			if strings.HasPrefix(parts[2], "Source:") {
+				fc, offset = rep.file(strings.TrimPrefix(parts[2], "Source:"))
+			}
+			continue
+		}
+		if fc == nil || count == "-" {
+			continue
+		}
+		var n int64
+		if count != "#####" && count != "=====" {
+			n, err = strconv.ParseInt(strings.TrimSuffix(count, "*"), 10, 64)
+			if err != nil {
+				continue
+			}
+		}
+		fc.lines[lineno-offset] += n
+	}
+	return scanner.Err()
+}
+
+var lineDirective = regexp.MustCompile(`^# line 1 "(.*)"$`)
+
+// Returns the coverage of the source file, and the number of lines to
+// subtract to get the line in it. Returns nil for files outside of the
+// source tree, such as system headers.
+func (rep *report) file(path string) (*fileCov, int) {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(rep.top, path)
+		if err != nil {
+			return nil, 0
+		}
+		path = rel
+	}
+	path = filepath.Clean(path)
+	if path == ".." || strings.HasPrefix(path, "../") {
+		return nil, 0
+	}
+	offset := 0
+	if src := rep.headerSource(path); src != "" {
+		path = src
+		offset = 1
+	}
+	fc := rep.files[path]
+	if fc == nil {
+		fc = &fileCov{
+			path:     path,
+			lines:    make(map[int]int64),
+			funcs:    make(map[string]*funcCov),
+			branches: make(map[branchKey]int64),
+		}
+		rep.files[path] = fc
+	}
+	return fc, offset
+}
+
+// Returns the source of a header installed in the build directory, or ""
+// if path isn't one.
+func (rep *report) headerSource(path string) string {
+	if !strings.HasPrefix(path, filepath.Clean(*buildpath)+"/") {
+		return ""
+	}
+	if src, ok := rep.headerSources[path]; ok {
+		return src
+	}
+	var src string
+	if f, err := os.Open(path); err == nil {
+		line, _ := bufio.NewReader(f).ReadString('\n')
+		f.Close()
+		if m := lineDirective.FindStringSubmatch(strings.TrimSuffix(line, "\n")); m != nil {
+			src = filepath.Clean(m[1])
+		}
+	}
+	rep.headerSources[path] = src
+	return src
+}
+
+func (fc *fileCov) addFunc(name string, line int, count int64) {
+	fn := fc.funcs[name]
+	if fn == nil {
+		fn = &funcCov{name: name, line: line}
+		fc.funcs[name] = fn
+	}
+	fn.count += count
+}
+
+func (rep *report) sortedFiles() []*fileCov {
+	var files []*fileCov
+	for _, fc := range rep.files {
+		if len(fc.lines) > 0 {
+			files = append(files, fc)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+	return files
+}
+
+func (fc *fileCov) sortedLines() []int {
+	lines := make([]int, 0, len(fc.lines))
+	for l := range fc.lines {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func (fc *fileCov) counts() Counts {
+	var c Counts
+	for _, n := range fc.lines {
+		c.Lines++
+		if n > 0 {
+			c.LinesHit++
+		}
+	}
+	for _, fn := range fc.funcs {
+		c.Functions++
+		if fn.count > 0 {
+			c.FunctionsHit++
+		}
+	}
+	for _, n := range fc.branches {
+		c.Branches++
+		if n > 0 {
+			c.BranchesHit++
+		}
+	}
+	return c
+}
+
+func (c *Counts) add(o Counts) {
+	c.Lines += o.Lines
+	c.LinesHit += o.LinesHit
+	c.Functions += o.Functions
+	c.FunctionsHit += o.FunctionsHit
+	c.Branches += o.Branches
+	c.BranchesHit += o.BranchesHit
+}
+
+func percent(hit, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(hit)*100/float64(total))
+}
+
+// Writes the lcov tracefile, see the geninfo man page for the format.
+func writeLcov(w io.Writer, files []*fileCov) error {
+	bw := bufio.NewWriter(w)
+	for _, fc := range files {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", fc.path)
+		var funcs []*funcCov
+		for _, fn := range fc.funcs {
+			funcs = append(funcs, fn)
+		}
+		sort.Slice(funcs, func(i, j int) bool {
+			if funcs[i].line != funcs[j].line {
+				return funcs[i].line < funcs[j].line
+			}
+			return funcs[i].name < funcs[j].name
+		})
+		for _, fn := range funcs {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.line, fn.name)
+		}
+		for _, fn := range funcs {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.count, fn.name)
+		}
+		c := fc.counts()
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", c.Functions, c.FunctionsHit)
+		var branches []branchKey
+		for k := range fc.branches {
+			branches = append(branches, k)
+		}
+		sort.Slice(branches, func(i, j int) bool {
+			if branches[i].line != branches[j].line {
+				return branches[i].line < branches[j].line
+			}
+			return branches[i].index < branches[j].index
+		})
+		for _, k := range branches {
+			taken := strconv.FormatInt(fc.branches[k], 10)
+			if fc.lines[k.line] == 0 {
+				taken = "-"
+			}
+			fmt.Fprintf(bw, "BRDA:%d,0,%d,%s\n", k.line, k.index, taken)
+		}
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", c.Branches, c.BranchesHit)
+		for _, l := range fc.sortedLines() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l, fc.lines[l])
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", c.Lines, c.LinesHit)
+	}
+	return bw.Flush()
+}
+
+func summarize(files []*fileCov) (map[string]*Counts, Counts) {
+	dirs := make(map[string]*Counts)
+	var total Counts
+	for _, fc := range files {
+		dir := filepath.Dir(fc.path)
+		if dirs[dir] == nil {
+			dirs[dir] = &Counts{}
+		}
+		c := fc.counts()
+		dirs[dir].add(c)
+		total.add(c)
+	}
+	return dirs, total
+}
+
+func sortedDirs(dirs map[string]*Counts) []string {
+	var names []string
+	for d := range dirs {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeSummary(w io.Writer, dirs map[string]*Counts, total Counts) error {
+	bw := bufio.NewWriter(w)
+	line := func(name string, c Counts) {
+		fmt.Fprintf(bw, "%-40s %7s %7s %7s\n", name, percent(c.LinesHit, c.Lines), percent(c.FunctionsHit, c.Functions), percent(c.BranchesHit, c.Branches))
+	}
+	fmt.Fprintf(bw, "%-40s %7s %7s %7s\n", "directory", "lines", "funcs", "branches")
+	for _, d := range sortedDirs(dirs) {
+		line(d, *dirs[d])
+	}
+	line("total", total)
+	return bw.Flush()
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,189 @@
+// Copyright 2026 Schibsted
+
+package gcov_report
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestReport(top string) *report {
+	return &report{
+		top:           top,
+		files:         make(map[string]*fileCov),
+		headerSources: make(map[string]string),
+	}
+}
+
+func lcov(t *testing.T, rep *report) string {
+	var buf bytes.Buffer
+	if err := writeLcov(&buf, rep.sortedFiles()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// Output of gcov -j -b -t from gcc 12, run in /tmp/gc. gcc follows the
+// # line directive of the installed header, so lib/util.h is reported.
+func TestParseJSON(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcov.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep := newTestReport("/tmp/gc")
+	if err := rep.parseJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	expt := `TN:
+SF:lib/util.h
+FN:1,clamp
+FNDA:1,clamp
+FNF:1
+FNH:1
+BRDA:3,0,0,1
+BRDA:3,0,1,0
+BRF:2
+BRH:1
+DA:1,1
+DA:3,1
+DA:4,1
+DA:5,0
+LF:4
+LH:3
+end_of_record
+TN:
+SF:prog/main.c
+FN:3,unused
+FN:8,main
+FNDA:0,unused
+FNDA:1,main
+FNF:2
+FNH:1
+BRDA:10,0,0,0
+BRDA:10,0,1,1
+BRF:2
+BRH:1
+DA:3,0
+DA:5,0
+DA:8,1
+DA:10,1
+DA:11,0
+DA:12,1
+LF:6
+LH:3
+end_of_record
+`
+	if got := lcov(t, rep); got != expt {
+		t.Errorf("Bad lcov output:\n%s", got)
+	}
+
+	// Running it twice, e.g. for two objects including the header, adds
+	// the counts.
+	if err := rep.parseJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	fc := rep.files["prog/main.c"]
+	if fc.lines[8] != 2 || fc.funcs["main"].count != 2 || fc.branches[branchKey{10, 1}] != 2 {
+		t.Errorf("Counts not merged %#v", fc)
+	}
+}
+
+// Sets up a source tree with a header installed by header-install and
+// changes to it. The returned function changes back and removes it.
+func chdirInstalledHeader(t *testing.T) (string, func()) {
+	top, err := ioutil.TempDir("", "gcov-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := filepath.Join(top, "build/dev/include/util.h")
+	if err := os.MkdirAll(filepath.Dir(hdr), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(hdr, []byte("# line 1 \"lib/util.h\"\nstatic inline int clamp(int v, int max)\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(top); err != nil {
+		t.Fatal(err)
+	}
+	return top, func() {
+		os.Chdir(wd)
+		os.RemoveAll(top)
+	}
+}
+
+// Text output like llvm-cov gcov writes it, which reports the installed
+// header with its own line numbers, one more than in the source because of
+// the # line 1 directive. Files outside the source tree are skipped.
+func TestParseTextInstalledHeader(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/llvm-cov.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, cleanup := chdirInstalledHeader(t)
+	defer cleanup()
+	rep := newTestReport(top)
+	if err := rep.parseText(data); err != nil {
+		t.Fatal(err)
+	}
+	expt := `TN:
+SF:lib/util.h
+FNF:0
+FNH:0
+BRF:0
+BRH:0
+DA:1,1
+DA:3,1
+DA:4,1
+DA:5,0
+LF:4
+LH:3
+end_of_record
+TN:
+SF:prog/main.c
+FNF:0
+FNH:0
+BRF:0
+BRH:0
+DA:3,0
+DA:5,0
+DA:8,1
+DA:10,1
+DA:11,0
+DA:12,1
+LF:6
+LH:3
+end_of_record
+`
+	if got := lcov(t, rep); got != expt {
+		t.Errorf("Bad lcov output:\n%s", got)
+	}
+	if src := rep.headerSources["build/dev/include/util.h"]; src != "lib/util.h" {
+		t.Errorf("Bad header source %q", src)
+	}
+}
+
+func TestParseJSONInstalledHeader(t *testing.T) {
+	top, cleanup := chdirInstalledHeader(t)
+	defer cleanup()
+	rep := newTestReport(top)
+	doc := `{"current_working_directory": "` + top + `", "files": [{"file": "build/dev/include/util.h",
+		"functions": [{"demangled_name": "clamp", "start_line": 2, "execution_count": 3}],
+		"lines": [{"line_number": 2, "count": 3, "branches": []}, {"line_number": 4, "count": 3, "branches": [{"count": 1}, {"count": 2}]}]}]}`
+	if err := rep.parseJSON([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	fc := rep.files["lib/util.h"]
+	if fc == nil || len(rep.files) != 1 {
+		t.Fatalf("Header not mapped to its source %v", rep.files)
+	}
+	if fc.lines[1] != 3 || fc.lines[3] != 3 || fc.funcs["clamp"].line != 1 || fc.branches[branchKey{3, 1}] != 2 {
+		t.Errorf("Bad header coverage %#v", fc)
+	}
+}
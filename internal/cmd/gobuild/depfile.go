@@ -10,35 +10,77 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 )
 
+// Files of the packages that the output depends on, in the format of go list
+// -f. The go.mod files of the modules are listed separately since go.sum isn't
+// part of the package.
+var depfileFields = []string{"GoFiles", "CgoFiles", "HFiles", "CFiles", "CXXFiles", "SFiles", "SysoFiles", "EmbedFiles", "TestGoFiles", "TestEmbedFiles", "XTestGoFiles", "XTestEmbedFiles"}
+
+func depfileTemplate() string {
+	var tmpl strings.Builder
+	tmpl.WriteString(`{{$dir:=.Dir}}`)
+	for _, f := range depfileFields {
+		fmt.Fprintf(&tmpl, `{{range .%s}}{{$dir}}/{{.}} {{end}}`, f)
+	}
+	tmpl.WriteString(`{{with .Module}}{{.GoMod}} {{end}}`)
+	return tmpl.String()
+}
+
 func writeDepfile(depf *os.File) error {
 	defer depf.Close()
 
 	var buf bytes.Buffer
-	err := runWithBuildFlagsAndPkg(&buf, "go", "list", "-deps", "-f", `{{$dir:=.Dir}}{{range .GoFiles}}{{$dir}}/{{.}} {{end}}{{range .CgoFiles}}{{$dir}}/{{.}} {{end}}{{range .HFiles}}{{$dir}}/{{.}} {{end}}{{range .CFiles}}{{$dir}}/{{.}} {{end}}{{range .TestGoFiles}}{{$dir}}/{{.}} {{end}}`)
+	err := runWithBuildFlagsAndPkg(&buf, "go", "list", "-deps", "-f", depfileTemplate())
 	if err != nil {
 		return err
 	}
 
 	// Ignore files in GOROOT and in modules. These should not normally
-	// change, except on Go version upgrades, but I think it's a fair trade
-	// with dependency size to have to manually rebuild after upgrading Go.
-	goroot := []byte(runtime.GOROOT() + "/")
-	gomodroot := []byte(filepath.Join(build.Default.GOPATH, "pkg/mod") + "/")
+	// change, modules are versioned by go.mod and go.sum and GOROOT by the
+	// go version stamp, see go_track_deps.
+	goroot := runtime.GOROOT() + "/"
+	gomodroot := filepath.Join(build.Default.GOPATH, "pkg/mod") + "/"
 
+	// The workspace selects the modules, the go command adds go.work.sum
+	// next to it.
+	if gowork := goWork(); gowork != "" {
+		buf.WriteString(" " + gowork)
+		if sum := gowork + ".sum"; fileExists(sum) {
+			buf.WriteString(" " + sum)
+		}
+	}
+
+	seen := make(map[string]bool)
 	w := bufio.NewWriter(depf)
 	fmt.Fprintf(w, "%s:", outpath)
 	s := bufio.NewScanner(&buf)
 	s.Split(bufio.ScanWords)
 	for s.Scan() {
-		dep := bytes.TrimSpace(s.Bytes())
-		if bytes.HasPrefix(dep, goroot) || bytes.HasPrefix(dep, gomodroot) {
+		dep := s.Text()
+		if strings.HasPrefix(dep, goroot) || strings.HasPrefix(dep, gomodroot) {
 			continue
 		}
-		w.WriteRune(' ')
-		w.Write(dep)
+		deps := []string{dep}
+		if filepath.Base(dep) == "go.mod" {
+			if sum := filepath.Join(filepath.Dir(dep), "go.sum"); fileExists(sum) {
+				deps = append(deps, sum)
+			}
+		}
+		for _, d := range deps {
+			if !seen[d] {
+				seen[d] = true
+				w.WriteRune(' ')
+				w.WriteString(d)
+			}
+		}
 	}
 	w.WriteRune('\n')
 	return w.Flush()
 }
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -11,15 +11,23 @@ import (
 )
 
 func executeWithLdFlagsAndPkg(ldflags []string, name string, args ...string) {
+	args = appendGoFlags(args)
 	args = appendFromEnv(args, "GOBUILD_FLAGS")
 	args = append(args, ldflags...)
 	executeWithPkg(name, args...)
 }
 
 func executeWithTestFlagsAndPkg(name string, args ...string) {
+	executeWithPkg(name, appendTestFlags(args)...)
+}
+
+func appendTestFlags(args []string) []string {
+	args = appendGoFlags(args)
+	if *goLdflags != "" {
+		args = append(args, "-ldflags", *goLdflags)
+	}
 	args = appendFromEnv(args, "GOBUILD_FLAGS")
-	args = appendFromEnv(args, "GOBUILD_TEST_FLAGS")
-	executeWithPkg(name, args...)
+	return appendFromEnv(args, "GOBUILD_TEST_FLAGS")
 }
 
 func executeWithPkg(name string, args ...string) {
@@ -41,6 +49,7 @@ func execute(name string, args ...string) {
 }
 
 func runWithBuildFlagsAndPkg(out io.Writer, name string, args ...string) error {
+	args = appendGoFlags(args)
 	args = appendFromEnv(args, "GOBUILD_FLAGS")
 	if *pkg != "" {
 		args = append(args, *pkg)
@@ -57,3 +66,18 @@ func appendFromEnv(args []string, envname string) []string {
 	}
 	return args
 }
+
+// appendGoFlags adds the go flag for the sanitizer, e.g. -race, and the
+// build flags given to us.
+func appendGoFlags(args []string) []string {
+	if *sanitize != "" {
+		args = append(args, "-"+*sanitize)
+	}
+	if *tags != "" {
+		args = append(args, "-tags", *tags)
+	}
+	if *gcflags != "" {
+		args = append(args, "-gcflags", *gcflags)
+	}
+	return args
+}
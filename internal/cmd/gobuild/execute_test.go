@@ -0,0 +1,34 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestAppendTestFlagsSanitize(t *testing.T) {
+	for _, e := range []struct{ name, value string }{{"GOBUILD_FLAGS", "-v"}, {"GOBUILD_TEST_FLAGS", "-count=1"}} {
+		old, ok := os.LookupEnv(e.name)
+		os.Setenv(e.name, e.value)
+		if ok {
+			defer os.Setenv(e.name, old)
+		} else {
+			defer os.Unsetenv(e.name)
+		}
+	}
+	*sanitize = "race"
+	defer func() { *sanitize = "" }()
+
+	args := appendTestFlags([]string{"test"})
+	if expt := []string{"test", "-race", "-v", "-count=1"}; !reflect.DeepEqual(args, expt) {
+		t.Errorf("Bad args %q, expected %q", args, expt)
+	}
+
+	*sanitize = ""
+	args = appendTestFlags([]string{"test"})
+	if expt := []string{"test", "-v", "-count=1"}; !reflect.DeepEqual(args, expt) {
+		t.Errorf("Bad args without sanitizer %q, expected %q", args, expt)
+	}
+}
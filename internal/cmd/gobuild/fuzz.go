@@ -0,0 +1,64 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runFuzz runs a fuzz test for -fuzztime. When an input makes it fail, the
+// go command adds it to the seed corpus in testdata/fuzz of the package
+// directory, where the normal tests also run it. Point out the new files so
+// they're committed with the fix.
+func runFuzz() {
+	if *fuzz == "" {
+		fmt.Fprintln(os.Stderr, "mode=fuzz needs -fuzz")
+		os.Exit(2)
+	}
+	var corpus string
+	var buf bytes.Buffer
+	if err := runWithBuildFlagsAndPkg(&buf, "go", "list", "-f", "{{.Dir}}"); err == nil {
+		dir := strings.SplitN(strings.TrimSpace(buf.String()), "\n", 2)[0]
+		corpus = filepath.Join(dir, "testdata", "fuzz", *fuzz)
+	}
+	before := corpusFiles(corpus)
+
+	args := []string{"test", "-run=^$", "-fuzz=^" + *fuzz + "$"}
+	if *fuzztime != "" {
+		args = append(args, "-fuzztime="+*fuzztime)
+	}
+	args = appendTestFlags(args)
+	if *pkg != "" {
+		args = append(args, *pkg)
+	}
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		for f := range corpusFiles(corpus) {
+			if !before[f] {
+				fmt.Fprintf(os.Stderr, "gobuild: new failing input %s added to the seed corpus, commit it with the fix\n", filepath.Join(corpus, f))
+			}
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func corpusFiles(dir string) map[string]bool {
+	files := make(map[string]bool)
+	if dir == "" {
+		return files
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	for _, fi := range infos {
+		files[fi.Name()] = true
+	}
+	return files
+}
@@ -28,21 +28,37 @@ import (
 )
 
 var (
-	flagset   = flag.NewFlagSet("gobuild", flag.ExitOnError)
-	inpath    string
-	outpath   string
-	depfile   string
-	pkg       = flagset.String("pkg", "", "Explicit go package name. If unset the relative path is used.")
-	cflags    = flagset.String("cflags", "", "C flags to use with cgo.")
-	ldflags   = flagset.String("ldflags", "", "Linker flags to use with cgo. Can contain objects or flags.")
-	mode      = flagset.String("mode", "prog", "Type of output. One of prog, prog-nocgo, module, test-prog, lib, piclib, test, bench, cover, cover_html")
-	pkgdir    = flagset.String("pkgdir", "", "Directory to store compiled standard packages. Only used when custom versions are needed.")
-	libNoInit = flagset.Bool("lib-noinit", false, "Disable initializing the Go runtime automatically. Only applies to mode=lib and mode=piclib. Needed if your program forks, as the Go runtime can't survive that. See documentation for how to load the runtime manually.")
+	flagset    = flag.NewFlagSet("gobuild", flag.ExitOnError)
+	inpath     string
+	outpath    string
+	depfile    string
+	pkg        = flagset.String("pkg", "", "Explicit go package name. If unset the relative path is used.")
+	cflags     = flagset.String("cflags", "", "C flags to use with cgo.")
+	ldflags    = flagset.String("ldflags", "", "Linker flags to use with cgo. Can contain objects or flags.")
+	mode       = flagset.String("mode", "prog", "Type of output. One of prog, prog-nocgo, module, test-prog, lib, piclib, test, bench, fuzz, cover, cover_html, vet")
+	pkgdir     = flagset.String("pkgdir", "", "Directory to store compiled standard packages. Only used when custom versions are needed.")
+	sanitize   = flagset.String("sanitize", "", "Sanitizer to build with. One of asan, msan or race. Empty for none.")
+	tags       = flagset.String("tags", "", "Comma separated build tags, passed to the go command as -tags.")
+	gcflags    = flagset.String("gcflags", "", "Flags passed to the go command as -gcflags.")
+	goLdflags  = flagset.String("goldflags", "", "Flags passed to the go linker, added to the -ldflags of the go command.")
+	versionVar = flagset.String("version-var", "", "Variable set to -version with -ldflags -X, e.g. main.Version. The variables with Flavor and Conditions appended are set to -flavor and -conditions, if they exist.")
+	version    = flagset.String("version", "", "The build version, see -version-var.")
+	flavor     = flagset.String("flavor", "", "The build flavor, see -version-var.")
+	conditions = flagset.String("conditions", "", "Comma separated conditions of the flavor, see -version-var.")
+	buildID    = flagset.Bool("build-id", false, "Add a GNU build-id note derived from the Go build ID. Needs Go 1.20 or later.")
+	coverpkg   = flagset.String("coverpkg", "", "Only applies to mode=cover. Comma separated packages to measure the coverage of, passed to go test -coverpkg.")
+	fuzz       = flagset.String("fuzz", "", "Only applies to mode=fuzz. The fuzz test to run.")
+	fuzztime   = flagset.String("fuzztime", "", "Only applies to mode=fuzz. How long to fuzz, as for go test -fuzztime.")
+	report     = flagset.String("report", "", "Only applies to mode=test. Write the test results to this path with .xml appended as JUnit XML and .json appended as a JSON summary.")
+	moddirs    = flagset.String("moddirs", "", "Only applies to mode=cover_html. Space separated directories of the modules the profile can have packages from.")
+	libNoInit  = flagset.Bool("lib-noinit", false, "Disable initializing the Go runtime automatically. Only applies to mode=lib and mode=piclib. Needed if your program forks, as the Go runtime can't survive that. See documentation for how to load the runtime manually.")
 
+	topdir    string
 	absin     string
 	absout    string
 	absdep    string
 	abspkgdir string
+	absreport string
 	objs      []string
 )
 
@@ -69,12 +85,23 @@ func Main(args ...string) {
 		os.Exit(2)
 	}
 
+	switch *sanitize {
+	case "", "asan", "msan", "race":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown sanitizer %q\n", *sanitize)
+		os.Exit(2)
+	}
+
 	if err := setAbsPaths(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 
-	setRelPkg()
+	// The coverage profile isn't a package, its packages are found by
+	// coverHTML.
+	if *mode != "cover_html" {
+		setRelPkg()
+	}
 	if *pkg == "" && *mode != "cover_html" {
 		// Ignore errors here, they'll be detected later.
 		os.Chdir(absin)
@@ -100,7 +127,16 @@ func Main(args ...string) {
 		}()
 	}
 
-	var ldflags []string
+	var goldflags []string
+	if *goLdflags != "" {
+		goldflags = append(goldflags, *goLdflags)
+	}
+	if *versionVar != "" {
+		goldflags = append(goldflags, versionLdflags()...)
+	}
+	if *buildID {
+		goldflags = append(goldflags, "-B gobuildid")
+	}
 	if len(objs) > 0 {
 		var extldflags strings.Builder
 		extldflags.WriteString(`-extldflags "`)
@@ -110,7 +146,11 @@ func Main(args ...string) {
 		}
 		extldflags.WriteString(os.Getenv("CGO_LDFLAGS"))
 		extldflags.WriteRune('"')
-		ldflags = append(ldflags, "-ldflags", extldflags.String())
+		goldflags = append(goldflags, extldflags.String())
+	}
+	var ldflags []string
+	if len(goldflags) > 0 {
+		ldflags = append(ldflags, "-ldflags", strings.Join(goldflags, " "))
 	}
 
 	switch *mode {
@@ -124,17 +164,25 @@ func Main(args ...string) {
 	case "module":
 		executeWithLdFlagsAndPkg(ldflags, "go", "build", "-o", absout, "-buildmode=plugin")
 	case "test":
-		executeWithTestFlagsAndPkg("go", "test")
+		runTests("go", "test")
 	case "bench":
 		bench := flagset.Arg(1)
 		if bench == "" {
 			bench = "."
 		}
 		executeWithTestFlagsAndPkg("go", "test", "-bench", bench)
+	case "fuzz":
+		runFuzz()
 	case "cover":
-		executeWithTestFlagsAndPkg("go", "test", "-coverprofile="+absout)
+		args := []string{"test", "-coverprofile=" + absout}
+		if *coverpkg != "" {
+			args = append(args, "-coverpkg="+*coverpkg)
+		}
+		executeWithTestFlagsAndPkg("go", args...)
 	case "cover_html":
-		execute("go", "tool", "cover", "-html="+inpath, "-o", outpath)
+		coverHTML()
+	case "vet":
+		runVet()
 	case "lib", "piclib":
 		buildCArchive(*mode, ldflags)
 	default:
@@ -143,9 +191,23 @@ func Main(args ...string) {
 	}
 }
 
+// The -X flags setting the version variables. The linker ignores variables
+// that don't exist, so only the ones declared are set.
+func versionLdflags() []string {
+	var ret []string
+	for _, v := range []struct{ suffix, value string }{
+		{"", *version},
+		{"Flavor", *flavor},
+		{"Conditions", *conditions},
+	} {
+		ret = append(ret, fmt.Sprintf("-X '%s%s=%s'", *versionVar, v.suffix, v.value))
+	}
+	return ret
+}
+
 func needOutpath(mode string) bool {
 	switch mode {
-	case "test", "bench":
+	case "test", "bench", "fuzz":
 		return false
 	}
 	return true
@@ -153,16 +215,21 @@ func needOutpath(mode string) bool {
 
 func needDepfile(mode string) bool {
 	switch mode {
-	case "test", "bench", "cover_html":
+	case "test", "bench", "fuzz", "cover_html":
 		return false
 	}
 	return true
 }
 
-// setAbsPath sets absin, absout, absdep, abspkgdir, objs, CGO_CFLAGS,
-// CGO_LDFLAGS to absolute paths.  It uses the globals inpath, output,
-// cflags, ldflags, pkgdir.
+// setAbsPath sets absin, absout, absdep, abspkgdir, absreport, objs,
+// CGO_CFLAGS, CGO_LDFLAGS, GOWORK to absolute paths.  It uses the globals inpath,
+// output, cflags, ldflags, pkgdir, report. It also sets topdir to the current
+// directory.
 func setAbsPaths() (err error) {
+	topdir, err = os.Getwd()
+	if err != nil {
+		return err
+	}
 	absin, err = filepath.Abs(inpath)
 	if err != nil {
 		return err
@@ -181,6 +248,22 @@ func setAbsPaths() (err error) {
 			return err
 		}
 	}
+	if *report != "" {
+		absreport, err = filepath.Abs(*report)
+		if err != nil {
+			return err
+		}
+	}
+
+	// GOWORK is relative the top directory when set by seb, but we might
+	// change directory.
+	if gowork := goWork(); gowork != "" && !filepath.IsAbs(gowork) {
+		gowork, err = filepath.Abs(gowork)
+		if err != nil {
+			return err
+		}
+		os.Setenv("GOWORK", gowork)
+	}
 
 	setAbsList("CGO_CFLAGS", " ", *cflags, false)
 	setAbsList("CGO_LDFLAGS", " ", *ldflags, true)
@@ -218,6 +301,15 @@ func setRelPkg() {
 	if *pkg != "" {
 		return
 	}
+	// In a workspace the packages of all the modules in it can be built
+	// from here. Other packages are built outside it.
+	if gowork := goWork(); gowork != "" {
+		if inWorkspace(gowork, absin) {
+			*pkg = "./" + inpath
+			return
+		}
+		os.Setenv("GOWORK", "off")
+	}
 	// Using a relative path helps the error messages, since we don't have to
 	// change the current directory, but it won't work if it's not within the
 	// same module.
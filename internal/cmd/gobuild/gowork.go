@@ -0,0 +1,160 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the absolute directories of the modules used by the go.work.
+func goWorkUses(gowork string) ([]string, error) {
+	data, err := ioutil.ReadFile(gowork)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(gowork)
+	var uses []string
+	inBlock := false
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case inBlock:
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "use" && len(fields) > 1:
+			fields = fields[1:]
+		default:
+			continue
+		}
+		use := strings.Trim(fields[0], `"`)
+		if !filepath.IsAbs(use) {
+			use = filepath.Join(dir, use)
+		}
+		uses = append(uses, filepath.Clean(use))
+	}
+	return uses, s.Err()
+}
+
+// Returns the directory of the module containing dir, or "" if there's none.
+func moduleDir(dir string) string {
+	for {
+		if fileExists(filepath.Join(dir, "go.mod")) {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Checks if the absolute directory dir is in one of the modules of the
+// go.work. Go sources of C descriptors are usually in a directory of their
+// own, not part of the workspace.
+func inWorkspace(gowork, dir string) bool {
+	mod := moduleDir(dir)
+	if mod == "" {
+		return false
+	}
+	uses, err := goWorkUses(gowork)
+	if err != nil {
+		return false
+	}
+	for _, u := range uses {
+		if u == mod {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns GOWORK unless it's unset or off.
+func goWork() string {
+	if gowork := os.Getenv("GOWORK"); gowork != "off" {
+		return gowork
+	}
+	return ""
+}
+
+// Writes the html coverage report. The packages of the profile are found
+// by the go command, and a merged profile can have packages from all the
+// modules. With a workspace they're all found from here, and a single
+// module is used from its directory. Otherwise a temporary workspace of the
+// modules is used, e.g. in offline mode.
+func coverHTML() {
+	dirs := strings.Fields(*moddirs)
+	var tmpdir string
+	switch {
+	case goWork() != "" || len(dirs) == 0:
+	case len(dirs) == 1:
+		if err := os.Chdir(dirs[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		var err error
+		tmpdir, err = ioutil.TempDir("", "gobuild-cover")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmpdir)
+		args := []string{"work", "init"}
+		for _, d := range dirs {
+			abs, err := filepath.Abs(d)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			args = append(args, abs)
+		}
+		cmd := exec.Command("go", args...)
+		cmd.Dir = tmpdir
+		cmd.Env = append(os.Environ(), "GOWORK=")
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Setenv("GOWORK", filepath.Join(tmpdir, "go.work"))
+		// Only the modules of the workspace are used, not their vendor
+		// directories.
+		var goflags []string
+		for _, f := range strings.Fields(os.Getenv("GOFLAGS")) {
+			if !strings.HasPrefix(f, "-mod=") {
+				goflags = append(goflags, f)
+			}
+		}
+		os.Setenv("GOFLAGS", strings.Join(goflags, " "))
+	}
+	// Not execute, the temporary directory must be removed.
+	cmd := exec.Command("go", "tool", "cover", "-html="+absin, "-o", absout)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if tmpdir != "" {
+			os.RemoveAll(tmpdir)
+		}
+		os.Exit(1)
+	}
+}
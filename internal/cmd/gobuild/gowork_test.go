@@ -0,0 +1,115 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGoWorkUses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gowork := filepath.Join(dir, "build", "go.work")
+	os.MkdirAll(filepath.Dir(gowork), 0777)
+	ioutil.WriteFile(gowork, []byte(`// Generated.
+
+go 1.18
+
+use ../a // Comment.
+use (
+	../b
+	"/abs/c"
+)
+`), 0666)
+
+	uses, err := goWorkUses(gowork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expt := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), "/abs/c"}
+	if !reflect.DeepEqual(uses, expt) {
+		t.Errorf("Bad uses %v, expected %v", uses, expt)
+	}
+}
+
+func TestInWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"a/pkg", "b", "gosrc"} {
+		os.MkdirAll(filepath.Join(dir, d), 0777)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a", "go.mod"), []byte("module a\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "b", "go.mod"), []byte("module b\n"), 0666)
+	gowork := filepath.Join(dir, "go.work")
+	ioutil.WriteFile(gowork, []byte("go 1.18\n\nuse (\n\t./a\n\t./b\n)\n"), 0666)
+
+	if !inWorkspace(gowork, filepath.Join(dir, "a/pkg")) {
+		t.Error("Package in module a not in workspace")
+	}
+	if !inWorkspace(gowork, filepath.Join(dir, "b")) {
+		t.Error("Module b not in workspace")
+	}
+	// Go sources of C descriptors, like in test/gosrc.
+	if inWorkspace(gowork, filepath.Join(dir, "gosrc")) {
+		t.Error("Directory without module in workspace")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "gosrc", "go.mod"), []byte("module gosrc\n"), 0666)
+	if inWorkspace(gowork, filepath.Join(dir, "gosrc")) {
+		t.Error("Module not in go.work in workspace")
+	}
+}
+
+// A merged profile with packages of two modules, built offline without a
+// workspace.
+func TestCoverHTMLModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gowork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, m := range []string{"a", "b"} {
+		os.MkdirAll(filepath.Join(dir, m), 0777)
+		ioutil.WriteFile(filepath.Join(dir, m, "go.mod"), []byte("module example.com/"+m+"\n\ngo 1.18\n"), 0666)
+		ioutil.WriteFile(filepath.Join(dir, m, m+".go"), []byte("package "+m+"\n\nfunc F() int {\n\treturn 1\n}\n"), 0666)
+	}
+	absin = filepath.Join(dir, "coverage.out")
+	absout = filepath.Join(dir, "coverage.html")
+	ioutil.WriteFile(absin, []byte(`mode: set
+example.com/a/a.go:3.14,5.2 1 1
+example.com/b/b.go:3.14,5.2 1 0
+`), 0666)
+
+	for _, e := range []struct{ name, value string }{{"GOWORK", "off"}, {"GOFLAGS", "-mod=vendor"}} {
+		old, ok := os.LookupEnv(e.name)
+		os.Setenv(e.name, e.value)
+		if ok {
+			defer os.Setenv(e.name, old)
+		} else {
+			defer os.Unsetenv(e.name)
+		}
+	}
+	*moddirs = filepath.Join(dir, "a") + " " + filepath.Join(dir, "b")
+	defer func() { *moddirs = "" }()
+
+	coverHTML()
+	html, err := ioutil.ReadFile(absout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"example.com/a/a.go", "example.com/b/b.go"} {
+		if !strings.Contains(string(html), f) {
+			t.Errorf("%s not in the report", f)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/testreport"
+)
+
+// runTests runs go test with -json to collect the results for the reports,
+// printing the output the way go test does without -json.
+func runTests(name string, args ...string) {
+	args = appendTestFlags(append(args, "-json"))
+	verbose := false
+	for _, arg := range args {
+		switch arg {
+		case "-v", "-v=true", "-test.v", "-test.v=true":
+			verbose = true
+		}
+	}
+	if *pkg != "" {
+		args = append(args, *pkg)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	p := newTestPrinter(os.Stdout, verbose)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var ev testreport.Event
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &ev) != nil {
+			// Not from test2json, e.g. output of go vet.
+			fmt.Printf("%s\n", line)
+			continue
+		}
+		p.add(&ev)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		io.Copy(os.Stdout, stdout)
+	}
+	err = cmd.Wait()
+
+	if absreport != "" {
+		if werr := writeReports(p.collector.Report()); werr != nil {
+			fmt.Fprintln(os.Stderr, werr)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type testPrinter struct {
+	w         io.Writer
+	collector *testreport.Collector
+	verbose   bool
+	// Output of the tests per package and test, until they finish. Only
+	// kept without -v.
+	tests map[string]*testOutput
+	// Top level tests per package that haven't finished. They're printed
+	// before the package result, e.g. the one that timed out.
+	running map[string][]string
+}
+
+// The output of a test the way go test prints it without -v, which is
+// chronological except that the result line comes first. Failed subtests
+// are put among the lines when they finish.
+type testOutput struct {
+	indent string
+	result string
+	items  []testOutputItem
+}
+
+type testOutputItem struct {
+	line string
+	sub  *testOutput
+}
+
+func newTestPrinter(w io.Writer, verbose bool) *testPrinter {
+	return &testPrinter{
+		w:         w,
+		collector: testreport.NewCollector(),
+		verbose:   verbose,
+		tests:     make(map[string]*testOutput),
+		running:   make(map[string][]string),
+	}
+}
+
+func (p *testPrinter) add(ev *testreport.Event) {
+	p.collector.Add(ev)
+	switch {
+	case ev.Action == "build-output":
+		fmt.Fprint(p.w, ev.Output)
+	case p.verbose:
+		if ev.Action == "output" {
+			fmt.Fprint(p.w, ev.Output)
+		}
+	case ev.Test == "":
+		if ev.Action == "output" && strings.HasPrefix(ev.Output, "FAIL\t") {
+			for _, test := range p.running[ev.Package] {
+				p.printUnfinished(ev.Package, test)
+			}
+			delete(p.running, ev.Package)
+		}
+		// Without -v, go test doesn't print the PASS line of the test
+		// binary.
+		if ev.Action == "output" && ev.Output != "PASS\n" {
+			fmt.Fprint(p.w, ev.Output)
+		}
+	default:
+		p.addTest(ev)
+	}
+}
+
+func (p *testPrinter) testOutput(pkg, test string) *testOutput {
+	key := pkg + " " + test
+	out := p.tests[key]
+	if out == nil {
+		out = &testOutput{indent: strings.Repeat("    ", strings.Count(test, "/"))}
+		p.tests[key] = out
+	}
+	return out
+}
+
+func (p *testPrinter) addTest(ev *testreport.Event) {
+	out := p.testOutput(ev.Package, ev.Test)
+	parent := ""
+	if i := strings.LastIndexByte(ev.Test, '/'); i >= 0 {
+		parent = ev.Test[:i]
+	}
+	switch ev.Action {
+	case "run":
+		if parent == "" {
+			p.running[ev.Package] = append(p.running[ev.Package], ev.Test)
+		}
+	case "output":
+		switch {
+		case strings.HasPrefix(ev.Output, "=== "):
+			// Only printed with -v.
+		case out.result == "" && strings.HasPrefix(ev.Output, "--- ") && strings.Contains(ev.Output, " "+ev.Test+" "):
+			out.result = ev.Output
+		default:
+			out.items = append(out.items, testOutputItem{line: ev.Output})
+		}
+	case "pass", "fail", "skip":
+		delete(p.tests, ev.Package+" "+ev.Test)
+		if parent != "" {
+			if ev.Action == "fail" {
+				pout := p.testOutput(ev.Package, parent)
+				pout.items = append(pout.items, testOutputItem{sub: out})
+			}
+			return
+		}
+		running := p.running[ev.Package]
+		for i, t := range running {
+			if t == ev.Test {
+				p.running[ev.Package] = append(running[:i:i], running[i+1:]...)
+				break
+			}
+		}
+		if ev.Action == "fail" {
+			p.print(out)
+		}
+	}
+}
+
+// Prints a test that didn't finish and its unfinished subtests, which is
+// where a timeout panic is written.
+func (p *testPrinter) printUnfinished(pkg, test string) {
+	p.print(p.testOutput(pkg, test))
+	var subs []string
+	for key := range p.tests {
+		if strings.HasPrefix(key, pkg+" "+test+"/") {
+			subs = append(subs, key)
+		}
+	}
+	sort.Strings(subs)
+	for _, key := range subs {
+		p.print(p.tests[key])
+		delete(p.tests, key)
+	}
+	delete(p.tests, pkg+" "+test)
+}
+
+func (p *testPrinter) print(out *testOutput) {
+	if out.result != "" {
+		fmt.Fprint(p.w, out.indent, out.result)
+	}
+	for _, item := range out.items {
+		if item.sub != nil {
+			p.print(item.sub)
+		} else {
+			fmt.Fprint(p.w, out.indent, item.line)
+		}
+	}
+}
+
+func writeReports(rep *testreport.Report) error {
+	for _, w := range []struct {
+		suffix string
+		write  func(io.Writer) error
+	}{
+		{".xml", rep.WriteJUnit},
+		{".json", rep.WriteJSON},
+	} {
+		f, err := os.Create(absreport + w.suffix)
+		if err != nil {
+			return err
+		}
+		err = w.write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/testreport"
+)
+
+// Recorded go test -json streams, with the output of go test without -json
+// for the same packages in the .txt files.
+const testreportData = "../../pkg/testreport/testdata"
+
+// Timings and addresses differ between the runs.
+var volatileRe = regexp.MustCompile(`[0-9]+\.[0-9]+s|0x[0-9a-f]+`)
+
+func printRecorded(t *testing.T, name string, verbose bool) string {
+	f, err := os.Open(filepath.Join(testreportData, name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	p := newTestPrinter(&buf, verbose)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev testreport.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		p.add(&ev)
+	}
+	return buf.String()
+}
+
+func TestTestPrinter(t *testing.T) {
+	for _, name := range []string{"ok", "skip", "fail", "broken", "slow"} {
+		expt, err := ioutil.ReadFile(filepath.Join(testreportData, name+".txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// go test prints a final FAIL line after all the packages.
+		exptStr := strings.TrimSuffix(string(expt), "FAIL\n")
+		got := printRecorded(t, name, false)
+		if volatileRe.ReplaceAllString(got, "X") != volatileRe.ReplaceAllString(exptStr, "X") {
+			t.Errorf("Bad output for %s, got:\n%s\nexpected:\n%s", name, got, exptStr)
+		}
+	}
+}
+
+func TestTestPrinterVerbose(t *testing.T) {
+	got := printRecorded(t, "fail", true)
+	if !strings.HasPrefix(got, "=== RUN   TestPass\n--- PASS: TestPass ") {
+		t.Errorf("Bad verbose output:\n%s", got)
+	}
+	if !strings.Contains(got, "fail_test.go:9: b failed\n--- FAIL: TestSub/b ") {
+		t.Errorf("Verbose output not as printed by the test:\n%s", got)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Schibsted
+
+package gobuild
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type vetDiagnostic struct {
+	Posn    string `json:"posn"`
+	Message string `json:"message"`
+}
+
+// Keyed by package and analyzer.
+type vetOutput map[string]map[string][]vetDiagnostic
+
+// runVet runs go vet on the package and writes a report per diagnostic to
+// the output directory, in the format of the clang analyser reports so that
+// the analyse target of the flavor includes them. Diagnostics don't fail the
+// build, just like the analyser reports don't.
+func runVet() {
+	os.RemoveAll(absout)
+	if err := os.MkdirAll(absout, 0777); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	args := appendGoFlags([]string{"vet", "-json"})
+	if *pkg != "" {
+		args = append(args, *pkg)
+	}
+	// Depending on the Go version the JSON is written to stdout or stderr.
+	var buf bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		os.Stderr.Write(buf.Bytes())
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	n, err := writeVetReports(&buf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if n > 0 {
+		fmt.Printf("go vet: %d reports in %s\n", n, outpath)
+	}
+}
+
+// Parses the go vet -json output, JSON objects mixed with comment lines
+// naming the packages.
+func parseVetOutput(r io.Reader) ([]vetOutput, error) {
+	var js bytes.Buffer
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if !strings.HasPrefix(s.Text(), "#") {
+			js.Write(s.Bytes())
+			js.WriteByte('\n')
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	var ret []vetOutput
+	dec := json.NewDecoder(&js)
+	for {
+		var out vetOutput
+		if err := dec.Decode(&out); err == io.EOF {
+			return ret, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ret = append(ret, out)
+	}
+}
+
+func writeVetReports(r io.Reader) (int, error) {
+	outs, err := parseVetOutput(r)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, out := range outs {
+		for _, analyzers := range out {
+			var names []string
+			for a := range analyzers {
+				names = append(names, a)
+			}
+			sort.Strings(names)
+			for _, a := range names {
+				for _, diag := range analyzers[a] {
+					n++
+					fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", diag.Posn, diag.Message, a)
+					if err := writeVetReport(a, diag); err != nil {
+						return n, err
+					}
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+// Writes the comments read by copy-analyse -finalize. The file is named
+// like the analyser ones, the source path with / replaced by - and a suffix
+// without -. The suffix is the position and analyzer, so the same report from
+// another descriptor vetting the package replaces this one.
+func writeVetReport(analyzer string, diag vetDiagnostic) error {
+	file, line, col := diag.Posn, "", ""
+	if parts := strings.SplitN(diag.Posn, ":", 3); len(parts) == 3 {
+		file, line, col = parts[0], parts[1], parts[2]
+	}
+	if rel, err := filepath.Rel(topdir, file); err == nil && !strings.HasPrefix(rel, "../") {
+		file = rel
+	}
+	comment := strings.NewReplacer("--", "- -", "\n", " ")
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<html><head><title>%s</title></head>\n<body>\n", html.EscapeString(file))
+	fmt.Fprintf(&buf, "<!-- BUGFILE %s -->\n", comment.Replace(file))
+	fmt.Fprintf(&buf, "<!-- BUGLINE %s -->\n", line)
+	fmt.Fprintf(&buf, "<!-- BUGDESC %s -->\n", comment.Replace(diag.Message))
+	fmt.Fprintf(&buf, "<!-- BUGTYPE %s -->\n", analyzer)
+	fmt.Fprintf(&buf, "<!-- BUGCATEGORY go vet -->\n")
+	fmt.Fprintf(&buf, "<p id=\"EndPath\">%s: %s</p>\n</body>\n</html>\n", html.EscapeString(diag.Posn), html.EscapeString(diag.Message))
+	name := fmt.Sprintf("%s-%s.%s.%s.html", strings.ReplaceAll(file, "/", "-"), line, col, analyzer)
+	return ioutil.WriteFile(filepath.Join(absout, name), buf.Bytes(), 0666)
+}
@@ -0,0 +1,238 @@
+// Copyright 2026 Schibsted
+
+// Package gocover_merge merges Go coverage profiles, such as the ones
+// written by the GOTEST descriptors, and summarizes the coverage per package.
+//
+// Blocks found in several profiles, e.g. when using coverpkg, are merged by
+// adding their counts, or in set mode by keeping them covered if covered in
+// any profile.
+package gocover_merge
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	flagset = flag.NewFlagSet("gocover-merge", flag.ExitOnError)
+	outpath = flagset.String("o", "", "Write the merged profile to this file.")
+	jsonOut = flagset.String("json", "", "Write a JSON summary to this file.")
+	textOut = flagset.String("text", "", "Write a text summary to this file, - for stdout.")
+	minimum = flagset.Float64("min", 0, "Fail if less than this percentage of the statements are covered.")
+)
+
+type block struct {
+	stmts int
+	count int64
+}
+
+type profile struct {
+	mode   string
+	blocks map[string]*block // Keyed by file:startline.col,endline.col.
+}
+
+type Coverage struct {
+	Package    string  `json:"package,omitempty"`
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+	Percent    float64 `json:"percent"`
+}
+
+type Summary struct {
+	Total    Coverage   `json:"total"`
+	Packages []Coverage `json:"packages"`
+}
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool gocover-merge [options] <profile>...\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() == 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	prof := &profile{blocks: make(map[string]*block)}
+	for _, file := range flagset.Args() {
+		if err := prof.read(file); err != nil {
+			fmt.Fprintf(os.Stderr, "gocover-merge: %s: %s\n", file, err)
+			os.Exit(1)
+		}
+	}
+	sum := prof.summary()
+	if err := writeOutputs(prof, sum); err != nil {
+		fmt.Fprintf(os.Stderr, "gocover-merge: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("coverage: %.1f%% of statements\n", sum.Total.Percent)
+	if *minimum > 0 && sum.Total.Percent < *minimum {
+		fmt.Fprintf(os.Stderr, "gocover-merge: coverage %.1f%% is below the minimum of %g%%\n", sum.Total.Percent, *minimum)
+		os.Exit(1)
+	}
+}
+
+func (p *profile) read(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 {
+			mode := strings.TrimPrefix(line, "mode: ")
+			if mode == line {
+				return fmt.Errorf("missing mode line")
+			}
+			if p.mode != "" && p.mode != mode {
+				return fmt.Errorf("mode %s differs from %s in the other profiles", mode, p.mode)
+			}
+			p.mode = mode
+			continue
+		}
+		// file:startline.col,endline.col numstmts count
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("line %d: bad block %q", n, line)
+		}
+		stmts, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("line %d: bad block %q", n, line)
+		}
+		b := p.blocks[fields[0]]
+		if b == nil {
+			p.blocks[fields[0]] = &block{stmts, count}
+			continue
+		}
+		if p.mode == "set" {
+			if count > 0 {
+				b.count = 1
+			}
+		} else {
+			b.count += count
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if p.mode == "" {
+		return fmt.Errorf("empty profile")
+	}
+	return nil
+}
+
+func (p *profile) write(w io.Writer) error {
+	keys := make([]string, 0, len(p.blocks))
+	for k := range p.blocks {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", p.mode)
+	for _, k := range keys {
+		fmt.Fprintf(bw, "%s %d %d\n", k, p.blocks[k].stmts, p.blocks[k].count)
+	}
+	return bw.Flush()
+}
+
+func percent(covered, stmts int) float64 {
+	if stmts == 0 {
+		return 100
+	}
+	// Round down to a tenth, so that the minimum isn't passed by rounding.
+	return math.Floor(float64(covered)*1000/float64(stmts)) / 10
+}
+
+func (p *profile) summary() *Summary {
+	pkgs := make(map[string]*Coverage)
+	sum := &Summary{}
+	for k, b := range p.blocks {
+		file := k
+		if i := strings.LastIndexByte(k, ':'); i >= 0 {
+			file = k[:i]
+		}
+		pkg := path.Dir(file)
+		c := pkgs[pkg]
+		if c == nil {
+			c = &Coverage{Package: pkg}
+			pkgs[pkg] = c
+		}
+		c.Statements += b.stmts
+		sum.Total.Statements += b.stmts
+		if b.count > 0 {
+			c.Covered += b.stmts
+			sum.Total.Covered += b.stmts
+		}
+	}
+	for _, c := range pkgs {
+		c.Percent = percent(c.Covered, c.Statements)
+		sum.Packages = append(sum.Packages, *c)
+	}
+	sort.Slice(sum.Packages, func(i, j int) bool {
+		return sum.Packages[i].Package < sum.Packages[j].Package
+	})
+	sum.Total.Percent = percent(sum.Total.Covered, sum.Total.Statements)
+	return sum
+}
+
+func writeText(w io.Writer, sum *Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, c := range sum.Packages {
+		fmt.Fprintf(tw, "%s\t%d/%d\t%.1f%%\t\n", c.Package, c.Covered, c.Statements, c.Percent)
+	}
+	fmt.Fprintf(tw, "total\t%d/%d\t%.1f%%\t\n", sum.Total.Covered, sum.Total.Statements, sum.Total.Percent)
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, sum *Summary) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(sum)
+}
+
+func writeOutputs(prof *profile, sum *Summary) error {
+	for _, out := range []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{*outpath, prof.write},
+		{*jsonOut, func(w io.Writer) error { return writeJSON(w, sum) }},
+		{*textOut, func(w io.Writer) error { return writeText(w, sum) }},
+	} {
+		switch out.path {
+		case "":
+			continue
+		case "-":
+			if err := out.write(os.Stdout); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Create(out.path)
+		if err != nil {
+			return err
+		}
+		err = out.write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 Schibsted
+
+package gocover_merge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readProfiles(t *testing.T, profiles ...string) (*profile, error) {
+	dir, err := ioutil.TempDir("", "gocover-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prof := &profile{blocks: make(map[string]*block)}
+	for i, p := range profiles {
+		file := filepath.Join(dir, string(rune('a'+i))+".out")
+		if err := ioutil.WriteFile(file, []byte(p), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := prof.read(file); err != nil {
+			return prof, err
+		}
+	}
+	return prof, nil
+}
+
+func TestMergeSet(t *testing.T) {
+	prof, err := readProfiles(t, `mode: set
+example.com/a/a.go:3.14,5.2 2 1
+example.com/a/a.go:7.14,9.2 1 0
+example.com/b/b.go:3.14,5.2 3 0
+`, `mode: set
+example.com/a/a.go:3.14,5.2 2 0
+example.com/a/a.go:7.14,9.2 1 1
+example.com/b/b.go:3.14,5.2 3 0
+example.com/b/b.go:7.14,8.2 1 1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := prof.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expt := `mode: set
+example.com/a/a.go:3.14,5.2 2 1
+example.com/a/a.go:7.14,9.2 1 1
+example.com/b/b.go:3.14,5.2 3 0
+example.com/b/b.go:7.14,8.2 1 1
+`
+	if buf.String() != expt {
+		t.Errorf("Bad merged profile:\n%s", buf.String())
+	}
+
+	sum := prof.summary()
+	exptsum := &Summary{
+		Total: Coverage{Statements: 7, Covered: 4, Percent: 57.1},
+		Packages: []Coverage{
+			{Package: "example.com/a", Statements: 3, Covered: 3, Percent: 100},
+			{Package: "example.com/b", Statements: 4, Covered: 1, Percent: 25},
+		},
+	}
+	if !reflect.DeepEqual(sum, exptsum) {
+		t.Errorf("Bad summary %+v", sum)
+	}
+}
+
+func TestMergeCount(t *testing.T) {
+	prof, err := readProfiles(t, `mode: count
+example.com/a/a.go:3.14,5.2 2 3
+example.com/a/a.go:7.14,9.2 1 0
+`, `mode: count
+example.com/a/a.go:3.14,5.2 2 4
+example.com/a/a.go:7.14,9.2 1 0
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := prof.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expt := `mode: count
+example.com/a/a.go:3.14,5.2 2 7
+example.com/a/a.go:7.14,9.2 1 0
+`
+	if buf.String() != expt {
+		t.Errorf("Bad merged profile:\n%s", buf.String())
+	}
+}
+
+func TestMergeModeMismatch(t *testing.T) {
+	_, err := readProfiles(t, "mode: set\n", "mode: count\n")
+	if err == nil || err.Error() != "mode count differs from set in the other profiles" {
+		t.Errorf("Expected mode error, got %v", err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for _, tc := range []struct {
+		covered, stmts int
+		expt           float64
+	}{
+		{0, 0, 100},
+		{1, 3, 33.3},
+		// Rounded down, 66.67 doesn't pass -min=66.7.
+		{2, 3, 66.6},
+		{999, 1000, 99.9},
+		{9999, 10000, 99.9},
+		{7, 10, 70},
+		{10, 10, 100},
+	} {
+		if p := percent(tc.covered, tc.stmts); p != tc.expt {
+			t.Errorf("percent(%d, %d) = %g, expected %g", tc.covered, tc.stmts, p, tc.expt)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2026 Schibsted
+
+// Package pgo_merge merges profile data from PGO training runs into a
+// profile usable by another flavor.
+//
+// For clang the raw profiles are merged with llvm-profdata. For gcc there's
+// one gcda file per object, named from the mangled object path. They're
+// copied with the flavor part of the name replaced, since the objects in the
+// consuming flavor live in another directory.
+package pgo_merge
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	flagset  = flag.NewFlagSet("pgo-merge", flag.ExitOnError)
+	compiler = flagset.String("compiler", "gcc", "Compiler flavor used, gcc or clang.")
+	profdata = flagset.String("profdata", "llvm-profdata", "The llvm-profdata binary to use with clang.")
+	from     = flagset.String("from", "", "Flavor the training was done in.")
+	to       = flagset.String("to", "", "Flavor the profile is used in.")
+)
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool pgo-merge [options] <datadir> <out>\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() != 2 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	datadir := flagset.Arg(0)
+	out := flagset.Arg(1)
+
+	var err error
+	switch *compiler {
+	case "clang":
+		err = mergeClang(datadir, out)
+	case "gcc":
+		err = copyGcda(datadir, out)
+	default:
+		err = fmt.Errorf("unknown compiler %q", *compiler)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Remove(out)
+		os.Exit(1)
+	}
+}
+
+func mergeClang(datadir, out string) error {
+	raws, err := filepath.Glob(filepath.Join(datadir, "*.profraw"))
+	if err != nil {
+		return err
+	}
+	if len(raws) == 0 {
+		return fmt.Errorf("no profile data found in %s, did the training run?", datadir)
+	}
+	cmd := exec.Command(*profdata, append([]string{"merge", "-output=" + out}, raws...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func copyGcda(datadir, stamp string) error {
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from and -to are required for gcc")
+	}
+	outdir := filepath.Dir(stamp)
+	os.RemoveAll(outdir)
+	if err := os.MkdirAll(outdir, 0777); err != nil {
+		return err
+	}
+	gcdas, err := filepath.Glob(filepath.Join(datadir, "*.gcda"))
+	if err != nil {
+		return err
+	}
+	if len(gcdas) == 0 {
+		return fmt.Errorf("no profile data found in %s, did the training run?", datadir)
+	}
+	// gcc mangles the object path by replacing / with #.
+	fromdir := "#obj#" + *from + "#"
+	todir := "#obj#" + *to + "#"
+	for _, gcda := range gcdas {
+		data, err := ioutil.ReadFile(gcda)
+		if err != nil {
+			return err
+		}
+		name := strings.Replace(filepath.Base(gcda), fromdir, todir, 1)
+		if err := ioutil.WriteFile(filepath.Join(outdir, name), data, 0666); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(stamp, nil, 0666)
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 Schibsted
+
+package pgo_merge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pgo-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCopyGcda(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func() {
+		*from = ""
+		*to = ""
+	}()
+	*from = "pgogen"
+	*to = "release"
+
+	datadir := filepath.Join(dir, "pgodata")
+	os.MkdirAll(datadir, 0777)
+	for name, data := range map[string]string{
+		"#build#obj#pgogen#lib#a.o.gcda":        "a",
+		"#build#obj#pgogen#bin#main.o.gcda":     "main",
+		"#build#obj#pgogen#x#obj#pgogen#y.gcda": "nested",
+		"#build#obj#other#b.o.gcda":             "other",
+		"notes.gcno":                            "",
+	} {
+		ioutil.WriteFile(filepath.Join(datadir, name), []byte(data), 0666)
+	}
+	outdir := filepath.Join(dir, "profile")
+	os.MkdirAll(outdir, 0777)
+	ioutil.WriteFile(filepath.Join(outdir, "#build#obj#release#stale.o.gcda"), nil, 0666)
+
+	stamp := filepath.Join(outdir, "stamp")
+	if err := copyGcda(datadir, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stamp); err != nil {
+		t.Error("Stamp not written")
+	}
+
+	expt := map[string]string{
+		"#build#obj#release#lib#a.o.gcda":        "a",
+		"#build#obj#release#bin#main.o.gcda":     "main",
+		"#build#obj#release#x#obj#pgogen#y.gcda": "nested",
+		"#build#obj#other#b.o.gcda":              "other",
+	}
+	gcdas, _ := filepath.Glob(filepath.Join(outdir, "*.gcda"))
+	var names, exptNames []string
+	for _, gcda := range gcdas {
+		names = append(names, filepath.Base(gcda))
+	}
+	for name, data := range expt {
+		exptNames = append(exptNames, name)
+		if d, err := ioutil.ReadFile(filepath.Join(outdir, name)); err != nil || string(d) != data {
+			t.Errorf("Bad %s %q, %v", name, d, err)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(exptNames)
+	if !reflect.DeepEqual(names, exptNames) {
+		t.Errorf("Bad profile files %q, expected %q", names, exptNames)
+	}
+}
+
+func TestCopyGcdaErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func() {
+		*from = ""
+		*to = ""
+	}()
+	stamp := filepath.Join(dir, "profile/stamp")
+
+	if err := copyGcda(dir, stamp); err == nil {
+		t.Error("Expected an error without -from and -to")
+	}
+	*from = "pgogen"
+	*to = "release"
+	if err := copyGcda(dir, stamp); err == nil {
+		t.Error("Expected an error without profile data")
+	}
+}
+
+func TestMergeClang(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer func() { *profdata = "llvm-profdata" }()
+
+	// A fake llvm-profdata recording its arguments.
+	*profdata = filepath.Join(dir, "profdata")
+	ioutil.WriteFile(*profdata, []byte("#!/bin/sh\necho \"$@\" > "+filepath.Join(dir, "args")+"\n"), 0777)
+
+	datadir := filepath.Join(dir, "pgodata")
+	os.MkdirAll(datadir, 0777)
+	out := filepath.Join(dir, "default.profdata")
+	if err := mergeClang(datadir, out); err == nil {
+		t.Error("Expected an error without profile data")
+	}
+
+	for _, name := range []string{"1.profraw", "2.profraw", "notes.txt"} {
+		ioutil.WriteFile(filepath.Join(datadir, name), nil, 0666)
+	}
+	if err := mergeClang(datadir, out); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+	expt := "merge -output=" + out + " " + filepath.Join(datadir, "1.profraw") + " " + filepath.Join(datadir, "2.profraw") + "\n"
+	if string(args) != expt {
+		t.Errorf("Bad llvm-profdata arguments %q, expected %q", args, expt)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2026 Schibsted
+
+// Package repro_check builds a flavor twice in separate build paths and
+// compares the installed files, to verify that the build is reproducible.
+//
+// The caches are disabled for the builds, since a cache hit would copy the
+// first result. For each differing file a likely reason is given, based on
+// the contents around the first difference.
+package repro_check
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	flagset = flag.NewFlagSet("repro-check", flag.ExitOnError)
+	dir     = flagset.String("dir", "", "Directory to put the build paths in. A temporary one is used and removed if not set.")
+)
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool repro-check [options] <flavor>\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() != 1 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	os.Exit(check(flagset.Arg(0)))
+}
+
+func check(flavor string) int {
+	base := *dir
+	if base == "" {
+		var err error
+		base, err = ioutil.TempDir("", "seb-repro")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer os.RemoveAll(base)
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var bps []string
+	for i, name := range []string{"a", "b"} {
+		if i > 0 {
+			// Make sure embedded times differ.
+			time.Sleep(time.Second)
+		}
+		bp := filepath.Join(base, name)
+		if err := build(bp, flavor); err != nil {
+			fmt.Fprintf(os.Stderr, "repro-check: build in %s failed: %s\n", bp, err)
+			return 1
+		}
+		bps = append(bps, bp)
+	}
+
+	diffs, total, err := compare(filepath.Join(bps[0], flavor), filepath.Join(bps[1], flavor), bps[0], bps[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "repro-check: %s\n", err)
+		return 1
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("%d of %d installed files differ\n", len(diffs), total)
+		return 1
+	}
+	fmt.Printf("All %d installed files are identical\n", total)
+	return 0
+}
+
+func build(bp, flavor string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "-quiet", "-buildpath="+bp, "-with-flavor="+flavor, flavor)
+	cmd.Env = append(os.Environ(), "SEB_CACHE_DISABLE=1", "CCACHE_DISABLE=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Compares the files in the two directories, returning a line per
+// difference and the total number of files.
+func compare(a, b, bpa, bpb string) ([]string, int, error) {
+	filesA, err := listFiles(a)
+	if err != nil {
+		return nil, 0, err
+	}
+	filesB, err := listFiles(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	names := make(map[string]bool)
+	for n := range filesA {
+		names[n] = true
+	}
+	for n := range filesB {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	var diffs []string
+	for _, n := range sorted {
+		fa, fb := filesA[n], filesB[n]
+		switch {
+		case fa == nil:
+			diffs = append(diffs, fmt.Sprintf("%s: only in second build", n))
+		case fb == nil:
+			diffs = append(diffs, fmt.Sprintf("%s: only in first build", n))
+		case fa.Mode() != fb.Mode():
+			diffs = append(diffs, fmt.Sprintf("%s: file mode differs, %s and %s", n, fa.Mode(), fb.Mode()))
+		case fa.Mode()&os.ModeSymlink != 0:
+			la, _ := os.Readlink(filepath.Join(a, n))
+			lb, _ := os.Readlink(filepath.Join(b, n))
+			if la != lb {
+				diffs = append(diffs, fmt.Sprintf("%s: symlink target differs, %s and %s", n, la, lb))
+			}
+		default:
+			da, err := ioutil.ReadFile(filepath.Join(a, n))
+			if err != nil {
+				return nil, 0, err
+			}
+			db, err := ioutil.ReadFile(filepath.Join(b, n))
+			if err != nil {
+				return nil, 0, err
+			}
+			if !bytes.Equal(da, db) {
+				diffs = append(diffs, fmt.Sprintf("%s: %s", n, diffReason(da, db, bpa, bpb)))
+			}
+		}
+	}
+	return diffs, len(sorted), nil
+}
+
+func listFiles(root string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files[rel] = info
+		return err
+	})
+	return files, err
+}
+
+var timeRe = regexp.MustCompile(`\d\d:\d\d:\d\d|\d{4}-\d\d-\d\d|(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ \d]\d \d{4}`)
+
+// Guesses why the contents differ.
+func diffReason(a, b []byte, bpa, bpb string) string {
+	if bytes.Contains(a, []byte(bpa)) || bytes.Contains(b, []byte(bpb)) {
+		return "contains the build path"
+	}
+
+	off := 0
+	for off < len(a) && off < len(b) && a[off] == b[off] {
+		off++
+	}
+	window := func(data []byte) []byte {
+		start, end := off-24, off+24
+		if start < 0 {
+			start = 0
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		return data[start:end]
+	}
+	// Unix times from the last day or so share the first digits with now.
+	epoch := regexp.MustCompile(strconv.FormatInt(time.Now().Unix(), 10)[:5] + `\d{5}`)
+	for _, w := range [][]byte{window(a), window(b)} {
+		if timeRe.Match(w) || epoch.Match(w) {
+			return fmt.Sprintf("contains a timestamp at offset %d", off)
+		}
+	}
+
+	if len(a) == len(b) {
+		sa := append([]byte(nil), a...)
+		sb := append([]byte(nil), b...)
+		sort.Slice(sa, func(i, j int) bool { return sa[i] < sa[j] })
+		sort.Slice(sb, func(i, j int) bool { return sb[i] < sb[j] })
+		if bytes.Equal(sa, sb) {
+			return fmt.Sprintf("same contents in a different order from offset %d", off)
+		}
+	}
+	return fmt.Sprintf("contents differ from offset %d, sizes %d and %d", off, len(a), len(b))
+}
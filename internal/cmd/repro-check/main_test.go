@@ -0,0 +1,50 @@
+// Copyright 2026 Schibsted
+
+package repro_check
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	diffs, total, err := compare("testdata/a", "testdata/b", "/tmp/repro/a", "/tmp/repro/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expt := []string{
+		"data.txt: contents differ from offset 12, sizes 14 and 15",
+		"onlya.txt: only in first build",
+		"onlyb.txt: only in second build",
+		"order.txt: same contents in a different order from offset 0",
+		"path.txt: contains the build path",
+		"stamp.txt: contains a timestamp at offset 15",
+	}
+	if !reflect.DeepEqual(diffs, expt) {
+		t.Errorf("Bad diffs %q", diffs)
+	}
+	if total != 7 {
+		t.Errorf("Bad total %d", total)
+	}
+}
+
+func TestDiffReason(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, tc := range []struct {
+		a, b, expt string
+	}{
+		{"in /tmp/repro/a/src", "in /tmp/repro/b/src", "contains the build path"},
+		{"built at 10:11:12 ok", "built at 10:11:13 ok", "contains a timestamp at offset 16"},
+		{"built Jan  2 2024", "built Jan  3 2024", "contains a timestamp at offset 11"},
+		{"t=" + now + " a", "t=" + now + " b", "contains a timestamp at offset 13"},
+		{"xab", "xba", "same contents in a different order from offset 1"},
+		{"abc", "abd", "contents differ from offset 2, sizes 3 and 3"},
+		{"abc", "abcd", "contents differ from offset 3, sizes 3 and 4"},
+	} {
+		if r := diffReason([]byte(tc.a), []byte(tc.b), "/tmp/repro/a", "/tmp/repro/b"); r != tc.expt {
+			t.Errorf("diffReason(%q, %q) = %q, expected %q", tc.a, tc.b, r, tc.expt)
+		}
+	}
+}
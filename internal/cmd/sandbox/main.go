@@ -0,0 +1,416 @@
+// Copyright 2026 Schibsted
+
+// Package sandbox runs a build command with only its declared inputs
+// visible, to catch rules reading files they don't depend on.
+//
+// Ninja rules opt in by prefixing their command with $sandbox, which is set
+// per build edge in sandboxed flavors. The command is run in new user and
+// mount namespaces, chrooted to a tree containing the toolchain read-only,
+// the declared inputs and the files listed in the previous depfile
+// read-only, and an empty build directory where the outputs are written.
+// The outputs are copied to the real build directory afterwards.
+//
+// Rules writing a depfile only see the headers listed in the previous one.
+// If there's none yet, the whole source tree is visible and a warning is
+// printed, since the headers aren't known until the command has run.
+//
+// If the command fails in the sandbox with an error about a missing file
+// but succeeds outside it, it's reported as a violation, with the undeclared
+// path if it can be found. Other failures are reported as is. For
+// rules writing a depfile, the command is first retried in the sandbox with
+// the depfile written outside it, so that adding an include isn't a
+// violation.
+package sandbox
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/depfile"
+)
+
+var (
+	flagset   = flag.NewFlagSet("sandbox", flag.ExitOnError)
+	builddesc = flagset.String("builddesc", "", "Builddesc defining the target, used when reporting violations.")
+	buildpath = flagset.String("buildpath", "build", "Build directory, hidden except for the inputs and outputs.")
+	inputs    = flagset.String("in", "", "Space separated list of declared inputs.")
+	outputs   = flagset.String("out", "", "Space separated list of outputs.")
+	depfileF  = flagset.String("depfile", "", "Depfile written by the command, listing additional inputs.")
+	inside    = flagset.Bool("inside", false, "Internal, set when running inside the namespaces.")
+)
+
+// Directories that are always visible read-only.
+var toolchainDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt"}
+
+type spec struct {
+	Root      string
+	Stage     string
+	Cwd       string
+	Buildpath string
+	RO        []string // Absolute paths outside the build directory.
+	RW        []string // Absolute paths outside the build directory.
+	Inputs    []string // Absolute paths in the build directory.
+	Argv      []string
+
+	sourceTree bool // No depfile yet, so the source tree is visible.
+}
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool sandbox [options] [--] command [args...]\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if *inside {
+		runInside()
+	}
+	if flagset.NArg() < 1 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	argv := flagset.Args()
+
+	sp, err := newSpec(argv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %s\n", err)
+		os.Exit(1)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code, err := sp.run(&stdout, &stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %s\n", err)
+		os.RemoveAll(filepath.Dir(sp.Root))
+		os.Exit(1)
+	}
+	// Other failures, like compile errors, aren't checked by running the
+	// command again outside the sandbox.
+	if code == 0 || !missingFileError(stderr.String()) {
+		if code == 0 {
+			err = sp.copyOutputs()
+		}
+		os.Stdout.Write(stdout.Bytes())
+		os.Stderr.Write(stderr.Bytes())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: %s\n", err)
+			code = 1
+		}
+		os.RemoveAll(filepath.Dir(sp.Root))
+		os.Exit(code)
+	}
+
+	// Check if it was the sandbox causing the failure.
+	var rout bytes.Buffer
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdout = &rout
+	cmd.Stderr = &rout
+	rerr := cmd.Run()
+	os.RemoveAll(filepath.Dir(sp.Root))
+	if rerr != nil {
+		os.Stdout.Write(rout.Bytes())
+		if exit, ok := rerr.(*exec.ExitError); ok {
+			os.Exit(exit.ExitCode())
+		}
+		fmt.Fprintf(os.Stderr, "Failed to run %s: %s\n", argv[0], rerr)
+		os.Exit(1)
+	}
+	if *depfileF != "" && !sp.sourceTree {
+		// The outputs were written by the run outside the sandbox, only
+		// check if the new depfile explains the failure.
+		sp, err = newSpec(argv)
+		if err == nil {
+			stderr.Reset()
+			code, err = sp.run(ioutil.Discard, &stderr)
+			os.RemoveAll(filepath.Dir(sp.Root))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: %s\n", err)
+			os.Exit(1)
+		}
+		if code == 0 {
+			os.Stdout.Write(rout.Bytes())
+			os.Exit(0)
+		}
+	}
+	if p := sp.findUndeclared(stderr.String()); p != "" {
+		fmt.Fprintf(os.Stderr, "sandbox: %s (%s) read undeclared %s\n", *outputs, *builddesc, p)
+	} else {
+		fmt.Fprintf(os.Stderr, "sandbox: %s (%s) failed in sandbox but not outside it, probably reading an undeclared input:\n", *outputs, *builddesc)
+		os.Stderr.Write(stderr.Bytes())
+	}
+	os.Exit(1)
+}
+
+// Messages of tools failing to find or open a file, in lower case.
+var missingFileMessages = []string{
+	"no such file or directory",
+	"file not found",
+	"cannot find",
+	"can't find",
+	"cannot open",
+	"can't open",
+	"could not open",
+	"unable to open",
+	"does not exist",
+	"not found",
+	"permission denied",
+}
+
+// Returns true if the output looks like the command failed to find a file,
+// i.e. the failure might be caused by the sandbox.
+func missingFileError(output string) bool {
+	output = strings.ToLower(output)
+	for _, m := range missingFileMessages {
+		if strings.Contains(output, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSpec(argv []string) (*spec, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir("", "seb-sandbox")
+	if err != nil {
+		return nil, err
+	}
+	sp := &spec{
+		Root:      filepath.Join(tmp, "root"),
+		Stage:     filepath.Join(tmp, "stage"),
+		Cwd:       cwd,
+		Buildpath: absPath(cwd, *buildpath),
+		Argv:      argv,
+	}
+	if err := os.Mkdir(sp.Root, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Mkdir(sp.Stage, 0700); err != nil {
+		return nil, err
+	}
+
+	for _, d := range toolchainDirs {
+		sp.addRO(d)
+	}
+	for i, a := range argv {
+		if i == 0 || (a != "" && !strings.ContainsAny(a[:1], "-@$") && !strings.ContainsAny(a, "/=.")) {
+			if bin, err := exec.LookPath(a); err == nil {
+				sp.addRO(filepath.Dir(absPath(cwd, bin)))
+				if real, err := filepath.EvalSymlinks(bin); err == nil {
+					sp.addRO(filepath.Dir(absPath(cwd, real)))
+				}
+			}
+		}
+		for _, pfx := range []string{"-I", "-L", "-B", "-isystem", "--sysroot="} {
+			if strings.HasPrefix(a, pfx+"/") {
+				a = a[len(pfx):]
+				break
+			}
+		}
+		if strings.HasPrefix(a, "/") {
+			sp.addRO(a)
+		}
+	}
+	// Let compiler launchers like ccache keep their cache.
+	for _, d := range []string{os.Getenv("CCACHE_DIR"), os.Getenv("SCCACHE_DIR"), os.Getenv("XDG_CACHE_HOME")} {
+		sp.addRW(d)
+	}
+	if home := os.Getenv("HOME"); home != "" && os.Getenv("XDG_CACHE_HOME") == "" {
+		sp.addRW(filepath.Join(home, ".cache"))
+	}
+
+	ins := strings.Fields(*inputs)
+	for _, a := range argv {
+		if strings.HasPrefix(a, "@") {
+			ins = append(ins, a[1:])
+			if data, err := ioutil.ReadFile(absPath(cwd, a[1:])); err == nil {
+				ins = append(ins, strings.Fields(string(data))...)
+			}
+		}
+	}
+	if *depfileF != "" {
+		if data, err := ioutil.ReadFile(absPath(cwd, *depfileF)); err == nil {
+			ins = append(ins, depfile.Parse(data)...)
+		} else {
+			// First build, the headers aren't known until the command
+			// has run.
+			fmt.Fprintf(os.Stderr, "sandbox: warning: no depfile for %s yet, the source tree is visible\n", *outputs)
+			sp.addRO(cwd)
+			sp.sourceTree = true
+		}
+	}
+	for _, in := range ins {
+		p := absPath(cwd, in)
+		if _, err := os.Stat(p); err != nil {
+			// Phony targets and such.
+			continue
+		}
+		if sp.inBuildpath(p) {
+			sp.Inputs = append(sp.Inputs, p)
+		} else {
+			sp.addRO(p)
+		}
+	}
+
+	// Ninja has created the output directories, do the same in the stage.
+	for _, out := range strings.Fields(*outputs) {
+		p := absPath(cwd, out)
+		if !sp.inBuildpath(p) {
+			return nil, fmt.Errorf("output %s not in build directory %s", out, *buildpath)
+		}
+		if err := os.MkdirAll(filepath.Dir(sp.stagePath(p)), 0777); err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+func absPath(cwd, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(cwd, p)
+}
+
+func hasPathPrefix(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, "/")+"/")
+}
+
+func (sp *spec) inBuildpath(p string) bool {
+	return hasPathPrefix(p, sp.Buildpath)
+}
+
+func (sp *spec) stagePath(p string) string {
+	rel, _ := filepath.Rel(sp.Buildpath, p)
+	return filepath.Join(sp.Stage, rel)
+}
+
+func (sp *spec) addRO(p string) {
+	if _, err := os.Stat(p); err != nil || sp.inBuildpath(p) {
+		return
+	}
+	sp.RO = append(sp.RO, p)
+}
+
+func (sp *spec) addRW(p string) {
+	if p == "" {
+		return
+	}
+	if _, err := os.Stat(p); err != nil {
+		return
+	}
+	sp.RW = append(sp.RW, p)
+}
+
+// Copies the files written in the stage to the build directory. The mount
+// points of the inputs are left as empty files and directories in the stage
+// and are skipped.
+func (sp *spec) copyOutputs() error {
+	placeholders := make(map[string]bool)
+	for _, in := range sp.Inputs {
+		placeholders[sp.stagePath(in)] = true
+	}
+	return filepath.Walk(sp.Stage, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if placeholders[path] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(sp.Stage, path)
+		dst := filepath.Join(sp.Buildpath, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			return err
+		}
+		tmp := dst + ".sandbox-tmp"
+		os.Remove(tmp)
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err == nil {
+				err = os.Symlink(target, tmp)
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(tmp, data, info.Mode().Perm()); err != nil {
+				return err
+			}
+			// WriteFile is affected by umask.
+			if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		return os.Rename(tmp, dst)
+	})
+}
+
+// Looks for a path mentioned in the output of the failed command that
+// exists but wasn't visible in the sandbox. Relative paths are also tried
+// in the include directories given to the compiler.
+func (sp *spec) findUndeclared(output string) string {
+	dirs := []string{sp.Cwd}
+	for i, a := range sp.Argv {
+		if strings.HasPrefix(a, "-I") && len(a) > 2 {
+			dirs = append(dirs, absPath(sp.Cwd, a[2:]))
+		} else if (a == "-I" || a == "-isystem" || a == "-iquote") && i+1 < len(sp.Argv) {
+			dirs = append(dirs, absPath(sp.Cwd, sp.Argv[i+1]))
+		}
+	}
+	visible := make(map[string]bool)
+	for _, in := range sp.Inputs {
+		visible[in] = true
+	}
+	for _, tok := range strings.FieldsFunc(output, func(r rune) bool {
+		return strings.ContainsRune(" \t\n:'\"`‘’<>()[],", r)
+	}) {
+		var cands []string
+		if filepath.IsAbs(tok) {
+			cands = []string{filepath.Clean(tok)}
+		} else {
+			for _, d := range dirs {
+				cands = append(cands, filepath.Join(d, tok))
+			}
+		}
+		for _, c := range cands {
+			if fi, err := os.Stat(c); err != nil || fi.IsDir() || visible[c] || sp.isVisible(c) {
+				continue
+			}
+			if rel, err := filepath.Rel(sp.Cwd, c); err == nil && !strings.HasPrefix(rel, "../") {
+				return rel
+			}
+			return c
+		}
+	}
+	return ""
+}
+
+func (sp *spec) isVisible(p string) bool {
+	if sp.inBuildpath(p) {
+		return false
+	}
+	for _, d := range append(sp.RO[:len(sp.RO):len(sp.RO)], sp.RW...) {
+		if hasPathPrefix(p, d) {
+			return true
+		}
+	}
+	return false
+}
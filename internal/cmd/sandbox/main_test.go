@@ -0,0 +1,227 @@
+// Copyright 2026 Schibsted
+
+package sandbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Sets up a source tree in a temporary directory and changes to it. The
+// returned function goes back, removes it and resets the flags.
+func setupTree(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory might be a symlink.
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+		*buildpath = "build"
+		*inputs = ""
+		*outputs = ""
+		*depfileF = ""
+	}
+}
+
+func removeSpec(sp *spec) {
+	os.RemoveAll(filepath.Dir(sp.Root))
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewSpec(t *testing.T) {
+	dir, cleanup := setupTree(t, map[string]string{
+		"src/a.c":               "",
+		"src/a.h":               "",
+		"src/other.h":           "",
+		"build/obj/gen.h":       "",
+		"build/obj/a.o.d":       "build/obj/a.o: src/a.c src/a.h build/obj/gen.h\n",
+		"build/obj/unrelated.o": "",
+		"build/obj/objs.rsp":    "build/obj/unrelated.o\n",
+	})
+	defer cleanup()
+	*inputs = "src/a.c phony"
+	*outputs = "build/obj/a.o"
+	*depfileF = "build/obj/a.o.d"
+
+	sp, err := newSpec([]string{"cc", "-I/usr/include", "-c", "src/a.c", "@build/obj/objs.rsp", "-o", "build/obj/a.o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeSpec(sp)
+
+	if sp.sourceTree {
+		t.Error("Source tree visible with a depfile")
+	}
+	if sp.Buildpath != filepath.Join(dir, "build") {
+		t.Errorf("Bad buildpath %s", sp.Buildpath)
+	}
+	// The build directory inputs are mounted in it, the others are
+	// visible read-only.
+	ins := append([]string(nil), sp.Inputs...)
+	sort.Strings(ins)
+	expt := []string{filepath.Join(dir, "build/obj/gen.h"), filepath.Join(dir, "build/obj/objs.rsp"), filepath.Join(dir, "build/obj/unrelated.o")}
+	if !reflect.DeepEqual(ins, expt) {
+		t.Errorf("Bad inputs %q", ins)
+	}
+	for _, p := range []string{filepath.Join(dir, "src/a.c"), filepath.Join(dir, "src/a.h"), "/usr", "/usr/include"} {
+		if !contains(sp.RO, p) {
+			t.Errorf("%s not visible, read-only %q", p, sp.RO)
+		}
+	}
+	for _, p := range []string{dir, filepath.Join(dir, "src/other.h"), filepath.Join(dir, "build")} {
+		if sp.isVisible(p) {
+			t.Errorf("%s visible", p)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(sp.Stage, "obj")); err != nil || !fi.IsDir() {
+		t.Errorf("Output directory not created in the stage")
+	}
+}
+
+func TestNewSpecNoDepfile(t *testing.T) {
+	dir, cleanup := setupTree(t, map[string]string{"src/a.c": ""})
+	defer cleanup()
+	*outputs = "build/obj/a.o"
+	*depfileF = "build/obj/a.o.d"
+
+	sp, err := newSpec([]string{"cc", "-c", "src/a.c", "-o", "build/obj/a.o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeSpec(sp)
+	if !sp.sourceTree || !sp.isVisible(filepath.Join(dir, "src/a.c")) {
+		t.Errorf("Expected the source tree to be visible without a depfile")
+	}
+
+	*outputs = "elsewhere/a.o"
+	if sp, err := newSpec([]string{"cc"}); err == nil {
+		removeSpec(sp)
+		t.Error("Expected an error for an output outside the build directory")
+	}
+}
+
+func TestFindUndeclared(t *testing.T) {
+	dir, cleanup := setupTree(t, map[string]string{
+		"src/a.h":        "",
+		"inc/b.h":        "",
+		"build/obj/c.h":  "",
+		"build/obj/in.h": "",
+	})
+	defer cleanup()
+	sp := &spec{
+		Cwd:       dir,
+		Buildpath: filepath.Join(dir, "build"),
+		RO:        []string{filepath.Join(dir, "src")},
+		Inputs:    []string{filepath.Join(dir, "build/obj/in.h")},
+		Argv:      []string{"cc", "-Iinc", "-I", "build/obj", "-c", "src/a.c"},
+	}
+	for _, tc := range []struct {
+		output, expt string
+	}{
+		{"src/a.c:1:10: fatal error: b.h: No such file or directory", "inc/b.h"},
+		{"src/a.c:1:10: fatal error: 'c.h' file not found", "build/obj/c.h"},
+		{"cat: " + filepath.Join(dir, "inc/b.h") + ": No such file or directory", "inc/b.h"},
+		// Visible files and inputs aren't the problem.
+		{"src/a.c:1:10: fatal error: a.h: No such file or directory", ""},
+		{"src/a.c:1:10: fatal error: in.h: No such file or directory", ""},
+		{"src/a.c:2:1: error: expected ';'", ""},
+	} {
+		if p := sp.findUndeclared(tc.output); p != tc.expt {
+			t.Errorf("findUndeclared(%q) = %q, expected %q", tc.output, p, tc.expt)
+		}
+	}
+}
+
+func TestMissingFileError(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		expt   bool
+	}{
+		{"a.c:1:10: fatal error: b.h: No such file or directory", true},
+		{"a.c:1:10: fatal error: 'b.h' file not found", true},
+		{"/usr/bin/ld: cannot find -lfoo", true},
+		{"sh: 1: gen.sh: Permission denied", true},
+		{"a.c:2:1: error: expected ';' before '}' token", false},
+		{"a.c:(.text+0x5): undefined reference to `foo'", false},
+	} {
+		if r := missingFileError(tc.output); r != tc.expt {
+			t.Errorf("missingFileError(%q) = %v", tc.output, r)
+		}
+	}
+}
+
+func TestCopyOutputs(t *testing.T) {
+	dir, cleanup := setupTree(t, map[string]string{
+		"stage/obj/a.o":    "object",
+		"stage/obj/in.h":   "",
+		"stage/gen/x.h":    "",
+		"build/obj/in.h":   "input",
+		"build/gen/x.h":    "input dir",
+		"build/obj/keep.o": "keep",
+	})
+	defer cleanup()
+	os.Chmod(filepath.Join(dir, "stage/obj/a.o"), 0755)
+	os.Symlink("a.o", filepath.Join(dir, "stage/obj/link.o"))
+	sp := &spec{
+		Stage:     filepath.Join(dir, "stage"),
+		Buildpath: filepath.Join(dir, "build"),
+		Inputs:    []string{filepath.Join(dir, "build/obj/in.h"), filepath.Join(dir, "build/gen")},
+	}
+	if err := sp.copyOutputs(); err != nil {
+		t.Fatal(err)
+	}
+	for f, expt := range map[string]string{
+		"build/obj/a.o":    "object",
+		"build/obj/link.o": "object",
+		"build/obj/in.h":   "input",
+		"build/gen/x.h":    "input dir",
+		"build/obj/keep.o": "keep",
+	} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, f)); err != nil || string(data) != expt {
+			t.Errorf("Bad %s %q, %v", f, data, err)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "build/obj/a.o")); err != nil || fi.Mode().Perm() != 0755 {
+		t.Errorf("Bad mode of copied output %v", fi.Mode())
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "build/obj/link.o")); err != nil || target != "a.o" {
+		t.Errorf("Bad symlink %q, %v", target, err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "build/*/*.sandbox-tmp")); len(tmps) > 0 {
+		t.Errorf("Temporary files left %q", tmps)
+	}
+}
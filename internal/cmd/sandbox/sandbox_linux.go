@@ -0,0 +1,205 @@
+// Copyright 2026 Schibsted
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const specEnv = "SEB_SANDBOX_SPEC"
+
+// Runs the command in new user and mount namespaces, by running ourselves
+// with -inside. Root in the user namespace is mapped to the current user, so
+// the outputs get the right owner.
+func (sp *spec) run(stdout, stderr io.Writer) (int, error) {
+	for _, in := range sp.Inputs {
+		// Create the mount points for the inputs.
+		fi, err := os.Stat(in)
+		if err != nil {
+			return 0, err
+		}
+		if err := mkMountPoint(sp.stagePath(in), fi.IsDir()); err != nil {
+			return 0, err
+		}
+	}
+	data, err := json.Marshal(sp)
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command("/proc/self/exe", "-tool", "sandbox", "-inside")
+	cmd.Env = append(os.Environ(), specEnv+"="+string(data))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+	err = cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		if exit.ExitCode() == setupFailed {
+			return 0, fmt.Errorf("setup failed: %s", strings.TrimSpace(fmt.Sprint(stderr)))
+		}
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't create namespaces: %s", err)
+	}
+	return 0, nil
+}
+
+// Exit code used when setting up the sandbox fails.
+const setupFailed = 125
+
+func runInside() {
+	var sp spec
+	if err := json.Unmarshal([]byte(os.Getenv(specEnv)), &sp); err != nil {
+		setupError(err)
+	}
+	os.Unsetenv(specEnv)
+	if err := sp.setup(); err != nil {
+		setupError(err)
+	}
+	bin, err := exec.LookPath(sp.Argv[0])
+	if err == nil {
+		err = syscall.Exec(bin, sp.Argv, os.Environ())
+	}
+	fmt.Fprintf(os.Stderr, "Failed to run %s: %s\n", sp.Argv[0], err)
+	os.Exit(127)
+}
+
+func setupError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(setupFailed)
+}
+
+func (sp *spec) setup() error {
+	// Don't propagate our mounts to the parent namespace.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make / private: %s", err)
+	}
+	if err := syscall.Mount("tmpfs", sp.Root, "tmpfs", 0, "mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %s", err)
+	}
+
+	for _, d := range []string{"/dev", "/proc"} {
+		if err := bind(d, filepath.Join(sp.Root, d), false); err != nil {
+			return err
+		}
+	}
+	if err := mkMountPoint(filepath.Join(sp.Root, "tmp"), true); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", filepath.Join(sp.Root, "tmp"), "tmpfs", 0, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %s", err)
+	}
+
+	// Sorted so that directories are mounted before the paths inside them,
+	// which are then skipped.
+	var mounted []string
+	covered := func(p string) bool {
+		for _, m := range mounted {
+			if hasPathPrefix(p, m) {
+				return true
+			}
+		}
+		return false
+	}
+	paths := append(sp.RW[:len(sp.RW):len(sp.RW)], sp.RO...)
+	sort.Strings(paths)
+	rw := make(map[string]bool)
+	for _, p := range sp.RW {
+		rw[p] = true
+	}
+	for _, p := range paths {
+		if covered(p) {
+			continue
+		}
+		if err := bind(p, filepath.Join(sp.Root, p), !rw[p]); err != nil {
+			return err
+		}
+		mounted = append(mounted, p)
+	}
+
+	// The stage replaces the build directory, with the inputs in it.
+	if err := bind(sp.Stage, filepath.Join(sp.Root, sp.Buildpath), false); err != nil {
+		return err
+	}
+	for _, in := range sp.Inputs {
+		if err := bind(in, filepath.Join(sp.Root, in), true); err != nil {
+			return err
+		}
+	}
+
+	if err := mkMountPoint(filepath.Join(sp.Root, sp.Cwd), true); err != nil {
+		return err
+	}
+	if err := syscall.Chroot(sp.Root); err != nil {
+		return fmt.Errorf("chroot: %s", err)
+	}
+	return os.Chdir(sp.Cwd)
+}
+
+func mkMountPoint(p string, dir bool) error {
+	if dir {
+		return os.MkdirAll(p, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+	return ioutil.WriteFile(p, nil, 0644)
+}
+
+// Bind mounts src on dst, creating the mount point.
+func bind(src, dst string, ro bool) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := mkMountPoint(dst, fi.IsDir()); err != nil {
+		return err
+	}
+	if err := syscall.Mount(src, dst, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %s", src, err)
+	}
+	if !ro {
+		return nil
+	}
+	// A read-only bind mount needs a remount, keeping the flags that are
+	// locked since the mount comes from a more privileged namespace.
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dst, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY)
+	for stf, msf := range map[int64]uintptr{
+		0x2:    syscall.MS_NOSUID,
+		0x4:    syscall.MS_NODEV,
+		0x8:    syscall.MS_NOEXEC,
+		0x400:  syscall.MS_NOATIME,
+		0x800:  syscall.MS_NODIRATIME,
+		0x1000: syscall.MS_RELATIME,
+	} {
+		if int64(st.Flags)&stf != 0 {
+			flags |= msf
+		}
+	}
+	if err := syscall.Mount("", dst, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %s", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+// Copyright 2026 Schibsted
+
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"io"
+)
+
+func (sp *spec) run(stdout, stderr io.Writer) (int, error) {
+	return 0, errors.New("only supported on Linux")
+}
+
+func runInside() {
+	panic("sandbox: only supported on Linux")
+}
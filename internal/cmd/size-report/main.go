@@ -0,0 +1,390 @@
+// Copyright 2026 Schibsted
+
+// Package size_report reports the sizes of the ELF files built in a flavor,
+// per section and per symbol.
+//
+// The size of a file is the size of its allocated sections, i.e. what's
+// loaded into memory, so stripping or splitting the debug information
+// doesn't change it. Static libraries are reported as the sum of their
+// members.
+//
+// Reports written with -json can be compared with -diff, and -budget checks
+// a single file, which is what the size_budget argument uses.
+package size_report
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	flagset   = flag.NewFlagSet("size-report", flag.ExitOnError)
+	buildpath = flagset.String("buildpath", "build", "The build directory.")
+	jsonOut   = flagset.Bool("json", false, "Write the report as JSON.")
+	nsymbols  = flagset.Int("symbols", 20, "Number of the largest symbols to include per file, 0 for all.")
+	diff      = flagset.Bool("diff", false, "Compare two JSON reports.")
+	budget    = flagset.Int64("budget", 0, "Fail if the file is larger than this, otherwise write the stamp.")
+)
+
+type Entry struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
+}
+
+type FileReport struct {
+	Path     string  `json:"path"`
+	Size     uint64  `json:"size"`
+	FileSize int64   `json:"file_size"`
+	Sections []Entry `json:"sections"`
+	Symbols  []Entry `json:"symbols,omitempty"`
+}
+
+type Report struct {
+	Files []*FileReport `json:"files"`
+}
+
+var errNotELF = errors.New("not an ELF file or archive")
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), `Usage: %[1]s -tool size-report [options] <flavor>
+       %[1]s -tool size-report -diff <old.json> <new.json>
+       %[1]s -tool size-report -budget=<bytes> <file> <stamp>
+`, os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+
+	var err error
+	switch {
+	case *diff && flagset.NArg() == 2:
+		err = diffReports(os.Stdout, flagset.Arg(0), flagset.Arg(1))
+	case *budget > 0 && flagset.NArg() == 2:
+		var ok bool
+		ok, err = checkBudget(os.Stderr, flagset.Arg(0), flagset.Arg(1))
+		if err == nil && !ok {
+			os.Exit(1)
+		}
+	case !*diff && *budget == 0 && flagset.NArg() == 1:
+		var rep *Report
+		rep, err = flavorReport(flagset.Arg(0))
+		if err == nil && *jsonOut {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "\t")
+			err = enc.Encode(rep)
+		} else if err == nil {
+			err = writeText(os.Stdout, rep)
+		}
+	default:
+		flagset.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "size-report: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Reports the installed files of the flavor and its static libraries.
+// Paths are relative to the build directory.
+func flavorReport(flavor string) (*Report, error) {
+	rep := &Report{}
+	for _, dir := range []string{flavor, filepath.Join("obj", flavor, "lib")} {
+		root := filepath.Join(*buildpath, dir)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == root {
+					return nil
+				}
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			fr, err := fileReport(path)
+			if err == errNotELF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+			fr.Path, _ = filepath.Rel(*buildpath, path)
+			rep.Files = append(rep.Files, fr)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rep, nil
+}
+
+func fileReport(path string) (*FileReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fr := &FileReport{Path: path, FileSize: int64(len(data))}
+	sections := make(map[string]uint64)
+	var symbols []Entry
+	switch {
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		if err := addELF(data, sections, &symbols); err != nil {
+			return nil, err
+		}
+	case bytes.HasPrefix(data, []byte("!<arch>\n")):
+		err := readArchive(data[8:], func(member []byte) error {
+			if !bytes.HasPrefix(member, []byte(elf.ELFMAG)) {
+				// Symbol tables, Go package data and such.
+				return nil
+			}
+			return addELF(member, sections, &symbols)
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errNotELF
+	}
+
+	for name, size := range sections {
+		fr.Sections = append(fr.Sections, Entry{name, size})
+		fr.Size += size
+	}
+	sortEntries(fr.Sections)
+	sortEntries(symbols)
+	if *nsymbols > 0 && len(symbols) > *nsymbols {
+		symbols = symbols[:*nsymbols]
+	}
+	fr.Symbols = symbols
+	return fr, nil
+}
+
+// Adds the allocated sections and the function and object symbols.
+func addELF(data []byte, sections map[string]uint64, symbols *[]Entry) error {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Size > 0 {
+			sections[s.Name] += s.Size
+		}
+	}
+	syms, err := f.Symbols()
+	if err == elf.ErrNoSymbols {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, s := range syms {
+		switch elf.ST_TYPE(s.Info) {
+		case elf.STT_FUNC, elf.STT_OBJECT:
+		default:
+			continue
+		}
+		if s.Size == 0 || s.Section == elf.SHN_UNDEF || s.Section >= elf.SHN_LORESERVE {
+			continue
+		}
+		*symbols = append(*symbols, Entry{s.Name, s.Size})
+	}
+	return nil
+}
+
+// Calls fn with the contents of each member of the ar archive.
+func readArchive(data []byte, fn func(member []byte) error) error {
+	for len(data) >= 60 {
+		hdr := data[:60]
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || size < 0 || size > int64(len(data)-60) {
+			return errors.New("corrupt archive")
+		}
+		member := data[60 : 60+size]
+		name := strings.TrimSpace(string(hdr[:16]))
+		if strings.HasPrefix(name, "#1/") {
+			// BSD names are stored first in the data.
+			n, _ := strconv.Atoi(name[3:])
+			if n <= len(member) {
+				member = member[n:]
+			}
+		}
+		if name != "/" && name != "//" && name != "/SYM64/" {
+			if err := fn(member); err != nil {
+				return err
+			}
+		}
+		// Members are aligned to even offsets.
+		data = data[60+size+size%2:]
+	}
+	return nil
+}
+
+func sortEntries(es []Entry) {
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].Size != es[j].Size {
+			return es[i].Size > es[j].Size
+		}
+		return es[i].Name < es[j].Name
+	})
+}
+
+func writeText(w io.Writer, rep *Report) error {
+	bw := bufio.NewWriter(w)
+	for i, fr := range rep.Files {
+		if i > 0 {
+			bw.WriteByte('\n')
+		}
+		fmt.Fprintf(bw, "%s: %d bytes, %d in file\n", fr.Path, fr.Size, fr.FileSize)
+		writeEntries(bw, "section", fr.Sections)
+		if len(fr.Symbols) > 0 {
+			writeEntries(bw, "symbol", fr.Symbols)
+		}
+	}
+	return bw.Flush()
+}
+
+func writeEntries(w io.Writer, title string, es []Entry) {
+	width := len(title)
+	for _, e := range es {
+		if len(e.Name) > width {
+			width = len(e.Name)
+		}
+	}
+	fmt.Fprintf(w, "  %-*s %10s\n", width, title, "size")
+	for _, e := range es {
+		fmt.Fprintf(w, "  %-*s %10d\n", width, e.Name, e.Size)
+	}
+}
+
+func readReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{}
+	if err := json.Unmarshal(data, rep); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return rep, nil
+}
+
+// Prints the files, sections and symbols that changed size. Only the
+// symbols included in the reports can be compared.
+func diffReports(w io.Writer, oldpath, newpath string) error {
+	oldrep, err := readReport(oldpath)
+	if err != nil {
+		return err
+	}
+	newrep, err := readReport(newpath)
+	if err != nil {
+		return err
+	}
+	oldfiles := make(map[string]*FileReport)
+	for _, fr := range oldrep.Files {
+		oldfiles[fr.Path] = fr
+	}
+	newfiles := make(map[string]*FileReport)
+	var paths []string
+	for _, fr := range newrep.Files {
+		newfiles[fr.Path] = fr
+		paths = append(paths, fr.Path)
+	}
+	for _, fr := range oldrep.Files {
+		if newfiles[fr.Path] == nil {
+			paths = append(paths, fr.Path)
+		}
+	}
+	sort.Strings(paths)
+
+	bw := bufio.NewWriter(w)
+	var total int64
+	for _, p := range paths {
+		o, n := oldfiles[p], newfiles[p]
+		switch {
+		case o == nil:
+			fmt.Fprintf(bw, "%s: added, %d bytes\n", p, n.Size)
+			total += int64(n.Size)
+		case n == nil:
+			fmt.Fprintf(bw, "%s: removed, %d bytes\n", p, o.Size)
+			total -= int64(o.Size)
+		case o.Size != n.Size:
+			d := int64(n.Size) - int64(o.Size)
+			fmt.Fprintf(bw, "%s: %+d bytes, %d to %d\n", p, d, o.Size, n.Size)
+			writeDeltas(bw, o.Sections, n.Sections)
+			writeDeltas(bw, o.Symbols, n.Symbols)
+			total += d
+		}
+	}
+	fmt.Fprintf(bw, "Total: %+d bytes\n", total)
+	return bw.Flush()
+}
+
+type delta struct {
+	name     string
+	old, new uint64
+}
+
+func writeDeltas(w io.Writer, olds, news []Entry) {
+	sizes := make(map[string]*delta)
+	var ds []*delta
+	get := func(name string) *delta {
+		if sizes[name] == nil {
+			sizes[name] = &delta{name: name}
+			ds = append(ds, sizes[name])
+		}
+		return sizes[name]
+	}
+	for _, e := range olds {
+		get(e.Name).old += e.Size
+	}
+	for _, e := range news {
+		get(e.Name).new += e.Size
+	}
+	diff := func(d *delta) int64 {
+		return int64(d.new) - int64(d.old)
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		di, dj := diff(ds[i]), diff(ds[j])
+		if di < 0 {
+			di = -di
+		}
+		if dj < 0 {
+			dj = -dj
+		}
+		return di > dj
+	})
+	for _, d := range ds {
+		if d.old != d.new {
+			fmt.Fprintf(w, "  %-40s %+10d\n", d.name, diff(d))
+		}
+	}
+}
+
+// Checks the size of the file against the budget, writing the stamp if it's
+// within it or the sizes of the sections to w if not.
+func checkBudget(w io.Writer, file, stamp string) (bool, error) {
+	fr, err := fileReport(file)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", file, err)
+	}
+	if fr.Size > uint64(*budget) {
+		fmt.Fprintf(w, "%s: %d bytes is over the size budget of %d bytes by %d\n", file, fr.Size, *budget, fr.Size-uint64(*budget))
+		writeEntries(w, "section", fr.Sections)
+		return false, nil
+	}
+	return true, ioutil.WriteFile(stamp, nil, 0666)
+}
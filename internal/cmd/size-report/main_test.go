@@ -0,0 +1,151 @@
+// Copyright 2026 Schibsted
+
+package size_report
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Returns an ar member header and data, padded to an even size.
+func arMember(name string, data []byte) []byte {
+	hdr := fmt.Sprintf("%-16s%-12s%-6s%-6s%-8s%-10d`\n", name, "0", "0", "0", "644", len(data))
+	ret := append([]byte(hdr), data...)
+	if len(data)%2 == 1 {
+		ret = append(ret, '\n')
+	}
+	return ret
+}
+
+func TestReadArchive(t *testing.T) {
+	var data []byte
+	data = append(data, arMember("/", []byte("symtab"))...)
+	data = append(data, arMember("//", []byte("long_member_name.o/\n"))...)
+	// Odd sizes are padded.
+	data = append(data, arMember("a.o/", []byte("abc"))...)
+	data = append(data, arMember("/0", []byte("long"))...)
+	// BSD archives store the name first in the data.
+	data = append(data, arMember("#1/12", []byte("bsd_name.o\x00\x00bsd"))...)
+	data = append(data, arMember("b.o/", []byte("b"))...)
+
+	var members []string
+	err := readArchive(data, func(member []byte) error {
+		members = append(members, string(member))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expt := []string{"abc", "long", "bsd", "b"}; !reflect.DeepEqual(members, expt) {
+		t.Errorf("Bad members %q, expected %q", members, expt)
+	}
+
+	// A member larger than the archive.
+	bad := arMember("a.o/", []byte("abcd"))
+	if err := readArchive(bad[:len(bad)-2], func([]byte) error { return nil }); err == nil {
+		t.Error("Expected an error for a truncated archive")
+	}
+	if err := readArchive(bytes.Repeat([]byte("x"), 60), func([]byte) error { return nil }); err == nil {
+		t.Error("Expected an error for a bad header")
+	}
+}
+
+func TestDiffReports(t *testing.T) {
+	var buf bytes.Buffer
+	if err := diffReports(&buf, "testdata/old.json", "testdata/new.json"); err != nil {
+		t.Fatal(err)
+	}
+	var expt bytes.Buffer
+	fmt.Fprintf(&expt, "dev/bin/a: +100 bytes, 1000 to 1100\n")
+	for _, d := range []struct {
+		name string
+		diff int
+	}{{".text", 150}, {".data", -50}, {"foo", 150}, {"bar", 30}} {
+		fmt.Fprintf(&expt, "  %-40s %+10d\n", d.name, d.diff)
+	}
+	fmt.Fprintf(&expt, "dev/bin/gone: removed, 10 bytes\n")
+	fmt.Fprintf(&expt, "dev/bin/new: added, 40 bytes\n")
+	fmt.Fprintf(&expt, "Total: +130 bytes\n")
+	if buf.String() != expt.String() {
+		t.Errorf("Bad diff:\n%s\nexpected:\n%s", buf.String(), expt.String())
+	}
+
+	if err := diffReports(&buf, "testdata/old.json", "testdata/missing.json"); err == nil {
+		t.Error("Expected an error for a missing report")
+	}
+}
+
+// Builds an object and an archive of it, checking them against budgets.
+func TestCheckBudget(t *testing.T) {
+	for _, tool := range []string{"cc", "ar"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "size-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "a.c")
+	obj := filepath.Join(dir, "a.o")
+	lib := filepath.Join(dir, "liba.a")
+	ioutil.WriteFile(src, []byte("int table[256] = {1};\nint f(int x) { return table[x]; }\n"), 0666)
+	for _, cmd := range [][]string{{"cc", "-c", "-o", obj, src}, {"ar", "rcs", lib, obj}} {
+		if out, err := exec.Command(cmd[0], cmd[1:]...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v\n%s", cmd[0], err, out)
+		}
+	}
+
+	objrep, err := fileReport(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	librep, err := fileReport(lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objrep.Size < 1024 || librep.Size != objrep.Size {
+		t.Errorf("Bad sizes %d and %d", objrep.Size, librep.Size)
+	}
+	if len(objrep.Symbols) == 0 || objrep.Symbols[0] != (Entry{"table", 1024}) {
+		t.Errorf("Bad symbols %v", objrep.Symbols)
+	}
+
+	defer func() { *budget = 0 }()
+	stamp := filepath.Join(dir, "stamp")
+	for _, file := range []string{obj, lib} {
+		*budget = int64(objrep.Size)
+		var buf bytes.Buffer
+		if ok, err := checkBudget(&buf, file, stamp); err != nil || !ok {
+			t.Errorf("%s: expected to be within budget, got %v, %v:\n%s", file, ok, err, buf.String())
+		}
+		if _, err := os.Stat(stamp); err != nil {
+			t.Errorf("%s: stamp not written", file)
+		}
+		os.Remove(stamp)
+
+		*budget = 1000
+		buf.Reset()
+		if ok, err := checkBudget(&buf, file, stamp); err != nil || ok {
+			t.Errorf("%s: expected to be over budget, got %v, %v", file, ok, err)
+		}
+		if msg := fmt.Sprintf("%s: %d bytes is over the size budget of 1000 bytes by %d\n", file, objrep.Size, objrep.Size-1000); !strings.HasPrefix(buf.String(), msg) || !strings.Contains(buf.String(), ".data") {
+			t.Errorf("%s: bad output:\n%s", file, buf.String())
+		}
+		if _, err := os.Stat(stamp); err == nil {
+			t.Errorf("%s: stamp written", file)
+		}
+	}
+
+	if _, err := checkBudget(ioutil.Discard, src, stamp); err == nil {
+		t.Error("Expected an error for a non-ELF file")
+	}
+}
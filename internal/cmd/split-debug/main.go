@@ -0,0 +1,148 @@
+// Copyright 2026 Schibsted
+
+// Package split_debug runs a link command and then moves the debug
+// information of the output into a separate file.
+//
+// The output is stripped and gets a debuglink pointing to the debug file.
+// The debug file is also linked from the .build-id directory, named from
+// the GNU build-id of the output, where debuggers look for it.
+package split_debug
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/command"
+)
+
+var (
+	flagset    = flag.NewFlagSet("split-debug", flag.ExitOnError)
+	out        = flagset.String("out", "", "The output of the command.")
+	debugfile  = flagset.String("debug", "", "File to write the debug information to.")
+	buildidDir = flagset.String("buildid-dir", "", "The .build-id directory to link the debug file from.")
+	objcopy    = flagset.String("objcopy", "objcopy", "The objcopy binary to use.")
+)
+
+var errNoBuildID = errors.New("no GNU build-id note found")
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool split-debug -out file -debug file [options] [--] [VAR=value...] command [args...]\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	env, argv := command.SplitEnv(flagset.Args())
+	if len(argv) == 0 || *out == "" || *debugfile == "" {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	if code := command.Run(env, argv); code != 0 {
+		os.Exit(code)
+	}
+	if err := split(); err != nil {
+		fmt.Fprintf(os.Stderr, "split-debug %s: %s\n", *out, err)
+		// Make ninja rerun us.
+		os.Remove(*out)
+		os.Exit(1)
+	}
+}
+
+func split() error {
+	if err := os.MkdirAll(filepath.Dir(*debugfile), 0777); err != nil {
+		return err
+	}
+	if err := run(*objcopy, "--only-keep-debug", *out, *debugfile); err != nil {
+		return err
+	}
+	tmp := *out + ".split-tmp"
+	if err := run(*objcopy, "--strip-unneeded", "--add-gnu-debuglink="+*debugfile, *out, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+	if *buildidDir == "" {
+		return nil
+	}
+
+	id, err := buildID(*out)
+	if err != nil {
+		return err
+	}
+	if len(id) < 2 {
+		return errNoBuildID
+	}
+	hexid := hex.EncodeToString(id)
+	link := filepath.Join(*buildidDir, hexid[:2], hexid[2:]+".debug")
+	if err := os.MkdirAll(filepath.Dir(link), 0777); err != nil {
+		return err
+	}
+	absdebug, err := filepath.Abs(*debugfile)
+	if err != nil {
+		return err
+	}
+	abslink, err := filepath.Abs(link)
+	if err != nil {
+		return err
+	}
+	target, err := filepath.Rel(filepath.Dir(abslink), absdebug)
+	if err != nil {
+		return err
+	}
+	os.Remove(link)
+	return os.Symlink(target, link)
+}
+
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Returns the contents of the GNU build-id note.
+func buildID(file string) ([]byte, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		for len(data) >= 12 {
+			namesz := f.ByteOrder.Uint32(data[0:4])
+			descsz := f.ByteOrder.Uint32(data[4:8])
+			typ := f.ByteOrder.Uint32(data[8:12])
+			nameoff := 12
+			descoff := nameoff + align4(namesz)
+			next := descoff + align4(descsz)
+			if next > len(data) {
+				break
+			}
+			name := data[nameoff : nameoff+int(namesz)]
+			if typ == 3 && bytes.Equal(name, []byte("GNU\x00")) {
+				return data[descoff : descoff+int(descsz)], nil
+			}
+			data = data[next:]
+		}
+	}
+	return nil, errNoBuildID
+}
+
+func align4(n uint32) int {
+	return int((n + 3) &^ 3)
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 Schibsted
+
+package split_debug
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Builds a tiny program with debug information, returning the temporary
+// directory it's in.
+func buildProg(t *testing.T, buildid string) string {
+	for _, tool := range []string{"cc", "objcopy"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	dir, err := ioutil.TempDir("", "split-debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "prog.c")
+	if err := ioutil.WriteFile(src, []byte("int main(void) { return 0; }\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(dir, "bin"), 0777)
+	cmd := exec.Command("cc", "-g", "-Wl,--build-id="+buildid, "-o", filepath.Join(dir, "bin/prog"), src)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("cc failed: %v\n%s", err, out)
+	}
+	return dir
+}
+
+func setFlags(dir string) func() {
+	*out = filepath.Join(dir, "bin/prog")
+	*debugfile = filepath.Join(dir, "debug/bin/prog.debug")
+	*buildidDir = filepath.Join(dir, "debug/.build-id")
+	return func() {
+		*out = ""
+		*debugfile = ""
+		*buildidDir = ""
+	}
+}
+
+func hasSection(t *testing.T, file, name string) bool {
+	f, err := elf.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return f.Section(name) != nil
+}
+
+func TestSplit(t *testing.T) {
+	dir := buildProg(t, "sha1")
+	defer os.RemoveAll(dir)
+	defer setFlags(dir)()
+
+	id, err := buildID(*out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != 20 {
+		t.Fatalf("Bad sha1 build-id %x", id)
+	}
+
+	if err := split(); err != nil {
+		t.Fatal(err)
+	}
+
+	if hasSection(t, *out, ".debug_info") {
+		t.Error("Output not stripped")
+	}
+	if !hasSection(t, *debugfile, ".debug_info") {
+		t.Error("No debug information in the debug file")
+	}
+	// The build-id is kept, identifying both files.
+	if oid, err := buildID(*out); err != nil || !bytes.Equal(oid, id) {
+		t.Errorf("Bad build-id of the stripped output %x, %v", oid, err)
+	}
+	if did, err := buildID(*debugfile); err != nil || !bytes.Equal(did, id) {
+		t.Errorf("Bad build-id of the debug file %x, %v", did, err)
+	}
+
+	f, err := elf.Open(*out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dl := f.Section(".gnu_debuglink")
+	if dl == nil {
+		t.Fatal("No debuglink")
+	}
+	data, err := dl.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := data[:bytes.IndexByte(data, 0)]; string(name) != "prog.debug" {
+		t.Errorf("Bad debuglink %q", name)
+	}
+
+	hexid := hex.EncodeToString(id)
+	link := filepath.Join(*buildidDir, hexid[:2], hexid[2:]+".debug")
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != "../../bin/prog.debug" {
+		t.Errorf("Bad build-id symlink target %q", target)
+	}
+	if _, err := os.Stat(link); err != nil {
+		t.Errorf("Build-id symlink doesn't resolve: %v", err)
+	}
+
+	// Splitting again, e.g. after a cache hit, replaces the symlink.
+	cmd := exec.Command("cc", "-g", "-Wl,--build-id=sha1", "-o", *out, filepath.Join(dir, "prog.c"))
+	if o, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cc failed: %v\n%s", err, o)
+	}
+	if err := split(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(link); err != nil {
+		t.Errorf("Build-id symlink missing after splitting again: %v", err)
+	}
+}
+
+func TestSplitNoBuildID(t *testing.T) {
+	dir := buildProg(t, "none")
+	defer os.RemoveAll(dir)
+	defer setFlags(dir)()
+
+	if _, err := buildID(*out); err != errNoBuildID {
+		t.Errorf("Expected errNoBuildID, got %v", err)
+	}
+	if err := split(); err != errNoBuildID {
+		t.Errorf("Expected errNoBuildID from split, got %v", err)
+	}
+
+	// Without a .build-id directory it's not needed.
+	dir2 := buildProg(t, "none")
+	defer os.RemoveAll(dir2)
+	setFlags(dir2)
+	*buildidDir = ""
+	if err := split(); err != nil {
+		t.Error(err)
+	}
+	if !hasSection(t, *debugfile, ".debug_info") {
+		t.Error("No debug information in the debug file")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2026 Schibsted
+
+// Package test_report merges the reports written when running the GOTEST
+// targets of a flavor into a single file.
+//
+// The gotest targets write build/<flavor>/gotest/<name>.json and .xml. This
+// reads the JSON summaries, so the result can be written in either format.
+package test_report
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/testreport"
+)
+
+var (
+	flagset   = flag.NewFlagSet("test-report", flag.ExitOnError)
+	buildpath = flagset.String("buildpath", "build", "The build directory.")
+	format    = flagset.String("format", "junit", "Output format, junit or json.")
+	output    = flagset.String("o", "", "Write the report to this file instead of stdout.")
+)
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool test-report [options] <flavor>\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	if flagset.NArg() != 1 || (*format != "junit" && *format != "json") {
+		flagset.Usage()
+		os.Exit(2)
+	}
+	if err := merge(flagset.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "test-report: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func merge(flavor string) error {
+	files, err := filepath.Glob(filepath.Join(*buildpath, flavor, "gotest", "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no test reports found for flavor %s, run the gotest targets first", flavor)
+	}
+	var reports []*testreport.Report
+	for _, file := range files {
+		rep, err := readReport(file)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		reports = append(reports, rep)
+	}
+	rep := testreport.Merge(reports...)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if *format == "json" {
+		err = rep.WriteJSON(bw)
+	} else {
+		err = rep.WriteJUnit(bw)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func readReport(file string) (*testreport.Report, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return testreport.ReadJSON(f)
+}
@@ -0,0 +1,226 @@
+// Copyright 2026 Schibsted
+
+// Package test_runner runs a test program as part of the build.
+//
+// The output of the test is written to a log file and the stamp is only
+// written if the test passes, so ninja reruns failed tests. A test passes
+// if it exits with the expected code within the timeout and, if it's
+// parsed as TAP, all its tests pass. On timeout the test is killed together
+// with any processes it started.
+//
+// With -tmp the test gets a fresh temporary directory, removed afterwards,
+// where HOME and TMPDIR point. Unless -dir is given it's also run in a work
+// directory there, with the -data files copied into it.
+package test_runner
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/command"
+	"github.com/schibsted/sebuild/v2/internal/pkg/tap"
+)
+
+var (
+	flagset  = flag.NewFlagSet("test-runner", flag.ExitOnError)
+	stamp    = flagset.String("stamp", "", "File to write when the test passes.")
+	logfile  = flagset.String("log", "", "File to write the output of the test to.")
+	dir      = flagset.String("dir", "", "Directory to run the test in.")
+	timeout  = flagset.Duration("timeout", 0, "Time after which the test is killed, 0 for no limit.")
+	exitCode = flagset.Int("exit-code", 0, "Expected exit code of the test.")
+	parseTAP = flagset.Bool("tap", false, "Parse the standard output of the test as TAP.")
+	tmp      = flagset.Bool("tmp", false, "Run the test with a fresh temporary directory as HOME and TMPDIR.")
+	data     = flagset.String("data", "", "Space separated list of files to copy to the work directory, with -tmp.")
+	srcdir   = flagset.String("srcdir", "", "Directory the data files are relative to. Set as SRCDIR for the test.")
+	destroot = flagset.String("destroot", "", "Installation directory of the flavor. Set as DESTROOT for the test.")
+)
+
+// Number of lines of output shown when a test fails.
+const failureLines = 30
+
+func Main(args ...string) {
+	flagset.Usage = func() {
+		fmt.Fprintf(flagset.Output(), "Usage: %s -tool test-runner -stamp file -log file [options] [--] [VAR=value...] test [args...]\n", os.Args[0])
+		flagset.PrintDefaults()
+	}
+	flagset.Parse(args)
+	env, argv := command.SplitEnv(flagset.Args())
+	if len(argv) == 0 || *stamp == "" || *logfile == "" {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	os.Remove(*stamp)
+	output, err := run(env, argv)
+	if lerr := ioutil.WriteFile(*logfile, output, 0666); lerr != nil && err == nil {
+		err = lerr
+	}
+	if err == nil {
+		err = ioutil.WriteFile(*stamp, nil, 0666)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s, log in %s\n", argv[0], err, *logfile)
+		os.Stderr.Write(tail(output, failureLines))
+		os.Exit(1)
+	}
+}
+
+// Runs the test and checks the result, returning its output.
+func run(env, argv []string) ([]byte, error) {
+	bin := argv[0]
+	if _, err := os.Stat(bin); err == nil || strings.ContainsRune(bin, '/') {
+		// Relative to our directory, not the one the test is run in.
+		if abs, err := filepath.Abs(bin); err == nil {
+			bin = abs
+		}
+	}
+	var testenv []string
+	for _, v := range []struct{ name, path string }{{"SRCDIR", *srcdir}, {"DESTROOT", *destroot}} {
+		if v.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(v.path)
+		if err != nil {
+			return nil, err
+		}
+		testenv = append(testenv, v.name+"="+abs)
+	}
+	testdir := *dir
+	if *tmp {
+		tmpdir, err := ioutil.TempDir("", "seb-test")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmpdir)
+		work, err := setupTmp(tmpdir)
+		if err != nil {
+			return nil, err
+		}
+		if testdir == "" {
+			testdir = work
+		}
+		testenv = append(testenv, "HOME="+filepath.Join(tmpdir, "home"), "TMPDIR="+filepath.Join(tmpdir, "tmp"))
+	}
+
+	cmd := exec.Command(bin, argv[1:]...)
+	cmd.Dir = testdir
+	// The variables given to the test override ours.
+	cmd.Env = append(append(os.Environ(), testenv...), env...)
+	// In its own process group, so processes it starts are killed with it
+	// on timeout. They might otherwise keep the output open.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var output, stdout bytes.Buffer
+	// Both are written to the output, from different goroutines.
+	combined := &lockedWriter{w: &output}
+	cmd.Stdout = io.MultiWriter(combined, &stdout)
+	cmd.Stderr = combined
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	var timer *time.Timer
+	if *timeout > 0 {
+		timer = time.AfterFunc(*timeout, func() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+	}
+	err := cmd.Wait()
+
+	if timer != nil && !timer.Stop() {
+		return output.Bytes(), fmt.Errorf("timed out after %s", *timeout)
+	}
+	code := 0
+	if exit, ok := err.(*exec.ExitError); ok {
+		code = exit.ExitCode()
+		if code < 0 {
+			return output.Bytes(), fmt.Errorf("killed: %s", exit)
+		}
+	} else if err != nil {
+		return output.Bytes(), err
+	}
+	if code != *exitCode {
+		return output.Bytes(), fmt.Errorf("exit code %d, expected %d", code, *exitCode)
+	}
+	if *parseTAP {
+		res, err := tap.Parse(&stdout)
+		if err == nil {
+			err = res.Err()
+		}
+		if err != nil {
+			return output.Bytes(), fmt.Errorf("TAP: %s", err)
+		}
+	}
+	return output.Bytes(), nil
+}
+
+// Creates the home, tmp and work directories, copying the data files to
+// work. Returns the work directory.
+func setupTmp(tmpdir string) (string, error) {
+	for _, d := range []string{"home", "tmp", "work"} {
+		if err := os.Mkdir(filepath.Join(tmpdir, d), 0700); err != nil {
+			return "", err
+		}
+	}
+	work := filepath.Join(tmpdir, "work")
+	for _, f := range strings.Fields(*data) {
+		rel, err := filepath.Rel(*srcdir, f)
+		if err != nil || strings.HasPrefix(rel, "../") {
+			rel = filepath.Base(f)
+		}
+		if err := copyFile(f, filepath.Join(work, rel)); err != nil {
+			return "", err
+		}
+	}
+	return work, nil
+}
+
+func copyFile(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, content, fi.Mode().Perm())
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// Returns the last n lines of the output.
+func tail(output []byte, n int) []byte {
+	output = bytes.TrimRight(output, "\n")
+	if len(output) == 0 {
+		return nil
+	}
+	idx := len(output)
+	for i := 0; i < n && idx > 0; i++ {
+		idx = bytes.LastIndexByte(output[:idx], '\n')
+		if idx < 0 {
+			return append(output, '\n')
+		}
+	}
+	return append(output[idx+1:], '\n')
+}
@@ -0,0 +1,44 @@
+// Copyright 2026 Schibsted
+
+package test_runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunTimeoutBackground(t *testing.T) {
+	*timeout = 200 * time.Millisecond
+	defer func() { *timeout = 0 }()
+
+	// The shell exits at once, but the sleep keeps the output open.
+	start := time.Now()
+	output, err := run(nil, []string{"/bin/sh", "-c", "echo started; sleep 30 & sleep 30"})
+	if err == nil || !strings.HasPrefix(err.Error(), "timed out") {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Timeout took %s", d)
+	}
+	if string(output) != "started\n" {
+		t.Errorf("Bad output %q", output)
+	}
+
+	start = time.Now()
+	if _, err := run(nil, []string{"/bin/sh", "-c", "sleep 30 & exit 0"}); err == nil || !strings.HasPrefix(err.Error(), "timed out") {
+		t.Errorf("Expected timeout with exited shell, got %v", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Timeout took %s", d)
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	if _, err := run(nil, []string{"/bin/sh", "-c", "exit 0"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := run(nil, []string{"/bin/sh", "-c", "exit 3"}); err == nil || err.Error() != "exit code 3, expected 0" {
+		t.Errorf("Bad exit code error %v", err)
+	}
+}
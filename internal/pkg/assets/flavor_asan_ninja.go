@@ -0,0 +1,11 @@
+// Copyright 2026 Schibsted
+
+package assets
+
+const FlavorAsanNinja = `
+# AddressSanitizer, works with both gcc and clang.
+sanitize_copts=-fsanitize=address -fno-omit-frame-pointer
+sanitize_ldopts=-fsanitize=address
+go_sanitize=asan
+sanitizer_env=ASAN_OPTIONS=detect_leaks=1:abort_on_error=1:strict_string_checks=1:detect_stack_use_after_return=1
+`
@@ -7,4 +7,6 @@ cwarnflags=-Wall -Werror -Wshadow -Wwrite-strings -Wpointer-arith -Wcast-align -
 # Additional flags for building with gcov support
 gcov_copts=-fprofile-arcs -ftest-coverage
 gcov_ldopts=-fprofile-arcs -ftest-coverage -lgcov
+# The notes files written next to the objects, restored by the action cache.
+gcov_cache_side=.gcno
 `
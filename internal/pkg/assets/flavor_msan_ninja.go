@@ -0,0 +1,11 @@
+// Copyright 2026 Schibsted
+
+package assets
+
+const FlavorMsanNinja = `
+# MemorySanitizer, only supported by clang.
+sanitize_copts=-fsanitize=memory -fsanitize-memory-track-origins -fno-omit-frame-pointer
+sanitize_ldopts=-fsanitize=memory
+go_sanitize=msan
+sanitizer_env=MSAN_OPTIONS=halt_on_error=1
+`
@@ -0,0 +1,12 @@
+// Copyright 2026 Schibsted
+
+package assets
+
+const FlavorTsanNinja = `
+# ThreadSanitizer, works with both gcc and clang. Go uses the race detector,
+# which is based on the same runtime.
+sanitize_copts=-fsanitize=thread -fno-omit-frame-pointer
+sanitize_ldopts=-fsanitize=thread
+go_sanitize=race
+sanitizer_env=TSAN_OPTIONS=halt_on_error=1:second_deadlock_stack=1 GORACE=halt_on_error=1
+`
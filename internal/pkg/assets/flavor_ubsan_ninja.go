@@ -0,0 +1,12 @@
+// Copyright 2026 Schibsted
+
+package assets
+
+const FlavorUbsanNinja = `
+# UndefinedBehaviorSanitizer, works with both gcc and clang. Go has no
+# equivalent so go_sanitize is left empty.
+sanitize_copts=-fsanitize=undefined -fno-sanitize-recover=undefined -fno-omit-frame-pointer
+sanitize_ldopts=-fsanitize=undefined
+go_sanitize=
+sanitizer_env=UBSAN_OPTIONS=print_stacktrace=1:halt_on_error=1
+`
@@ -3,22 +3,42 @@
 package assets
 
 const RulesNinja = `
+# $sandbox is set per build edge in sandboxed flavors, running the command
+# with only the declared inputs visible, see seb -tool sandbox.
+# $split_debug and $build_id_flags are set for the linked outputs in
+# split_debug flavors, see seb -tool split-debug. It wraps $action_cache so
+# the debug files are split out again after a cache hit.
 rule cxx
-    command = $cxx $picflag $flavor_cflags $cflags $cxxflags $cwarnflags $gcov_copts $copts $srcopts -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -c $in -o $out
+    command = SEB_CACHE_IN="$in $pch" SEB_CACHE_OUT="$out" SEB_CACHE_DEPFILE="$out.d" SEB_CACHE_SIDE="$gcov_cache_side" $action_cache $repro_env $sandbox $compiler_launcher $cxx $sysroot_flags $repro_copts $picflag $flavor_cflags $cflags $cxxflags $cwarnflags $gcov_copts $sanitize_copts $lto_copts $pgo_copts $copts $srcopts $pchflags -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -c $in -o $out
     depfile = $out.d
     description = C++ compile $out
 
 rule cc
-    command = $cc $picflag $flavor_cflags $cflags $conlyflags $cwarnflags $gcov_copts $copts $srcopts -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -c $in -o $out
+    command = SEB_CACHE_IN="$in $pch" SEB_CACHE_OUT="$out" SEB_CACHE_DEPFILE="$out.d" SEB_CACHE_SIDE="$gcov_cache_side" $action_cache $repro_env $sandbox $compiler_launcher $cc $sysroot_flags $repro_copts $picflag $flavor_cflags $cflags $conlyflags $cwarnflags $gcov_copts $sanitize_copts $lto_copts $pgo_copts $copts $srcopts $pchflags -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -c $in -o $out
     depfile = $out.d
     description = C compile $out
 
+rule cxx_pch
+    command = $repro_env $sandbox $compiler_launcher $cxx $sysroot_flags $repro_copts $picflag $flavor_cflags $cflags $cxxflags $cwarnflags $gcov_copts $sanitize_copts $lto_copts $pgo_copts $copts $srcopts -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -x c++-header -c $in -o $out
+    depfile = $out.d
+    description = C++ precompile $out
+
+rule cc_pch
+    command = $repro_env $sandbox $compiler_launcher $cc $sysroot_flags $repro_copts $picflag $flavor_cflags $cflags $conlyflags $cwarnflags $gcov_copts $sanitize_copts $lto_copts $pgo_copts $copts $srcopts -I. -I$incdir $includes $defines -MMD -MF $out.d -MT $out -x c-header -c $in -o $out
+    depfile = $out.d
+    description = C precompile $out
+
+rule unity
+    command = for f in $in; do echo "#include \"$$f\""; done > $out.tmp && if cmp -s $out.tmp $out; then rm $out.tmp; else mv $out.tmp $out; fi
+    restat = 1
+    description = Unity source $out
+
 rule cxx_analyse
-    command = rm -rf $out ; mkdir -p $out ; clang++ $analyser_flags $picflag $flavor_cflags $cflags $cxxflags $cwarnflags $gcov_copts $copts $srcopts -I. -I$incdir $includes $defines $in -o $out
+    command = rm -rf $out ; mkdir -p $out ; clang++ $analyser_flags $picflag $flavor_cflags $cflags $cxxflags $cwarnflags $gcov_copts $copts $srcopts $pchflags -I. -I$incdir $includes $defines $in -o $out
     description = C++ analyse $out
 
 rule cc_analyse
-    command = rm -rf $out ; mkdir -p $out ; clang $analyser_flags $picflag $flavor_cflags $cflags $conlyflags $cwarnflags $gcov_copts $copts $srcopts -I. -I$incdir $includes $defines $in -o $out
+    command = rm -rf $out ; mkdir -p $out ; clang $analyser_flags $picflag $flavor_cflags $cflags $conlyflags $cwarnflags $gcov_copts $copts $srcopts $pchflags -I. -I$incdir $includes $defines $in -o $out
     description = C analyse $out
 
 rule copy_analyse
@@ -31,33 +51,65 @@ rule final_analyse
 
 link_wrapper = seb -tool link
 rule linkxx
-    command = $link_wrapper $cxx $ldflags $ldopts $gcov_ldopts -L $libdir -o $out @$out.rsp $ldlibs
+    command = SEB_CACHE_IN="@$out.rsp" SEB_CACHE_OUT="$out" $split_debug $action_cache $sandbox $link_wrapper $compiler_launcher $cxx $sysroot_flags $ldflags $build_id_flags $ldopts $gcov_ldopts $sanitize_ldopts $lto_ldopts $pgo_ldopts -L $libdir -o $out @$out.rsp $ldlibs
     description = link $out
     rspfile = $out.rsp
     rspfile_content = $in
 
 rule link
-    command = $link_wrapper $cc $ldflags $ldopts $gcov_ldopts -L $libdir -o $out @$out.rsp $ldlibs
+    command = SEB_CACHE_IN="@$out.rsp" SEB_CACHE_OUT="$out" $split_debug $action_cache $sandbox $link_wrapper $compiler_launcher $cc $sysroot_flags $ldflags $build_id_flags $ldopts $gcov_ldopts $sanitize_ldopts $lto_ldopts $pgo_ldopts -L $libdir -o $out @$out.rsp $ldlibs
     description = link $out
     rspfile = $out.rsp
     rspfile_content = $in
 
 rule partiallink
-    command = $link_wrapper ld -r -o $out @$out.rsp
+    command = $sandbox $link_wrapper $ld -r -o $out @$out.rsp
     description = partially linking $out
     rspfile = $out.rsp
     rspfile_content = $in
 
 rule ar
-    command = ar cr $out $in
+    command = $sandbox $ar cr$ar_modifiers $out $in
     description = ar library $out
 
+rule version_script
+    command = seb -tool exports -version-script $in $out
+    description = version script $out
+
+rule exports_check
+    command = seb -tool exports -check $in $out
+    description = checking exports of $out
+
+rule size_check
+    command = seb -tool size-report -budget=$size_budget $in $out
+    description = checking size of $in
+
+rule ctest
+    command = seb -tool test-runner -stamp=$out -log=$out.log $test_flags -- $sanitizer_env $test_env $in $test_args
+    description = running test $in
+
+rule test_script
+    command = seb -tool test-runner -stamp=$out -log=$out.log $test_flags -- $sanitizer_env $test_env $in $test_args
+    description = running test script $in
+
+rule fuzz_prog
+    command = mkdir -p $fuzzdir-corpus $fuzzdir-crashes && seb -tool test-runner -stamp=$out -log=$out.log -- $sanitizer_env $test_env $in $test_args
+    description = fuzzing $in
+
+rule pgo_train
+    command = abs=$$(cd $$(dirname $in) && pwd)/$$(basename $in) && ( cd $train_dir && $sanitizer_env $$abs $train_args ) && touch $out
+    description = PGO training run of $in
+
+rule pgo_merge
+    command = seb -tool pgo-merge -compiler=$pgo_compiler -profdata="$profdata" -from=$pgo_from -to=$pgo_to $pgo_data $out
+    description = PGO merging profile $out
+
 rule flexx
-    command = flex -+ -o$out $in
+    command = SEB_CACHE_IN="$in" SEB_CACHE_OUT="$out" $action_cache $sandbox flex -+ -o$out $in
     description = lex $out
 
 rule yaccxx
-    command = bison -y -d --debug -o $out $in
+    command = SEB_CACHE_IN="$in" SEB_CACHE_OUT="$out" SEB_CACHE_SIDE=".hh" $action_cache $sandbox bison -y -d --debug -o $out $in
     description = yacc $out
 
 rule install_conf
@@ -100,7 +152,7 @@ rule gperf_switch
     description = gperf_enum $out
 
 rule gperf
-    command = gperf -L ANSI-C --output-file=$out $in
+    command = SEB_CACHE_IN="$in" SEB_CACHE_OUT="$out" $action_cache $sandbox gperf -L ANSI-C --output-file=$out $in
     description = gperf $out
 
 rule build_version
@@ -122,38 +174,69 @@ pool gobuilds_piclib
 # variables if not set there however.  This is for dependencies to work more
 # properly as configvars script changes retrigger builds but environment
 # variables do not.
+# Rules prefixed with $action_cache can be restored from the action cache, see
+# seb -tool cache. The SEB_CACHE_* variables tell it the inputs and outputs.
+# The depfile doesn't list GOROOT, so the go version is part of the key.
 # Note that for gobuild the depfile is only used if enabled. By default
 # the commands are always run and instead use the Go build cache.
-gobuild_tool=GOBUILD_FLAGS=$gobuild_flags GOBUILD_TEST_FLAGS=$gobuild_test_flags CGO_ENABLED=$cgo_enabled seb -tool gobuild
+gobuild_tool=GOWORK=$gowork $go_offline_env GOBUILD_FLAGS="$gobuild_flags" GOBUILD_TEST_FLAGS="$gobuild_test_flags" CGO_ENABLED=$cgo_enabled seb -tool gobuild
 
 rule gobuild
-    command = GOOS="$goos" GOARCH="$goarch" $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=$gomode -pkgdir="$builddir" "$in" "$out" "$objdir/depfile-$gomode"
+    command = SEB_CACHE_IN="$in" SEB_CACHE_OUT="$out" SEB_CACHE_DEPFILE="$objdir/depfile-$gomode" SEB_CACHE_VERSION="go version" $split_debug $action_cache GOOS="$goos" GOARCH="$goarch" CC="$cc" CXX="$cxx" $gobuild_tool $build_id_flags -sanitize="$go_sanitize" -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" $go_version_flags -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=$gomode -pkgdir="$builddir" "$in" "$out" "$objdir/depfile-$gomode"
     depfile = $objdir/depfile-$gomode
     description = building go $gomode $out from $in
 
+rule go_version
+    command = go version > $out.tmp && if cmp -s $out.tmp $out; then rm $out.tmp; else mv $out.tmp $out; fi
+    restat = 1
+    description = Checking go version
+
+# Checks that the vendor directories are in sync with go.mod and contain the
+# imported packages, for offline builds.
+rule go_vendor_check
+    command = for d in $gomoddirs; do (cd $$d && GOWORK=off GOFLAGS=-mod=vendor GOPROXY=off go list -deps -test ./... > /dev/null) || exit 1; done && touch $out
+    description = Checking the Go vendor directories
+
 rule gobuildlib
-    command = GOOS="$goos" GOARCH="$goarch" $gobuild_tool -pkg="$gopkg" -cflags="$picflag -I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=$gomode -pkgdir="$builddir" $gonoinit "$in" "$out" "$depfile"
+    command = SEB_CACHE_IN="$in" SEB_CACHE_OUT="$out" SEB_CACHE_DEPFILE="$depfile" SEB_CACHE_VERSION="go version" $action_cache GOOS="$goos" GOARCH="$goarch" CC="$cc" CXX="$cxx" $gobuild_tool -sanitize="$go_sanitize" -pkg="$gopkg" -cflags="$picflag -I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=$gomode -pkgdir="$builddir" $gonoinit "$in" "$out" "$depfile"
     depfile = $depfile
     description = building go library $out from $in
     pool = gobuilds_$gomode
 
 rule gotest
-    command = $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=test -pkgdir="$builddir" "$in"
+    command = $sanitizer_env $gobuild_tool -sanitize="$go_sanitize" -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=test -pkgdir="$builddir" -report="$out" "$in"
     description = testing go package in $in
 
 rule gobench
-    command = $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=bench -pkgdir="$builddir" "$in" "$benchflags"
+    command = $sanitizer_env $gobuild_tool -sanitize="$go_sanitize" -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" -cflags="-I $incdir $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=bench -pkgdir="$builddir" "$in" "$benchflags"
     description = benching go package in $in
 
+rule gofuzz
+    command = $sanitizer_env $gobuild_tool -sanitize="$go_sanitize" -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=fuzz -fuzz="$gofuzz" -fuzztime="$fuzztime" -pkgdir="$builddir" "$in"
+    description = fuzzing $gofuzz in go package in $in
+
 rule gocover
-    command = $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=cover -pkgdir="$builddir" "$in" "$out" "$objdir/depfile-cover"
+    command = $sanitizer_env $gobuild_tool -sanitize="$go_sanitize" -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=cover -coverpkg="$gocoverpkg" -pkgdir="$builddir" "$in" "$out" "$objdir/depfile-cover"
     depfile = $objdir/depfile-cover
     description = testing coverage of go package in $in
 
+rule govet
+    command = $gobuild_tool -pkg="$gopkg" -tags="$gotags" -gcflags="$gcflags" -goldflags="$go_ldflags" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=vet -pkgdir="$builddir" "$in" "$out" "$objdir/depfile-vet"
+    depfile = $objdir/depfile-vet
+    description = vetting go package in $in
+
 rule gocover_html
-    command = $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=cover_html -pkgdir="$builddir" "$in" "$out"
+    command = $gobuild_tool -pkg="$gopkg" -cflags="-I $incdir $includes $platform_includes" -ldflags="-L $libdir $ldlibs" -mode=cover_html -moddirs="$gomoddirs" -pkgdir="$builddir" "$in" "$out"
     description = coverage to html of go package in $in
 
+rule gcov_report
+    command = seb -tool gcov-report $gcov_flags $buildflavor
+    description = generating C and C++ coverage report
+
+rule gocover_merge
+    command = seb -tool gocover-merge -o=$out $gocover_flags $in
+    description = merging go coverage profiles
+
 rule goaddmain
     command = seb -tool asset -out "$out" main.go
     description = setup go main package $out
@@ -195,7 +278,7 @@ rule ronn
 # depend on paths defined by per-flavor ninja files.
 
 rule in
-    command = seb -tool in "$inconf" $in $out
+    command = SEB_CACHE_IN="$inconf $in" SEB_CACHE_OUT="$out" $action_cache $sandbox seb -tool in "$inconf" $in $out
     restat=1
 
 rule inconfig
@@ -0,0 +1,54 @@
+// Copyright 2026 Schibsted
+
+// Package command runs the commands given to the wrapper tools, like
+// seb -tool cache, that are placed in front of ninja rule commands.
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SplitEnv splits off leading VAR=value arguments, which the shell would
+// have treated as environment variables if the wrapper hadn't been there.
+func SplitEnv(argv []string) (env, rest []string) {
+	for len(argv) > 0 && isAssignment(argv[0]) {
+		env = append(env, argv[0])
+		argv = argv[1:]
+	}
+	return env, argv
+}
+
+func isAssignment(arg string) bool {
+	eq := strings.IndexByte(arg, '=')
+	if eq <= 0 {
+		return false
+	}
+	for _, c := range arg[:eq] {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Run runs the command with the extra environment variables and our
+// standard input and output, returning the exit code.
+func Run(env, argv []string) int {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run %s: %s\n", argv[0], err)
+		return 1
+	}
+	return 0
+}
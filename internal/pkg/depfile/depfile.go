@@ -0,0 +1,50 @@
+// Copyright 2026 Schibsted
+
+// Package depfile reads the makefile style depfiles written by compilers.
+package depfile
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Parse returns all the prerequisites in the depfile, sorted.
+func Parse(data []byte) []string {
+	data = bytes.ReplaceAll(data, []byte("\\\n"), []byte(" "))
+	var deps []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, len(data)+1)
+	for s.Scan() {
+		line := s.Text()
+		col := strings.Index(line, ": ")
+		if col < 0 {
+			if !strings.HasSuffix(line, ":") {
+				continue
+			}
+			col = len(line) - 1
+		}
+		var cur strings.Builder
+		rest := line[col+1:]
+		for i := 0; i < len(rest); i++ {
+			switch c := rest[i]; {
+			case c == '\\' && i+1 < len(rest) && rest[i+1] == ' ':
+				cur.WriteByte(' ')
+				i++
+			case c == ' ' || c == '\t':
+				if cur.Len() > 0 {
+					deps = append(deps, cur.String())
+					cur.Reset()
+				}
+			default:
+				cur.WriteByte(c)
+			}
+		}
+		if cur.Len() > 0 {
+			deps = append(deps, cur.String())
+		}
+	}
+	sort.Strings(deps)
+	return deps
+}
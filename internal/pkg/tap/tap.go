@@ -0,0 +1,88 @@
+// Copyright 2026 Schibsted
+
+// Package tap parses the Test Anything Protocol output of tests.
+package tap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Result struct {
+	Planned int // Number of tests in the plan, -1 if there was none.
+	Passed  int
+	Failed  []string // Descriptions of the failed tests, excluding TODO ones.
+	Skipped int
+	Todo    int
+	BailOut string // Reason given by Bail out!, if any.
+}
+
+// Parse reads TAP output. Lines that aren't part of the protocol, like
+// diagnostics and other output from the test, are ignored.
+func Parse(r io.Reader) (*Result, error) {
+	res := &Result{Planned: -1}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "1.."):
+			n := line[3:]
+			if i := strings.IndexAny(n, " #"); i >= 0 {
+				n = n[:i]
+			}
+			if planned, err := strconv.Atoi(n); err == nil {
+				res.Planned = planned
+			}
+		case strings.HasPrefix(line, "Bail out!"):
+			res.BailOut = strings.TrimSpace(line[len("Bail out!"):])
+			if res.BailOut == "" {
+				res.BailOut = "no reason given"
+			}
+		case line == "ok" || strings.HasPrefix(line, "ok "):
+			if dir := directive(line); strings.HasPrefix(dir, "SKIP") {
+				res.Skipped++
+			} else {
+				res.Passed++
+			}
+		case line == "not ok" || strings.HasPrefix(line, "not ok "):
+			if dir := directive(line); strings.HasPrefix(dir, "TODO") {
+				res.Todo++
+			} else if strings.HasPrefix(dir, "SKIP") {
+				res.Skipped++
+			} else {
+				res.Failed = append(res.Failed, strings.TrimSpace(strings.TrimPrefix(line, "not ok")))
+			}
+		}
+	}
+	return res, scanner.Err()
+}
+
+// Returns the upper case directive after #, if any.
+func directive(line string) string {
+	i := strings.Index(line, "#")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(line[i+1:]))
+}
+
+// Err returns an error describing why the tests failed, or nil if they
+// all passed.
+func (res *Result) Err() error {
+	ran := res.Passed + len(res.Failed) + res.Skipped + res.Todo
+	switch {
+	case res.BailOut != "":
+		return fmt.Errorf("bailed out: %s", res.BailOut)
+	case len(res.Failed) > 0:
+		return fmt.Errorf("%d of %d tests failed: %s", len(res.Failed), ran, strings.Join(res.Failed, ", "))
+	case res.Planned < 0:
+		return fmt.Errorf("no test plan found")
+	case ran != res.Planned:
+		return fmt.Errorf("planned %d tests but ran %d", res.Planned, ran)
+	}
+	return nil
+}
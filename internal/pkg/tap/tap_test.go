@@ -0,0 +1,118 @@
+// Copyright 2026 Schibsted
+
+package tap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		input  string
+		expt   Result
+		expErr string
+	}{
+		{
+			name:  "pass",
+			input: "1..3\nok 1 - first\nok 2\nok\n",
+			expt:  Result{Planned: 3, Passed: 3},
+		},
+		{
+			name:  "plan last",
+			input: "ok 1\r\nok 2\r\n1..2\r\n",
+			expt:  Result{Planned: 2, Passed: 2},
+		},
+		{
+			name:   "failed",
+			input:  "1..3\nok 1 - first\nnot ok 2 - second\nnot ok 3\n",
+			expt:   Result{Planned: 3, Passed: 1, Failed: []string{"2 - second", "3"}},
+			expErr: "2 of 3 tests failed: 2 - second, 3",
+		},
+		{
+			name:  "directives",
+			input: "1..5\nok 1 - a # SKIP no network\nnot ok 2 - b # TODO later\nnot ok 3 # skip\nok 4 # todo passes anyway\nok 5 - c#d\n",
+			expt:  Result{Planned: 5, Passed: 2, Skipped: 2, Todo: 1},
+		},
+		{
+			name:  "diagnostics",
+			input: "# Running tests\n1..1\nsome output\n  ---\n  message: fine\n  ...\nok 1\nokay not a result\n",
+			expt:  Result{Planned: 1, Passed: 1},
+		},
+		{
+			name:  "skip all",
+			input: "1..0 # Skipped: not supported here\n",
+			expt:  Result{Planned: 0},
+		},
+		{
+			name:   "bail out",
+			input:  "1..3\nok 1\nBail out! Database unreachable\n",
+			expt:   Result{Planned: 3, Passed: 1, BailOut: "Database unreachable"},
+			expErr: "bailed out: Database unreachable",
+		},
+		{
+			name:   "bail out without reason",
+			input:  "1..3\nnot ok 1\nBail out!\n",
+			expt:   Result{Planned: 3, Failed: []string{"1"}, BailOut: "no reason given"},
+			expErr: "bailed out: no reason given",
+		},
+		{
+			name:   "missing plan",
+			input:  "ok 1\nok 2\n",
+			expt:   Result{Planned: -1, Passed: 2},
+			expErr: "no test plan found",
+		},
+		{
+			name:   "bad plan",
+			input:  "1..x\nok 1\n",
+			expt:   Result{Planned: -1, Passed: 1},
+			expErr: "no test plan found",
+		},
+		{
+			name:   "short plan",
+			input:  "1..4\nok 1\nok 2 # SKIP\nnot ok 3 # TODO\n",
+			expt:   Result{Planned: 4, Passed: 1, Skipped: 1, Todo: 1},
+			expErr: "planned 4 tests but ran 3",
+		},
+		{
+			name:   "too many",
+			input:  "1..1\nok 1\nok 2\n",
+			expt:   Result{Planned: 1, Passed: 2},
+			expErr: "planned 1 tests but ran 2",
+		},
+		{
+			name:   "empty",
+			input:  "",
+			expt:   Result{Planned: -1},
+			expErr: "no test plan found",
+		},
+	} {
+		res, err := Parse(strings.NewReader(tc.input))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*res, tc.expt) {
+			t.Errorf("%s: got %+v, expected %+v", tc.name, *res, tc.expt)
+		}
+		err = res.Err()
+		if tc.expErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		} else if tc.expErr != "" && (err == nil || err.Error() != tc.expErr) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.expErr, err)
+		}
+	}
+}
+
+func TestParseLongLine(t *testing.T) {
+	input := "1..1\n# " + strings.Repeat("x", 512*1024) + "\nok 1\n"
+	res, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err() != nil {
+		t.Errorf("Unexpected error %v", res.Err())
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2026 Schibsted
+
+// Package testreport collects the events written by go test -json into test
+// reports, which can be written as JUnit XML or as a JSON summary.
+package testreport
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is a line of go test -json output, see go doc test2json.
+type Event struct {
+	Time        time.Time
+	Action      string
+	Package     string
+	Test        string
+	Elapsed     float64
+	Output      string
+	ImportPath  string
+	FailedBuild string
+}
+
+type Test struct {
+	Name    string  `json:"name"`
+	Result  string  `json:"result"` // pass, fail or skip
+	Elapsed float64 `json:"elapsed"`
+	Output  string  `json:"output,omitempty"` // Only kept for tests not passing.
+}
+
+type Package struct {
+	Name    string  `json:"package"`
+	Result  string  `json:"result"`
+	Elapsed float64 `json:"elapsed"`
+	Passed  int     `json:"passed"`
+	Failed  int     `json:"failed"`
+	Skipped int     `json:"skipped"`
+	Tests   []*Test `json:"tests"`
+	// Output not belonging to a test, only kept for failed packages. It
+	// has the build errors for packages that failed to build.
+	Output string `json:"output,omitempty"`
+}
+
+type Report struct {
+	Passed   int        `json:"passed"`
+	Failed   int        `json:"failed"`
+	Skipped  int        `json:"skipped"`
+	Packages []*Package `json:"packages"`
+}
+
+type testKey struct {
+	pkg, test string
+}
+
+// Collector builds a report from events.
+type Collector struct {
+	pkgs        map[string]*Package
+	tests       map[testKey]*Test
+	output      map[testKey]*strings.Builder
+	buildOutput map[string]*strings.Builder
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		pkgs:        make(map[string]*Package),
+		tests:       make(map[testKey]*Test),
+		output:      make(map[testKey]*strings.Builder),
+		buildOutput: make(map[string]*strings.Builder),
+	}
+}
+
+func (c *Collector) Add(ev *Event) {
+	if ev.Action == "build-output" {
+		if c.buildOutput[ev.ImportPath] == nil {
+			c.buildOutput[ev.ImportPath] = &strings.Builder{}
+		}
+		c.buildOutput[ev.ImportPath].WriteString(ev.Output)
+		return
+	}
+	if ev.Package == "" {
+		return
+	}
+	pkg := c.pkgs[ev.Package]
+	if pkg == nil {
+		pkg = &Package{Name: ev.Package}
+		c.pkgs[ev.Package] = pkg
+	}
+	key := testKey{ev.Package, ev.Test}
+	if ev.Action == "output" {
+		if c.output[key] == nil {
+			c.output[key] = &strings.Builder{}
+		}
+		c.output[key].WriteString(ev.Output)
+		return
+	}
+	switch ev.Action {
+	case "run", "pass", "fail", "skip":
+	default:
+		return
+	}
+	if ev.Test == "" {
+		pkg.Result = ev.Action
+		pkg.Elapsed = ev.Elapsed
+		if ev.FailedBuild != "" && c.buildOutput[ev.FailedBuild] != nil {
+			c.prependOutput(testKey{ev.Package, ""}, c.buildOutput[ev.FailedBuild].String())
+		}
+		return
+	}
+	t := c.tests[key]
+	if t == nil {
+		t = &Test{Name: ev.Test}
+		c.tests[key] = t
+		pkg.Tests = append(pkg.Tests, t)
+	}
+	if ev.Action != "run" {
+		t.Result = ev.Action
+		t.Elapsed = ev.Elapsed
+	}
+}
+
+func (c *Collector) prependOutput(key testKey, s string) {
+	b := c.output[key]
+	if b == nil {
+		b = &strings.Builder{}
+		c.output[key] = b
+	}
+	// Build errors come first, like when not using -json.
+	old := b.String()
+	b.Reset()
+	b.WriteString(s)
+	b.WriteString(old)
+}
+
+// Output returns the output collected so far for a test, or for the
+// package if test is empty.
+func (c *Collector) Output(pkg, test string) string {
+	if b := c.output[testKey{pkg, test}]; b != nil {
+		return b.String()
+	}
+	return ""
+}
+
+// Report returns the report of the events added. Packages and tests that
+// didn't finish, e.g. because of a timeout, are failed.
+func (c *Collector) Report() *Report {
+	rep := &Report{}
+	for _, pkg := range c.pkgs {
+		if pkg.Result == "" {
+			pkg.Result = "fail"
+		}
+		for _, t := range pkg.Tests {
+			if t.Result == "" {
+				t.Result = "fail"
+			}
+			if t.Result != "pass" {
+				t.Output = c.Output(pkg.Name, t.Name)
+			}
+		}
+		if pkg.Result == "fail" {
+			pkg.Output = c.Output(pkg.Name, "")
+		}
+		rep.Packages = append(rep.Packages, pkg)
+	}
+	rep.count()
+	return rep
+}
+
+// Merge returns a report with the packages of all the reports.
+func Merge(reports ...*Report) *Report {
+	rep := &Report{}
+	for _, r := range reports {
+		rep.Packages = append(rep.Packages, r.Packages...)
+	}
+	rep.count()
+	return rep
+}
+
+// Sorts the packages and counts the results.
+func (rep *Report) count() {
+	sort.SliceStable(rep.Packages, func(i, j int) bool {
+		return rep.Packages[i].Name < rep.Packages[j].Name
+	})
+	rep.Passed, rep.Failed, rep.Skipped = 0, 0, 0
+	for _, pkg := range rep.Packages {
+		pkg.Passed, pkg.Failed, pkg.Skipped = 0, 0, 0
+		for _, t := range pkg.Tests {
+			switch t.Result {
+			case "pass":
+				pkg.Passed++
+			case "fail":
+				pkg.Failed++
+			case "skip":
+				pkg.Skipped++
+			}
+		}
+		rep.Passed += pkg.Passed
+		rep.Failed += pkg.Failed
+		rep.Skipped += pkg.Skipped
+	}
+}
+
+func ReadJSON(r io.Reader) (*Report, error) {
+	rep := &Report{}
+	if err := json.NewDecoder(r).Decode(rep); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (rep *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(rep)
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",cdata"`
+}
+
+func junitTime(secs float64) string {
+	return fmt.Sprintf("%.3f", secs)
+}
+
+// WriteJUnit writes the report with a testsuite per package. A package
+// failing outside of its tests, e.g. by not building, gets an error.
+func (rep *Report) WriteJUnit(w io.Writer) error {
+	suites := junitSuites{
+		Tests:    rep.Passed + rep.Failed + rep.Skipped,
+		Failures: rep.Failed,
+		Skipped:  rep.Skipped,
+	}
+	for _, pkg := range rep.Packages {
+		suite := junitSuite{
+			Name:     pkg.Name,
+			Tests:    len(pkg.Tests),
+			Failures: pkg.Failed,
+			Skipped:  pkg.Skipped,
+			Time:     junitTime(pkg.Elapsed),
+		}
+		for _, t := range pkg.Tests {
+			tc := junitCase{Classname: pkg.Name, Name: t.Name, Time: junitTime(t.Elapsed)}
+			switch t.Result {
+			case "fail":
+				tc.Failure = &junitMessage{"Failed", t.Output}
+			case "skip":
+				tc.Skipped = &junitMessage{"Skipped", t.Output}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		if pkg.Result == "fail" && pkg.Failed == 0 {
+			suite.Tests++
+			suite.Errors++
+			suite.Cases = append(suite.Cases, junitCase{
+				Classname: pkg.Name,
+				Name:      "(package)",
+				Time:      junitTime(pkg.Elapsed),
+				Error:     &junitMessage{"Package failed", pkg.Output},
+			})
+			suites.Tests++
+			suites.Errors++
+		}
+		suites.Suites = append(suites.Suites, suite)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
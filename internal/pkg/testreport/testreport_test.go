@@ -0,0 +1,226 @@
+// Copyright 2026 Schibsted
+
+package testreport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Reads a recorded go test -json stream from testdata.
+func collect(t *testing.T, names ...string) *Collector {
+	c := NewCollector()
+	for _, name := range names {
+		f, err := os.Open(filepath.Join("testdata", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var ev Event
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				t.Fatal(err)
+			}
+			c.Add(&ev)
+		}
+		f.Close()
+	}
+	return c
+}
+
+type testResult struct {
+	name, result string
+}
+
+func results(pkg *Package) []testResult {
+	var ret []testResult
+	for _, t := range pkg.Tests {
+		ret = append(ret, testResult{t.Name, t.Result})
+	}
+	return ret
+}
+
+func TestCollector(t *testing.T) {
+	rep := collect(t, "ok", "fail", "skip").Report()
+
+	var names []string
+	for _, pkg := range rep.Packages {
+		names = append(names, pkg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"example.com/rec/fail", "example.com/rec/ok", "example.com/rec/skip"}) {
+		t.Fatalf("Bad packages %v", names)
+	}
+	if rep.Passed != 5 || rep.Failed != 5 || rep.Skipped != 1 {
+		t.Errorf("Bad counts %d passed, %d failed, %d skipped", rep.Passed, rep.Failed, rep.Skipped)
+	}
+
+	fail := rep.Packages[0]
+	expt := []testResult{
+		{"TestPass", "pass"},
+		{"TestSub", "fail"},
+		{"TestSub/b", "fail"},
+		{"TestSub/a", "fail"},
+		{"TestSub/a/nested", "fail"},
+		{"TestSub/c", "pass"},
+		{"TestTop", "fail"},
+	}
+	if got := results(fail); !reflect.DeepEqual(got, expt) {
+		t.Errorf("Bad tests %v", got)
+	}
+	if fail.Result != "fail" || fail.Elapsed != 0.003 || fail.Passed != 2 || fail.Failed != 5 {
+		t.Errorf("Bad package %#v", fail)
+	}
+	if out := fail.Tests[2].Output; out != "=== RUN   TestSub/b\n    fail_test.go:9: b failed\n--- FAIL: TestSub/b (0.00s)\n" {
+		t.Errorf("Bad failed test output %q", out)
+	}
+	if out := fail.Tests[0].Output; out != "" {
+		t.Errorf("Output kept for passed test %q", out)
+	}
+	if fail.Output != "FAIL\nFAIL\texample.com/rec/fail\t0.003s\n" {
+		t.Errorf("Bad package output %q", fail.Output)
+	}
+
+	ok := rep.Packages[1]
+	if ok.Result != "pass" || ok.Output != "" || ok.Passed != 2 {
+		t.Errorf("Bad passed package %#v", ok)
+	}
+	skip := rep.Packages[2]
+	if got := results(skip); !reflect.DeepEqual(got, []testResult{{"TestSkipped", "skip"}, {"TestRun", "pass"}}) {
+		t.Errorf("Bad skipped tests %v", got)
+	}
+	if out := skip.Tests[0].Output; !strings.Contains(out, "skip_test.go:6: not today\n") {
+		t.Errorf("Bad skipped test output %q", out)
+	}
+}
+
+func TestCollectorBuildFailed(t *testing.T) {
+	rep := collect(t, "broken").Report()
+	if len(rep.Packages) != 1 {
+		t.Fatalf("Bad packages %#v", rep.Packages)
+	}
+	pkg := rep.Packages[0]
+	if pkg.Result != "fail" || len(pkg.Tests) != 0 {
+		t.Errorf("Bad package %#v", pkg)
+	}
+	// The build errors come before the package result.
+	expt := "# example.com/rec/broken [example.com/rec/broken.test]\nbroken/broken_test.go:6:2: undefined: undefined\nFAIL\texample.com/rec/broken [build failed]\n"
+	if pkg.Output != expt {
+		t.Errorf("Bad package output %q", pkg.Output)
+	}
+}
+
+func TestCollectorTimeout(t *testing.T) {
+	rep := collect(t, "slow").Report()
+	pkg := rep.Packages[0]
+	// The test running at the timeout never finishes.
+	if got := results(pkg); !reflect.DeepEqual(got, []testResult{{"TestFast", "pass"}, {"TestSlow", "fail"}}) {
+		t.Errorf("Bad tests %v", got)
+	}
+	if out := pkg.Tests[1].Output; !strings.Contains(out, "panic: test timed out after 1s\n") {
+		t.Errorf("Bad timed out test output %q", out)
+	}
+	if pkg.Result != "fail" || rep.Failed != 1 {
+		t.Errorf("Bad package %#v", pkg)
+	}
+}
+
+func TestCollectorUnfinished(t *testing.T) {
+	c := NewCollector()
+	c.Add(&Event{Action: "run", Package: "example.com/p", Test: "TestHang"})
+	c.Add(&Event{Action: "output", Package: "example.com/p", Test: "TestHang", Output: "killed\n"})
+	rep := c.Report()
+	pkg := rep.Packages[0]
+	if pkg.Result != "fail" || pkg.Tests[0].Result != "fail" || pkg.Tests[0].Output != "killed\n" {
+		t.Errorf("Unfinished package not failed %#v", pkg)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := collect(t, "skip", "broken").Report()
+	b := collect(t, "ok").Report()
+	rep := Merge(a, b)
+
+	var names []string
+	for _, pkg := range rep.Packages {
+		names = append(names, pkg.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"example.com/rec/broken", "example.com/rec/ok", "example.com/rec/skip"}) {
+		t.Errorf("Bad merged packages %v", names)
+	}
+	if rep.Passed != 3 || rep.Failed != 0 || rep.Skipped != 1 {
+		t.Errorf("Bad merged counts %d passed, %d failed, %d skipped", rep.Passed, rep.Failed, rep.Skipped)
+	}
+
+	// Reports are merged after being read back from the JSON summaries.
+	var buf bytes.Buffer
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, rep) {
+		t.Errorf("Report changed by JSON round trip")
+	}
+	if again := Merge(read); !reflect.DeepEqual(again, rep) {
+		t.Errorf("Merging a single report changed it")
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	rep := collect(t, "broken", "skip", "slow").Report()
+	var buf bytes.Buffer
+	if err := rep.WriteJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("Missing XML header")
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 5 || suites.Failures != 1 || suites.Errors != 1 || suites.Skipped != 1 {
+		t.Errorf("Bad totals %d tests, %d failures, %d errors, %d skipped", suites.Tests, suites.Failures, suites.Errors, suites.Skipped)
+	}
+	if len(suites.Suites) != 3 {
+		t.Fatalf("Bad suites %#v", suites.Suites)
+	}
+
+	// A package that doesn't build gets an error with the build output.
+	broken := suites.Suites[0]
+	if broken.Name != "example.com/rec/broken" || broken.Tests != 1 || broken.Errors != 1 || len(broken.Cases) != 1 {
+		t.Fatalf("Bad build failure suite %#v", broken)
+	}
+	if tc := broken.Cases[0]; tc.Name != "(package)" || tc.Error == nil || !strings.Contains(tc.Error.Body, "undefined: undefined") {
+		t.Errorf("Bad build failure case %#v", tc)
+	}
+
+	skip := suites.Suites[1]
+	if skip.Tests != 2 || skip.Skipped != 1 || skip.Failures != 0 {
+		t.Errorf("Bad skip suite %#v", skip)
+	}
+	if tc := skip.Cases[0]; tc.Name != "TestSkipped" || tc.Skipped == nil || tc.Failure != nil || !strings.Contains(tc.Skipped.Body, "not today") {
+		t.Errorf("Bad skipped case %#v", tc)
+	}
+	if tc := skip.Cases[1]; tc.Skipped != nil || tc.Failure != nil || tc.Error != nil {
+		t.Errorf("Bad passed case %#v", tc)
+	}
+
+	// The timed out test fails, and the package isn't an error on top.
+	slow := suites.Suites[2]
+	if slow.Tests != 2 || slow.Failures != 1 || slow.Errors != 0 || slow.Time != "1.004" {
+		t.Errorf("Bad timeout suite %#v", slow)
+	}
+	if tc := slow.Cases[1]; tc.Name != "TestSlow" || tc.Failure == nil || !strings.Contains(tc.Failure.Body, "panic: test timed out") {
+		t.Errorf("Bad timed out case %#v", tc)
+	}
+}
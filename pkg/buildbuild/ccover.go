@@ -0,0 +1,53 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returns true if the flavor is, or inherits from, the gcov flavor.
+func (ops *GlobalOps) isGcovFlavor(flavor string) bool {
+	for _, fl := range ops.FlavorChain(flavor) {
+		if fl == "gcov" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the gcov matching the compiler, e.g. gcov-12 for gcc-12 or
+// llvm-cov-14 gcov for clang-14.
+func gcovTool(cc, compilerFlavor string) string {
+	if fields := strings.Fields(cc); len(fields) > 0 {
+		if idx := strings.LastIndex(fields[0], "gcc"); idx >= 0 {
+			return fields[0][:idx] + "gcov" + fields[0][idx+3:]
+		}
+	}
+	if compilerFlavor == "clang" {
+		if cc == "" {
+			cc = "clang"
+		}
+		return compilerTool(cc, compilerFlavor, "", "cov") + " gcov"
+	}
+	return "gcov"
+}
+
+// Outputs the ccover target of gcov flavors, making a coverage report of the
+// C and C++ code after running the tests built by the check target. It's
+// always rerun since ninja doesn't know which programs have been run.
+func (ops *GlobalOps) outputCCover(w io.Writer, flavor, destdir string, checks []string) {
+	if !ops.isGcovFlavor(flavor) {
+		return
+	}
+	cc, compilerFlavor := ops.FlavorCompiler(flavor)
+	stamp := "$destroot/ccover/coverage.info.phony"
+	fmt.Fprintf(w, "build %s: gcov_report", stamp)
+	if len(checks) > 0 {
+		fmt.Fprintf(w, " | %s", strings.Join(checks, " "))
+	}
+	fmt.Fprintf(w, "\n    gcov_flags=-buildpath=%s -gcov=\"%s\" -out=$destroot/ccover\n", ops.Config.Buildpath, gcovTool(cc, compilerFlavor))
+	fmt.Fprintf(w, "build %s/ccover: phony %s\n", destdir, stamp)
+}
@@ -143,6 +143,7 @@ func (ops *GlobalOps) FindCompilerCC() error {
 			minv = cc[col+1:]
 			cc = cc[:col]
 		}
+		cc = ops.stripCompilerLauncher(cc)
 		ccv := append(strings.Split(cc, " "), "-v")
 		cmd := exec.Command(ccv[0], ccv[1:]...)
 		var output bytes.Buffer
@@ -195,6 +196,22 @@ func (ops *GlobalOps) FindCompilerCC() error {
 	return nil
 }
 
+// Removes the compiler launcher if cc starts with it, e.g. from CC="ccache gcc",
+// since it's added separately by the rules.
+func (ops *GlobalOps) stripCompilerLauncher(cc string) string {
+	launcher := strings.Fields(ops.Config.CompilerLauncher)
+	ccv := strings.Fields(cc)
+	if len(launcher) == 0 || len(ccv) <= len(launcher) {
+		return cc
+	}
+	for i := range launcher {
+		if path.Base(ccv[i]) != path.Base(launcher[i]) {
+			return cc
+		}
+	}
+	return strings.Join(ccv[len(launcher):], " ")
+}
+
 func comparableVersion(v string) string {
 	var vlong strings.Builder
 	for _, vpart := range strings.Split(v, ".") {
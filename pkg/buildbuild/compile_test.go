@@ -3,13 +3,18 @@
 package buildbuild
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/assets"
 )
 
 func checkTargets(t *testing.T, expt, got map[string]*Target) {
@@ -118,6 +123,139 @@ func TestCompileCXXPic(t *testing.T) {
 	}
 }
 
+func TestFinalizeCCPicOnly(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.Config.PicOnly = true
+
+	lib := (&ProgDesc{LinkDesc: LinkDesc{Picrules: true}}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	lib.CompileC("testdir", "src.c", "src")
+	lib.FinalizeCC(ops)
+	if lib.Targets["src.o"] != nil {
+		t.Error("Non-pic object wasn't removed")
+	}
+	if objs := lib.SuffixedObjs(".o", nil); !reflect.DeepEqual(objs, []string{"src.pic_o"}) {
+		t.Errorf("Bad objects %v", objs)
+	}
+
+	prog := (&ProgDesc{}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	prog.CompileC("testdir", "src.c", "src")
+	prog.FinalizeCC(ops)
+	if tgt := prog.Targets["src.o"]; tgt == nil || !reflect.DeepEqual(tgt.Extraargs, []string{"picflag=-fPIC"}) {
+		t.Errorf("Object not compiled as pic: %#v", tgt)
+	}
+}
+
+func TestFinalizePch(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := (&ProgDesc{}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	desc.Pch = "common.hh"
+	desc.PchSrcdir = "testdir"
+	desc.Srcopts["src3.cc"] = []string{"-O0"}
+	desc.CompileC("testdir", "src.c", "src")
+	desc.CompileCXX("testdir", "src2.cc", "src2")
+	desc.CompileCXX("testdir", "src3.cc", "src3")
+	desc.FinalizePch(ops)
+
+	pch := desc.Targets["pch/cxx/common.hh$pch_ext"]
+	if pch == nil || pch.Rule != "cxx_pch" {
+		t.Fatalf("Bad pch target %#v", pch)
+	}
+	if hdr := desc.Targets["pch/cxx/common.hh"]; hdr == nil || hdr.Rule != "install_header" || !reflect.DeepEqual(hdr.Sources, []string{"common.hh"}) {
+		t.Fatalf("Bad pch header target %#v", hdr)
+	}
+	if tgt := desc.Targets["src.o"]; len(tgt.Deps) != 0 || len(tgt.Extraargs) != 0 {
+		t.Errorf("C++ header used for C source: %#v", tgt)
+	}
+	if tgt := desc.Targets["src3.o"]; len(tgt.Deps) != 0 || !reflect.DeepEqual(tgt.Extraargs, []string{"pchflags=-include testdir/common.hh"}) {
+		t.Errorf("Precompiled header used for source with srcopts: %#v", tgt)
+	}
+	tgt := desc.Targets["src2.o"]
+	if !reflect.DeepEqual(tgt.Deps, []string{"$objdir/pch/cxx/common.hh", "$objdir/pch/cxx/common.hh$pch_ext"}) {
+		t.Errorf("Bad deps %v", tgt.Deps)
+	}
+	if !reflect.DeepEqual(tgt.Extraargs, []string{"pch=$objdir/pch/cxx/common.hh$pch_ext", "pchflags=-include $objdir/pch/cxx/common.hh"}) {
+		t.Errorf("Bad extraargs %v", tgt.Extraargs)
+	}
+	if tgt := desc.Targets["src2.analyse"]; !reflect.DeepEqual(tgt.Extraargs, []string{"pchflags=-include testdir/common.hh"}) {
+		t.Errorf("Bad analyse extraargs %v", tgt.Extraargs)
+	}
+
+	desc = (&ProgDesc{LinkDesc: LinkDesc{Picrules: true}}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	desc.Pch = "common.h"
+	desc.CompileC("", "src.c", "src")
+	desc.FinalizePch(ops)
+	if tgt := desc.Targets["src.pic_o"]; !reflect.DeepEqual(tgt.Extraargs, []string{"picflag=-fPIC", "pch=$objdir/pch/cc_pic/common.h$pch_ext", "pchflags=-include $objdir/pch/cc_pic/common.h"}) {
+		t.Errorf("Bad extraargs %v", tgt.Extraargs)
+	}
+	if desc.Targets["pch/cc/common.h$pch_ext"] == nil {
+		t.Error("Non-pic pch target missing")
+	}
+}
+
+func TestOutputPchNinja(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.CC = "gcc"
+	ops.CompilerFlavor = "gcc"
+	ops.Config.Toolchains = map[string]*Toolchain{"osx": {Name: "osx", CC: "o64-clang"}}
+	ops.FlavorConfigs = map[string]*FlavorConfig{"mac": {Toolchain: "osx"}}
+
+	var buf bytes.Buffer
+	ops.outputPchNinja(&buf, "dev")
+	if buf.String() != "pch_ext=.gch\n" {
+		t.Errorf("Bad gcc pch ninja %q", buf.String())
+	}
+	buf.Reset()
+	ops.outputPchNinja(&buf, "mac")
+	if buf.String() != "pch_ext=.pch\n" {
+		t.Errorf("Bad clang pch ninja %q", buf.String())
+	}
+}
+
+// Precompiled headers go through the compiler cache like the sources.
+func TestPchRulesLauncher(t *testing.T) {
+	for rule, cc := range map[string]string{"cc": "$cc", "cxx": "$cxx", "cc_pch": "$cc", "cxx_pch": "$cxx"} {
+		i := strings.Index(assets.RulesNinja, "\nrule "+rule+"\n")
+		if i < 0 {
+			t.Fatalf("Missing rule %s", rule)
+		}
+		cmd := assets.RulesNinja[i:]
+		cmd = cmd[:strings.Index(cmd, "\n    depfile")]
+		if !strings.Contains(cmd, " $compiler_launcher "+cc+" ") {
+			t.Errorf("Rule %s doesn't use the compiler launcher:%s", rule, cmd)
+		}
+	}
+}
+
+func TestFinalizeUnity(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := (&ProgDesc{}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	desc.Srcopts["c.c"] = []string{"-O0"}
+	desc.Unity = 2
+	for _, src := range []string{"a", "b", "c", "d"} {
+		desc.CompileC("testdir", src+".c", src)
+	}
+	desc.CompileCXX("testdir", "e.cc", "e")
+	desc.FinalizeUnity(ops)
+
+	if !reflect.DeepEqual(desc.Objs, []string{"unity/cc-0", "c", "unity/cc-1", "unity/cxx-0"}) {
+		t.Errorf("Bad objects %v", desc.Objs)
+	}
+	if !reflect.DeepEqual(desc.UnityBatched, []string{"a", "b", "d", "e"}) {
+		t.Errorf("Bad batched objects %v", desc.UnityBatched)
+	}
+	if tgt := desc.Targets["unity/cc-0.c"]; tgt == nil || !reflect.DeepEqual(tgt.Sources, []string{"testdir/a.c", "testdir/b.c"}) {
+		t.Errorf("Bad unity source %#v", tgt)
+	}
+	if tgt := desc.Targets["unity/cxx-0.o"]; tgt == nil || tgt.Rule != "cxx" {
+		t.Errorf("Bad unity object %#v", tgt)
+	}
+	if desc.Targets["a.o"] != nil || desc.Targets["a.analyse"] == nil {
+		t.Error("Batched source targets not replaced")
+	}
+}
+
 func TestCompileNoAnalyse(t *testing.T) {
 	desc := (&ProgDesc{LinkDesc: LinkDesc{NoAnalyse: true}}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
 
@@ -354,6 +492,32 @@ func TestFindCompilerCC(t *testing.T) {
 	}
 }
 
+func TestFindCompilerCCLauncher(t *testing.T) {
+	var order []string
+	defer func() {
+		findCompilerRun = (*exec.Cmd).Run
+	}()
+	findCompilerRun = func(cmd *exec.Cmd) error {
+		cc := filepath.Base(cmd.Path)
+		order = append(order, cc)
+		io.WriteString(cmd.Stdout, "gcc version 9.3.0")
+		return nil
+	}
+	ops := NewGlobalOps()
+	ops.Config.CompilerLauncher = "ccache"
+	ops.Config.Compiler = []string{"/usr/bin/ccache gcc-9"}
+	err := ops.FindCompilerCC()
+	if err != nil {
+		t.Error("Expected no error, got", err)
+	}
+	if !reflect.DeepEqual(order, []string{"gcc-9"}) {
+		t.Error("Launcher was probed, got", order)
+	}
+	if ops.CC != "gcc-9" {
+		t.Error("Unexpected compiler", ops.CC)
+	}
+}
+
 func TestCompileSpecial(t *testing.T) {
 	called := false
 	PluginSpecialSrcs["test"] = func(desc Descriptor, tname, rule string, srcs []string, destdir, srcdir string, extraargs []string, options map[string]bool) Descriptor {
@@ -401,3 +565,407 @@ func TestCompileSrc(t *testing.T) {
 	}
 	checkTargets(t, expt, desc.AllTargets())
 }
+
+func TestFinalizeModuleExports(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := ModuleTemplate.NewFromTemplate("Builddesc", "test", nil).(*ModuleDesc)
+	desc.Exports = "test.sym"
+	desc.ExportsBaseline = "test.abi"
+	desc.ExportsSrcdir = "testdir"
+	desc.CompileC("testdir", "src.c", "src")
+	desc.Finalize(ops)
+
+	mod := desc.Targets["test.so"]
+	if mod.Extraargs[0] != "ldflags=-rdynamic -fPIC -shared -Wl,--version-script=$objdir/test.map" {
+		t.Errorf("Bad module extraargs %v", mod.Extraargs)
+	}
+	if deps := desc.ResolveDeps(ops, "test.so"); !reflect.DeepEqual(deps, []string{"$objdir/test.map"}) {
+		t.Errorf("Bad module deps %v", deps)
+	}
+	if srcs := desc.ResolveSrcs(ops, "test.map", desc.Targets["test.map"].Sources...); !reflect.DeepEqual(srcs, []string{"testdir/test.sym"}) {
+		t.Errorf("Bad version script sources %v", srcs)
+	}
+	check := desc.Targets["test.exports_check"]
+	if srcs := desc.ResolveSrcs(ops, "test.exports_check", check.Sources...); !reflect.DeepEqual(srcs, []string{"$dest_mod/test.so", "testdir/test.abi"}) {
+		t.Errorf("Bad exports check sources %v", srcs)
+	}
+	if !check.Options["all"] {
+		t.Error("Exports check not built by default")
+	}
+
+	desc = ModuleTemplate.NewFromTemplate("Builddesc", "test", nil).(*ModuleDesc)
+	desc.Exports = "test.sym"
+	desc.ExportsSrcdir = "testdir"
+	desc.CompileC("testdir", "src.c", "src")
+	desc.Finalize(ops)
+	if desc.Targets["test.exports_check"] != nil {
+		t.Error("Exports checked without a baseline")
+	}
+}
+
+func TestSizeBudget(t *testing.T) {
+	if b := parseSizeBudget([]string{"100", "64K"}, "Builddesc"); b != 64<<10 {
+		t.Errorf("Bad budget %d", b)
+	}
+	if b := parseSizeBudget(nil, "Builddesc"); b != 0 {
+		t.Errorf("Bad default budget %d", b)
+	}
+	if b := parseSizeBudget([]string{"1M", "0"}, "Builddesc"); b != 0 {
+		t.Errorf("Bad turned off budget %d", b)
+	}
+	for _, arg := range []string{"1X", "-1", "K"} {
+		func() {
+			defer func() {
+				if p, ok := recover().(*ParseError); !ok || p.Err != BadSizeBudget {
+					t.Errorf("Expected BadSizeBudget for %s, got %v", arg, p)
+				}
+			}()
+			parseSizeBudget([]string{arg}, "Builddesc")
+		}()
+	}
+
+	desc := (&ProgDesc{}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	desc.AddTarget("test", "link", nil, "dest_bin", "", nil, nil)
+	desc.AddSizeCheck("test", 1024)
+	tgt := desc.Targets["test.size_check"]
+	if tgt == nil || tgt.Rule != "size_check" || !reflect.DeepEqual(tgt.Extraargs, []string{"size_budget=1024"}) {
+		t.Fatalf("Bad size check target %#v", tgt)
+	}
+	if srcs := desc.ResolveSrcs(NewGlobalOps(), "test.size_check", tgt.Sources...); !reflect.DeepEqual(srcs, []string{"$dest_bin/test"}) {
+		t.Errorf("Bad size check sources %v", srcs)
+	}
+
+	desc = (&ProgDesc{}).NewFromTemplate("Builddesc", "test", nil).(*ProgDesc)
+	desc.AddSizeCheck("test", 0)
+	if desc.Targets["test.size_check"] != nil {
+		t.Error("Size checked without a budget")
+	}
+}
+
+func TestFinalizeCTest(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := CTestTemplate.NewFromTemplate("Builddesc", "test", nil).(*CTestDesc)
+	desc.Srcdir = "testdir"
+	desc.Parse(ops, "testdir", map[string][]string{
+		"srcs":    {"test.c"},
+		"args":    {"-v"},
+		"env":     {"TZ=UTC"},
+		"timeout": {"30"},
+		"tap":     {},
+	})
+	desc.Finalize(ops)
+
+	if tgt := desc.Targets["test"]; tgt == nil || tgt.Rule != "link" || tgt.Destdir != "obj" {
+		t.Fatalf("Bad test program %#v", tgt)
+	}
+	tgt := desc.Targets["ctest/test"]
+	if tgt == nil || tgt.Rule != "ctest" || tgt.CollectAs != "_ctest" {
+		t.Fatalf("Bad test run %#v", tgt)
+	}
+	expt := []string{"test_flags=-dir=testdir -exit-code=0 -timeout=30s -tap", "test_env=TZ=UTC", "test_args=-v"}
+	if !reflect.DeepEqual(tgt.Extraargs, expt) {
+		t.Errorf("Bad extraargs %v", tgt.Extraargs)
+	}
+	if checks := flavorCheckTargets(desc); !reflect.DeepEqual(checks, []string{"$destroot/ctest/test"}) {
+		t.Errorf("Bad check targets %v", checks)
+	}
+}
+
+func TestFinalizeTestScript(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := TestScriptTemplate.NewFromTemplate("Builddesc", "smoke", nil).(*TestScriptDesc)
+	desc.Srcdir = "testdir"
+	desc.Parse(ops, "testdir", map[string][]string{
+		"script":  {"smoke.sh"},
+		"data":    {"input.txt"},
+		"args":    {"-v"},
+		"timeout": {"1m"},
+	})
+	desc.Finalize(ops)
+
+	tgt := desc.Targets["tests/smoke"]
+	if tgt == nil || tgt.Rule != "test_script" || tgt.CollectAs != "_tests" {
+		t.Fatalf("Bad test target %#v", tgt)
+	}
+	if !reflect.DeepEqual(tgt.Sources, []string{"smoke.sh"}) || !reflect.DeepEqual(tgt.Deps, []string{"input.txt"}) {
+		t.Errorf("Bad sources %v or deps %v", tgt.Sources, tgt.Deps)
+	}
+	expt := []string{`test_flags=-tmp -srcdir=testdir -destroot=$destroot -timeout=1m -data="testdir/input.txt"`, "test_env=", "test_args=-v"}
+	if !reflect.DeepEqual(tgt.Extraargs, expt) {
+		t.Errorf("Bad extraargs %v", tgt.Extraargs)
+	}
+	if checks := flavorCheckTargets(desc); !reflect.DeepEqual(checks, []string{"$destroot/tests/smoke"}) {
+		t.Errorf("Bad check targets %v", checks)
+	}
+}
+
+func TestFinalizeGoTestCoverPkg(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := GotestTemplate.NewFromTemplate("Builddesc", "test", nil).(*GoTestDesc)
+	desc.Srcdir = "testdir"
+	desc.Parse(ops, "testdir", map[string][]string{
+		"coverpkg": {"example.com/a", "example.com/b/..."},
+	})
+	desc.Finalize(ops)
+
+	tgt := desc.Targets["gocover/test-coverage"]
+	if tgt == nil || tgt.CollectAs != "_gocoverprofile" {
+		t.Fatalf("Bad coverage target %#v", tgt)
+	}
+	if ea := tgt.Extraargs[len(tgt.Extraargs)-1]; ea != "gocoverpkg=example.com/a,example.com/b/..." {
+		t.Errorf("Bad coverpkg %q", ea)
+	}
+	for _, ea := range desc.Targets["gotest/test"].Extraargs {
+		if strings.HasPrefix(ea, "gocoverpkg=") {
+			t.Errorf("Unexpected coverpkg for gotest")
+		}
+	}
+	if profiles := flavorCollectedTargets(desc, coverProfileVars); !reflect.DeepEqual(profiles, []string{"$destroot/gocover/test-coverage"}) {
+		t.Errorf("Bad coverage profiles %v", profiles)
+	}
+}
+
+func TestFinalizeGoTestFuzz(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := GotestTemplate.NewFromTemplate("Builddesc", "test", nil).(*GoTestDesc)
+	desc.Srcdir = "testdir"
+	desc.Parse(ops, "testdir", map[string][]string{
+		"fuzz":     {"FuzzParse", "FuzzDecode"},
+		"fuzztime": {"1000x"},
+	})
+	desc.Finalize(ops)
+
+	for _, fuzz := range []string{"FuzzParse", "FuzzDecode"} {
+		tgt := desc.Targets["gofuzz/test/"+fuzz]
+		if tgt == nil || tgt.Rule != "gofuzz" || tgt.CollectAs != "_gofuzz" || tgt.Options["all"] {
+			t.Fatalf("Bad fuzz target %#v", tgt)
+		}
+		expt := []string{"gofuzz=" + fuzz, "fuzztime=1000x"}
+		if eas := tgt.Extraargs[len(tgt.Extraargs)-2:]; !reflect.DeepEqual(eas, expt) {
+			t.Errorf("Bad extraargs %v", tgt.Extraargs)
+		}
+	}
+
+	for _, args := range []map[string][]string{
+		{"fuzz": {"TestParse"}},
+		{"fuzztime": {"often"}},
+	} {
+		func() {
+			defer func() {
+				if p, ok := recover().(*ParseError); !ok || (p.Err != BadFuzz && p.Err != BadFuzzTime) {
+					t.Errorf("Expected fuzz parse error for %v, got %v", args, p)
+				}
+			}()
+			GotestTemplate.NewFromTemplate("Builddesc", "test", nil).Parse(ops, "testdir", args)
+		}()
+	}
+}
+
+func TestFinalizeFuzzProg(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.didFindCompiler = true
+	ops.CC = "clang-14"
+	ops.CompilerFlavor = "clang"
+
+	desc := FuzzProgTemplate.NewFromTemplate("Builddesc", "parse_fuzz", nil).(*FuzzProgDesc)
+	desc.Srcdir = "testdir"
+	desc.Parse(ops, "testdir", map[string][]string{
+		"srcs":     {"parse_fuzz.c"},
+		"corpus":   {"seeds"},
+		"fuzztime": {"1m"},
+		"args":     {"-max_len=64"},
+	})
+	desc.Finalize(ops)
+
+	if tgt := desc.Targets["parse_fuzz"]; tgt == nil || tgt.Rule != "link" || tgt.Destdir != "obj" || !tgt.Options["all"] {
+		t.Fatalf("Bad harness %#v", tgt)
+	}
+	if copts := desc.Buildvars["copts"]; !reflect.DeepEqual(copts, []string{"-fsanitize=fuzzer,address"}) {
+		t.Errorf("Bad copts %v", copts)
+	}
+	tgt := desc.Targets["fuzz/parse_fuzz"]
+	if tgt == nil || tgt.Rule != "fuzz_prog" || tgt.CollectAs != "_fuzz" || tgt.Options["all"] {
+		t.Fatalf("Bad fuzz target %#v", tgt)
+	}
+	expt := []string{
+		"fuzzdir=$destroot/fuzz/parse_fuzz",
+		"test_env=",
+		"test_args=-max_total_time=60 -artifact_prefix=$destroot/fuzz/parse_fuzz-crashes/ -max_len=64 $destroot/fuzz/parse_fuzz-corpus testdir/seeds",
+	}
+	if !reflect.DeepEqual(tgt.Extraargs, expt) {
+		t.Errorf("Bad extraargs %v", tgt.Extraargs)
+	}
+	if !reflect.DeepEqual(tgt.Deps, []string{"testdir/seeds"}) {
+		t.Errorf("Bad deps %v", tgt.Deps)
+	}
+
+	ops.CC = "gcc"
+	ops.CompilerFlavor = "gcc"
+	defer func() {
+		if p, ok := recover().(*ParseError); !ok || p.Err != BadFuzzCompiler {
+			t.Errorf("Expected compiler error, got %v", p)
+		}
+	}()
+	desc = FuzzProgTemplate.NewFromTemplate("Builddesc", "parse_fuzz", nil).(*FuzzProgDesc)
+	desc.Parse(ops, "testdir", map[string][]string{"srcs": {"parse_fuzz.c"}})
+	desc.Finalize(ops)
+}
+
+func TestFinalizeFuzzProgLibs(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.didFindCompiler = true
+	ops.CC = "clang-14"
+	ops.CompilerFlavor = "clang"
+
+	lib := LibTemplate.NewFromTemplate("Builddesc", "parser", nil).(*LibDesc)
+	lib.CompileC("testdir", "parser.c", "parser")
+	other := LibTemplate.NewFromTemplate("Builddesc", "other", nil).(*LibDesc)
+	other.CompileC("testdir", "other.c", "other")
+	fuzz := FuzzProgTemplate.NewFromTemplate("Builddesc", "parse_fuzz", nil).(*FuzzProgDesc)
+	fuzz.Parse(ops, "testdir", map[string][]string{"srcs": {"parse_fuzz.c"}, "libs": {"parser"}})
+	ops.Libs = map[string]LibDescriptor{"parser": lib, "other": other}
+	ops.Descriptors = []Descriptor{lib, other, fuzz}
+
+	lib.Finalize(ops)
+	other.Finalize(ops)
+	fuzz.Finalize(ops)
+
+	obj := lib.Targets["fuzz/parser.o"]
+	if obj == nil || obj.Rule != "cc" || !obj.Options["fuzz"] || !reflect.DeepEqual(obj.Extraargs, []string{"copts=$copts -fsanitize=fuzzer-no-link,address"}) {
+		t.Fatalf("Bad fuzz object %#v", obj)
+	}
+	ar := lib.Targets["fuzz/libparser.a"]
+	if ar == nil || !ar.Options["fuzz"] || ar.Options["lib"] {
+		t.Fatalf("Bad fuzz library %#v", ar)
+	}
+	if srcs := lib.ResolveSrcs(ops, "fuzz/libparser.a", ar.Sources...); !reflect.DeepEqual(srcs, []string{"$objdir/fuzz/parser.o"}) {
+		t.Errorf("Bad fuzz library sources %v", srcs)
+	}
+	if other.Targets["fuzz/libother.a"] != nil {
+		t.Error("Fuzz variant of library not used by harnesses")
+	}
+	if srcs := fuzz.Targets["parse_fuzz"].Sources; !reflect.DeepEqual(srcs, []string{"parse_fuzz.o", "$libdir/fuzz/libparser.a"}) {
+		t.Errorf("Bad harness sources %v", srcs)
+	}
+}
+
+func TestFinalizeGoProgBuildFlags(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := GoprogTemplate.NewFromTemplate("Builddesc", "prog", nil).(*GoProgDesc)
+	desc.Srcdir = "prog"
+	desc.Parse(ops, "prog", map[string][]string{
+		"gotags":     {"netgo", "osusergo"},
+		"gcflags":    {"-N", "-l"},
+		"go_ldflags": {"-X", "main.version=1"},
+		"race":       {},
+	})
+	desc.Finalize(ops)
+
+	expt := []string{"ldlibs=", "gotags=netgo,osusergo", "gcflags=-N -l", "go_ldflags=-X main.version=1", "go_sanitize=race"}
+	tgt := desc.Targets["prog"]
+	if tgt == nil || !reflect.DeepEqual(tgt.Extraargs, append(expt, "gomode=prog")) {
+		t.Fatalf("Bad program target %#v", tgt)
+	}
+	vet := desc.Targets["prog.target_analyze"]
+	if vet == nil || vet.Rule != "govet" || !reflect.DeepEqual(vet.Extraargs, expt) {
+		t.Fatalf("Bad vet target %#v", vet)
+	}
+	if srcs := desc.ResolveSrcs(ops, "prog.target_analyze", vet.Sources...); !reflect.DeepEqual(srcs, []string{"prog"}) {
+		t.Errorf("Bad vet sources %v", srcs)
+	}
+	if len(ops.Analyses) != 1 || ops.Analyses[0].TargetName != "prog/prog/prog.target_analyze" {
+		t.Errorf("Bad analyses %v", ops.Analyses)
+	}
+}
+
+func TestFinalizeGoProgVersionVar(t *testing.T) {
+	ops := NewGlobalOps()
+
+	desc := GoprogTemplate.NewFromTemplate("Builddesc", "prog", nil).(*GoProgDesc)
+	desc.Srcdir = "prog"
+	desc.Parse(ops, "prog", map[string][]string{
+		"version_var": {"main.Version", "example.com/prog/version.Version"},
+	})
+	desc.Finalize(ops)
+
+	tgt := desc.Targets["prog"]
+	ea := tgt.Extraargs[len(tgt.Extraargs)-1]
+	if ea != `go_version_flags=-version-var=example.com/prog/version.Version -version="$buildversion" -flavor="$buildflavor" -conditions="$buildconditions"` {
+		t.Errorf("Bad version flags %q", ea)
+	}
+	if !reflect.DeepEqual(tgt.Deps, []string{"$incdir/build_version_$buildversion.h"}) {
+		t.Errorf("Bad deps %v", tgt.Deps)
+	}
+
+	for _, bad := range []string{"Version", "main.", "main.Version x"} {
+		func() {
+			defer func() {
+				if p, ok := recover().(*ParseError); !ok || p.Err != BadVersionVar {
+					t.Errorf("Expected BadVersionVar for %q, got %v", bad, p)
+				}
+			}()
+			GoprogTemplate.NewFromTemplate("Builddesc", "prog", nil).Parse(ops, "prog", map[string][]string{"version_var": {bad}})
+		}()
+	}
+}
+
+func TestAddGodepsGoVersion(t *testing.T) {
+	ops := NewGlobalOps()
+
+	tgt := &Target{}
+	AddGodeps(tgt, ops)
+	if len(tgt.Deps) != 0 {
+		t.Errorf("Unexpected deps %v", tgt.Deps)
+	}
+
+	ops.Config.GoTrackDeps = "1"
+	AddGodeps(tgt, ops)
+	if !reflect.DeepEqual(tgt.Deps, []string{"build/obj/_go/go_version"}) {
+		t.Errorf("Bad deps %v", tgt.Deps)
+	}
+}
+
+func TestFinalizeToolProgHostLibs(t *testing.T) {
+	ops := NewGlobalOps()
+
+	lib := LibTemplate.NewFromTemplate("Builddesc", "util", nil).(*LibDesc)
+	lib.CompileC("testdir", "util.c", "util")
+	other := LibTemplate.NewFromTemplate("Builddesc", "other", nil).(*LibDesc)
+	other.CompileC("testdir", "other.c", "other")
+	tool := ToolProgTemplate.NewFromTemplate("Builddesc", "gen", nil).(*ProgDesc)
+	tool.Libs = []string{"util"}
+	tool.CompileC("testdir", "gen.c", "gen")
+	ops.Libs = map[string]LibDescriptor{"util": lib, "other": other}
+	ops.Descriptors = []Descriptor{lib, other, tool}
+
+	lib.Finalize(ops)
+	other.Finalize(ops)
+	tool.Finalize(ops)
+
+	obj := lib.Targets["host/util.o"]
+	if obj == nil || obj.Rule != "cc" || !obj.Options["host"] || !reflect.DeepEqual(obj.Extraargs, hostToolchainVars) {
+		t.Fatalf("Bad host object %#v", obj)
+	}
+	ar := lib.Targets["host/libutil.a"]
+	if ar == nil || !ar.Options["host"] || ar.Options["lib"] {
+		t.Fatalf("Bad host library %#v", ar)
+	}
+	if srcs := lib.ResolveSrcs(ops, "host/libutil.a", ar.Sources...); !reflect.DeepEqual(srcs, []string{"$objdir/host/util.o"}) {
+		t.Errorf("Bad host library sources %v", srcs)
+	}
+	if dest := path.Join(ar.ResolveDest(), "host/libutil.a"); dest != "$libdir/host/libutil.a" {
+		t.Errorf("Bad host library dest %s", dest)
+	}
+	if other.Targets["host/libother.a"] != nil {
+		t.Error("Host variant of library not used by tools")
+	}
+	if srcs := tool.Targets["gen"].Sources; !reflect.DeepEqual(srcs, []string{"gen.o", "$host_libdir/libutil.a"}) {
+		t.Errorf("Bad tool sources %v", srcs)
+	}
+}
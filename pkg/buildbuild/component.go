@@ -111,8 +111,16 @@ func (dp *DescParser) Parse(srcdir string, s *Scanner, flavors []string) ParseFu
 		for k, v := range args.Unflavored {
 			flargs[k] = v
 		}
-		for k, v := range args.Flavors[fl] {
-			flargs[k] = append(flargs[k], v...)
+		// Inherited flavors get the arguments of their parents as well,
+		// unless they have their own for the same key.
+		flavored := make(map[string][]string)
+		for _, chainfl := range dp.Ops.FlavorChain(fl) {
+			for k, v := range args.Flavors[chainfl] {
+				flavored[k] = v
+			}
+		}
+		for k, v := range flavored {
+			flargs[k] = append(flargs[k][:len(flargs[k]):len(flargs[k])], v...)
 		}
 
 		// If an enabled argument exists then skip this descriptor if
@@ -10,7 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -30,6 +30,12 @@ import (
 // compiler - Override the compiler used, set it to the C compiler, C++ one
 // will be guessed with some heuristics.
 //
+// compiler_launcher - Command such as ccache or sccache prefixed to the
+// compile and link commands. Not considered when detecting the compiler.
+//
+// action_cache_dir, action_cache_url - Local directory and/or HTTP server
+// used to cache the outputs of compiles, links and other rules.
+//
 // flavors - Various build environments needed to build your site. The usual
 // is to build prod and regress.
 //
@@ -63,6 +69,32 @@ import (
 // compiler_rule_dir, flavor_rule_dir, compiler_flavor_rule_dir -
 // Directories containing ninja files included based on current compiler
 // and/or flavor.
+//
+// toolchains - Cross compilation toolchains, given as name:key=value where
+// key is one of triple, sysroot, cc, cxx, ar, ld and objcopy.
+//
+// toolchain, toolchain:flavor - Toolchain to use for all flavors or for the
+// specified flavor. Tools are still built with the host compiler.
+//
+// pic_only - Compile each C and C++ source only once, as position independent
+// code, and use those objects for both static and pic libraries.
+//
+// reproducible - Build bit for bit reproducible outputs, independent of the
+// source and build paths and the time of the build.
+//
+// go_cover_min - Minimum percentage of statements covered by the merged
+// coverage of the GOTEST descriptors in a flavor.
+//
+// lto:flavor - Enable link time optimization for the flavor. Must be flavored.
+//
+// pgo_generate:flavor, pgo_use:flavor - Build instrumented binaries and run
+// their pgo_training, or use the profile from such a flavor. Must be flavored.
+//
+// sandbox:flavor - Run the rules in the flavor in a sandbox only giving access
+// to their declared inputs. Must be flavored.
+//
+// split_debug:flavor - Strip programs and modules in the flavor, putting
+// their debug information in $flavorroot/debug. Must be flavored.
 type Config struct {
 	Seen bool
 
@@ -70,7 +102,8 @@ type Config struct {
 	Buildparams []string
 
 	AllFlavors    map[string]bool
-	ActiveFlavors []string // Flavors left after filtering --with-flavors and --without-flavors.
+	ActiveFlavors []string          // Flavors left after filtering --with-flavors and --without-flavors.
+	FlavorParents map[string]string // Flavors inheriting from another one.
 
 	Plugins    []string
 	Configvars []string // Files with ninja variables, available to invars.
@@ -97,13 +130,31 @@ type Config struct {
 	BuiltinRulesNinja    string
 	BuiltinStaticNinja   string
 
-	GoTrackDeps string
+	GoTrackDeps      string
+	GoCoverMin       string // Minimum percentage of merged Go coverage, empty for none.
+	PicOnly          bool
+	Reproducible     bool
+	Offline          bool // Build Go from the vendor directories, without network access.
+	CompilerLauncher string
+	ActionCacheDir   string
+	ActionCacheURL   string
+
+	Toolchains map[string]*Toolchain
+	Toolchain  string // Default toolchain, empty for the host one.
 }
 
 type FlavorConfig struct {
 	Prefix    string
 	Extravars []string
 	Cflags    string
+	Toolchain string
+	Ruledeps  map[string][]string // Additional per-rule dependencies in this flavor only.
+
+	LTO         string // Link time optimization mode, auto, full or thin. Empty if disabled.
+	PGOGenerate bool   // Build instrumented binaries and run PGO training.
+	PGOUse      string // Use the profile from training in this flavor.
+	Sandbox     bool   // Run rules with seb -tool sandbox.
+	SplitDebug  bool   // Strip linked outputs, keeping the debug information separately.
 }
 
 var (
@@ -112,14 +163,19 @@ var (
 	ConfigMustBeFlavored     = errors.New("CONFIG argument must be flavored")
 	ConfigUnknownArg         = errors.New("Unrecognized argument in CONFIG")
 	BadFlavor                = errors.New("Flavor does not exist")
+	BadFlavorParent          = errors.New("Parent flavor must be listed before the inheriting one")
+	BadGoCoverMin            = errors.New("go_cover_min must be a percentage")
+	BadMsanCompiler          = errors.New("The msan flavor needs clang, MemorySanitizer isn't available with this compiler")
 )
 
 func (ops *GlobalOps) DefaultConfig() {
 	ops.Config.Conditions = make(map[string]bool)
 	ops.Config.Ruledeps = make(map[string][]string)
+	ops.Config.Toolchains = make(map[string]*Toolchain)
 
 	ops.Config.AllFlavors = map[string]bool{"dev": true}
 	ops.Config.ActiveFlavors = []string{"dev"}
+	ops.Config.FlavorParents = make(map[string]string)
 
 	ops.Config.Buildpath = os.Getenv("BUILDPATH")
 	if ops.Config.Buildpath == "" {
@@ -128,11 +184,8 @@ func (ops *GlobalOps) DefaultConfig() {
 	ops.Config.BuildversionScript = "git rev-list HEAD 2>/dev/null|wc -l|xargs"
 	ops.Config.GodepsRule = "touch"
 
-	ops.Config.Conditions[runtime.GOOS] = true
-	if runtime.GOARCH == "amd64" {
-		ops.Config.Conditions["x86_64"] = true
-	} else {
-		ops.Config.Conditions[runtime.GOARCH] = true
+	for _, c := range hostConditions() {
+		ops.Config.Conditions[c] = true
 	}
 
 	ops.Config.Ruledeps["in"] = []string{"$inconf", "$configvars"}
@@ -149,8 +202,18 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 
 	if args.Unflavored["flavors"] != nil {
 		ops.Config.AllFlavors = make(map[string]bool)
+		ops.Config.FlavorParents = make(map[string]string)
 		ops.Config.ActiveFlavors = nil
 		for _, fl := range args.Unflavored["flavors"] {
+			// A flavor can inherit from a previously listed one, given as flavor:parent.
+			if col := strings.IndexRune(fl, ':'); col >= 0 {
+				parent := fl[col+1:]
+				fl = fl[:col]
+				if !ops.Config.AllFlavors[parent] {
+					panic(&ParseError{BadFlavorParent, parent, s.Filename})
+				}
+				ops.Config.FlavorParents[fl] = parent
+			}
 			ops.Config.AllFlavors[fl] = true
 			if len(ops.Options.WithFlavors) > 0 && !ops.Options.WithFlavors[fl] {
 				continue
@@ -202,6 +265,12 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 	ops.Config.Compiler = append(ops.Config.Compiler, args.Unflavored["compiler"]...)
 	delete(args.Unflavored, "compiler")
 
+	// toolchains format is <name>:<key>=<value>
+	for _, tc := range args.Unflavored["toolchains"] {
+		ops.parseToolchainArg(tc, s.Filename)
+	}
+	delete(args.Unflavored, "toolchains")
+
 	for _, inc := range args.Unflavored["INCLUDE"] {
 		inc = NormalizePath(srcdir, inc)
 		s, err := parseConfigOpenBuilddesc(ops, inc)
@@ -238,6 +307,9 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 		{"builtin_rules_ninja", &ops.Config.BuiltinRulesNinja},
 		{"builtin_static_ninja", &ops.Config.BuiltinStaticNinja},
 		{"go_track_deps", &ops.Config.GoTrackDeps},
+		{"compiler_launcher", &ops.Config.CompilerLauncher},
+		{"action_cache_dir", &ops.Config.ActionCacheDir},
+		{"action_cache_url", &ops.Config.ActionCacheURL},
 	} {
 		if args.Unflavored[conf.key] != nil {
 			*conf.conf = strings.Join(args.Unflavored[conf.key], " ")
@@ -245,6 +317,38 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 		}
 	}
 
+	if args.Unflavored["toolchain"] != nil {
+		ops.Config.Toolchain = strings.Join(args.Unflavored["toolchain"], " ")
+		if ops.Config.Toolchains[ops.Config.Toolchain] == nil {
+			panic(&ParseError{UnknownToolchain, ops.Config.Toolchain, s.Filename})
+		}
+		ops.setToolchainConditions()
+		delete(args.Unflavored, "toolchain")
+	}
+
+	if args.Unflavored["pic_only"] != nil {
+		ops.Config.PicOnly = true
+		delete(args.Unflavored, "pic_only")
+	}
+	if v := args.Unflavored["go_cover_min"]; v != nil {
+		ops.Config.GoCoverMin = strings.Join(v, " ")
+		if f, err := strconv.ParseFloat(ops.Config.GoCoverMin, 64); err != nil || f < 0 || f > 100 {
+			panic(&ParseError{BadGoCoverMin, ops.Config.GoCoverMin, s.Filename})
+		}
+		delete(args.Unflavored, "go_cover_min")
+	}
+	if args.Unflavored["reproducible"] != nil {
+		ops.Config.Reproducible = true
+		delete(args.Unflavored, "reproducible")
+	}
+	if args.Unflavored["offline"] != nil {
+		ops.Config.Offline = true
+		delete(args.Unflavored, "offline")
+	}
+	if ops.Options.Buildpath != "" {
+		ops.Config.Buildpath = ops.Options.Buildpath
+	}
+
 	for _, cond := range args.Unflavored["conditions"] {
 		ops.Config.Conditions[cond] = true
 	}
@@ -252,23 +356,9 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 
 	// Parse the arguments needing a flavor.
 	for _, fl := range ops.Config.ActiveFlavors {
-		conf := new(FlavorConfig)
-		ops.FlavorConfigs[fl] = conf
-		flargs := args.Flavors[fl]
-		if flargs == nil {
-			continue
-		}
-		conf.Prefix = strings.Join(flargs["prefix"], " ")
-		delete(flargs, "prefix")
-		conf.Extravars = flargs["extravars"]
-		delete(flargs, "extravars")
-		conf.Cflags = strings.Join(flargs["cflags"], " ")
-		delete(flargs, "cflags")
-		for k := range flargs {
-			panic(&ParseError{FlavoredConfigUnknownArg, k, s.Filename})
-		}
+		ops.FlavorConfigs[fl] = ops.parseFlavorConfig(fl, args.Flavors, s.Filename)
 	}
-	for _, k := range []string{"prefix", "cflags"} {
+	for _, k := range []string{"prefix", "cflags", "lto", "pgo_generate", "pgo_use", "sandbox", "split_debug"} {
 		if args.Unflavored[k] != nil {
 			panic(&ParseError{ConfigMustBeFlavored, k, s.Filename})
 		}
@@ -288,6 +378,76 @@ func (ops *GlobalOps) ParseConfig(srcdir string, s *Scanner, flavors []string) P
 	return ops.RunConfigScript
 }
 
+// Parses the flavored CONFIG arguments for a flavor. Inherited flavors
+// start out with the configuration of their parent.
+func (ops *GlobalOps) parseFlavorConfig(fl string, flavors map[string]map[string][]string, bd string) *FlavorConfig {
+	conf := new(FlavorConfig)
+	if parent := ops.Config.FlavorParents[fl]; parent != "" {
+		*conf = *ops.parseFlavorConfig(parent, flavors, bd)
+		conf.Extravars = append([]string(nil), conf.Extravars...)
+	}
+	pruledeps := conf.Ruledeps
+	conf.Ruledeps = make(map[string][]string)
+	for k, v := range pruledeps {
+		conf.Ruledeps[k] = append([]string(nil), v...)
+	}
+	flargs := flavors[fl]
+	for k, v := range flargs {
+		switch k {
+		case "prefix":
+			conf.Prefix = strings.Join(v, " ")
+		case "extravars":
+			conf.Extravars = append(conf.Extravars, v...)
+		case "cflags":
+			conf.Cflags = strings.TrimSpace(conf.Cflags + " " + strings.Join(v, " "))
+		case "toolchain":
+			conf.Toolchain = strings.Join(v, " ")
+			if ops.Config.Toolchains[conf.Toolchain] == nil {
+				panic(&ParseError{UnknownToolchain, conf.Toolchain, bd})
+			}
+		case "ruledeps":
+			for _, dep := range v {
+				depargs := strings.SplitN(dep, ":", 2)
+				if len(depargs) < 2 {
+					panic(&ParseError{RuledepsError, dep, bd})
+				}
+				conf.Ruledeps[depargs[0]] = append(conf.Ruledeps[depargs[0]], strings.Split(depargs[1], ",")...)
+			}
+		case "lto":
+			switch conf.LTO = strings.Join(v, " "); conf.LTO {
+			case "":
+				conf.LTO = "auto"
+			case "full", "thin":
+			default:
+				panic(&ParseError{BadLTOMode, conf.LTO, bd})
+			}
+		case "pgo_generate":
+			conf.PGOGenerate = true
+		case "sandbox":
+			conf.Sandbox = true
+		case "split_debug":
+			conf.SplitDebug = true
+		case "pgo_use":
+			conf.PGOUse = strings.Join(v, " ")
+			if !ops.Config.AllFlavors[conf.PGOUse] {
+				panic(&ParseError{BadFlavor, conf.PGOUse, bd})
+			}
+		default:
+			panic(&ParseError{FlavoredConfigUnknownArg, k, bd})
+		}
+	}
+	return conf
+}
+
+// Returns the flavor and the flavors it inherits from, root flavor first.
+func (ops *GlobalOps) FlavorChain(flavor string) []string {
+	var chain []string
+	for fl := flavor; fl != ""; fl = ops.Config.FlavorParents[fl] {
+		chain = append([]string{fl}, chain...)
+	}
+	return chain
+}
+
 func (ops *GlobalOps) RunConfigScript(srcdir string, s *Scanner, flavors []string) ParseFunc {
 	if ops.Config.ConfigScript != "" {
 		cmd := exec.Command("sh", "-c", ops.Config.ConfigScript)
@@ -3,11 +3,18 @@
 package buildbuild
 
 import (
+	"bytes"
 	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
 	"reflect"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
+
+	"github.com/schibsted/sebuild/v2/internal/pkg/assets"
 )
 
 func TestParseConfigAll(t *testing.T) {
@@ -71,6 +78,7 @@ invars[c d]
 		Buildparams:           nil,
 		AllFlavors:            map[string]bool{"a": true, "b": true, "c": true},
 		ActiveFlavors:         []string{"a", "b", "c"},
+		FlavorParents:         map[string]string{},
 		Plugins:               []string{"exts"},
 		Configvars:            []string{"config.ninja", "config2.ninja"},
 		Rules:                 []string{"rules.ninja", "rules2.ninja"},
@@ -90,6 +98,7 @@ invars[c d]
 		GodepsRule:         "touch",
 		BuiltinInvars:      "bi_invars",
 		Invars:             []string{"c", "d", "a", "b"},
+		Toolchains:         map[string]*Toolchain{},
 	}
 
 	if !reflect.DeepEqual(c, e) {
@@ -102,10 +111,594 @@ invars[c d]
 		Prefix:    "apref",
 		Extravars: []string{"avars.ninja"},
 		Cflags:    "aflags",
+		Ruledeps:  map[string][]string{},
+	}
+
+	if !reflect.DeepEqual(fc, fe) {
+		t.Errorf("Flavor config didn't match expected, got:")
+		t.Errorf("%#v", fc)
+	}
+}
+
+func TestParseConfigToolchain(t *testing.T) {
+	r := strings.NewReader(`
+flavors[dev release]
+toolchains[
+	arm:triple=arm-linux-gnueabihf
+	arm:sysroot=/opt/arm
+	mac:triple=x86_64-apple-darwin
+	mac:cc=o64-clang
+]
+toolchain[arm]
+toolchain:release[mac]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+
+	etc := map[string]*Toolchain{
+		"arm": {Name: "arm", Triple: "arm-linux-gnueabihf", Sysroot: "/opt/arm"},
+		"mac": {Name: "mac", Triple: "x86_64-apple-darwin", CC: "o64-clang"},
+	}
+	if !reflect.DeepEqual(ops.Config.Toolchains, etc) {
+		t.Errorf("Toolchains didn't match expected, got %#v", ops.Config.Toolchains)
+	}
+	if !ops.Config.Conditions["linux"] || !ops.Config.Conditions["arm"] {
+		t.Errorf("Missing toolchain conditions, got %v", ops.Config.Conditions)
+	}
+	if fc := ops.FlavorConfigs["release"]; fc.Toolchain != "mac" {
+		t.Errorf("Wrong release toolchain %q", fc.Toolchain)
+	}
+
+	conds := strings.Join(ops.FlavorConditions("release"), " ")
+	if conds != "clang darwin x86_64" {
+		t.Errorf("Wrong release conditions %q", conds)
+	}
+	if conds := strings.Join(ops.FlavorConditions("dev"), " "); conds != "arm gcc linux" {
+		t.Errorf("Wrong dev conditions %q", conds)
+	}
+	hconds := ops.HostConditions()
+	for _, c := range append(hostConditions(), "gcc") {
+		found := false
+		for _, hc := range hconds {
+			found = found || hc == c
+		}
+		if !found {
+			t.Errorf("Host condition %s missing from %v", c, hconds)
+		}
+	}
+
+	mac := ops.FlavorToolchain("release")
+	if cxx := mac.CXXCompiler(); cxx != "o64-clang++" {
+		t.Errorf("Wrong cxx %q", cxx)
+	}
+	if ar := mac.Archiver(); ar != "x86_64-apple-darwin-ar" {
+		t.Errorf("Wrong ar %q", ar)
+	}
+	goos, goarch := ops.FlavorToolchain("dev").GoOSArch()
+	if goos != "linux" || goarch != "arm" {
+		t.Errorf("Wrong goos/goarch %s/%s", goos, goarch)
+	}
+}
+
+func TestParseConfigFlavorParent(t *testing.T) {
+	r := strings.NewReader(`
+flavors[release release-asan:release asan-static:release-asan]
+prefix:release[opt]
+cflags:release[-DNDEBUG]
+extravars:release[release.ninja]
+cflags:release-asan[-fsanitize=address]
+prefix:asan-static[static]
+extravars:asan-static[static.ninja]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+
+	if chain := ops.FlavorChain("asan-static"); !reflect.DeepEqual(chain, []string{"release", "release-asan", "asan-static"}) {
+		t.Errorf("Bad flavor chain %v", chain)
 	}
 
+	fc := ops.FlavorConfigs["asan-static"]
+	fe := &FlavorConfig{
+		Prefix:    "static",
+		Extravars: []string{"release.ninja", "static.ninja"},
+		Cflags:    "-DNDEBUG -fsanitize=address",
+		Ruledeps:  map[string][]string{},
+	}
 	if !reflect.DeepEqual(fc, fe) {
 		t.Errorf("Flavor config didn't match expected, got:")
 		t.Errorf("%#v", fc)
 	}
+	if fc := ops.FlavorConfigs["release"]; !reflect.DeepEqual(fc.Extravars, []string{"release.ninja"}) {
+		t.Errorf("Parent flavor config modified: %#v", fc)
+	}
+}
+
+// Records the arguments of each descriptor parsed from it.
+type argsDesc struct {
+	Descriptor
+	flavor string
+	parsed map[string]map[string][]string // Keyed by flavor.
+}
+
+func (a *argsDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
+	return &argsDesc{flavor: flavors[0], parsed: a.parsed}
+}
+
+func (a *argsDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
+	a.parsed[a.flavor] = args
+	return a
+}
+
+func TestParseDescriptorFlavorParent(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.ParseConfig("", NewScanner(ioutil.NopCloser(strings.NewReader(`
+flavors[release release-asan:release asan-static:release-asan]
+)`)), "test"), nil)
+
+	s := NewScanner(ioutil.NopCloser(strings.NewReader(`prog
+	srcs[main.c]
+	srcs:release[release.c]
+	srcs:release-asan[asan.c asan2.c]
+	copts:release[-O2]
+	libs:asan-static[static]
+)`)), "test")
+	parsed := make(map[string]map[string][]string)
+	dp := &DescParser{ops, &argsDesc{parsed: parsed}}
+	dp.Parse("", s, nil)
+
+	expt := map[string]map[string][]string{
+		"release": {
+			"srcs":  {"main.c", "release.c"},
+			"copts": {"-O2"},
+		},
+		"release-asan": {
+			"srcs":  {"main.c", "asan.c", "asan2.c"},
+			"copts": {"-O2"},
+		},
+		"asan-static": {
+			"srcs":  {"main.c", "asan.c", "asan2.c"},
+			"copts": {"-O2"},
+			"libs":  {"static"},
+		},
+	}
+	if !reflect.DeepEqual(parsed, expt) {
+		t.Errorf("Bad flavored arguments %v", parsed)
+	}
+}
+
+func TestParseConfigFlavorBadParent(t *testing.T) {
+	r := strings.NewReader(`
+flavors[release-asan:release release]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	defer func() {
+		p := recover()
+		if perr, ok := p.(*ParseError); !ok || perr.Err != BadFlavorParent {
+			t.Errorf("Expected BadFlavorParent, got %v", p)
+		}
+	}()
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+}
+
+func TestParseConfigOptimization(t *testing.T) {
+	r := strings.NewReader(`
+flavors[release pgo-gen:release pgo:release]
+lto:release[]
+pgo_generate:pgo-gen[]
+pgo_use:pgo[pgo-gen]
+ruledeps:pgo[link:extra.stamp]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+
+	fe := &FlavorConfig{
+		Ruledeps: map[string][]string{"link": {"extra.stamp"}},
+		LTO:      "auto",
+		PGOUse:   "pgo-gen",
+	}
+	if fc := ops.FlavorConfigs["pgo"]; !reflect.DeepEqual(fc, fe) {
+		t.Errorf("Flavor config didn't match expected, got:")
+		t.Errorf("%#v", fc)
+	}
+	if fc := ops.FlavorConfigs["pgo-gen"]; !fc.PGOGenerate || fc.LTO != "auto" {
+		t.Errorf("Bad pgo-gen flavor config %#v", fc)
+	}
+
+	ops.currentFlavor = "pgo"
+	deps := ops.flavorRuledeps("cc")
+	if len(deps) != 1 || deps[0] != ops.Config.Buildpath+"/obj/pgo/pgo/gcda/.stamp" {
+		t.Errorf("Bad cc flavor ruledeps %v", deps)
+	}
+}
+
+func TestOutputPGOMerge(t *testing.T) {
+	r := strings.NewReader(`
+flavors[dev pgo-gen pgo]
+pgo_generate:pgo-gen[]
+pgo_use:pgo[pgo-gen]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.CC = "gcc"
+	ops.CompilerFlavor = "gcc"
+	ops.ParseConfig("", s, nil)
+
+	// Only the training runs of the PROG built in the generating flavor.
+	for _, fl := range []string{"pgo-gen", "dev"} {
+		desc := ProgTemplate.NewFromTemplate("Builddesc", "prog", []string{fl}).(*ProgDesc)
+		desc.Srcdir = fl
+		desc.PGOTraining = []string{"-n,10"}
+		desc.CompileC(fl, "prog.c", "prog")
+		desc.Finalize(ops)
+		ops.Descriptors = append(ops.Descriptors, desc)
+	}
+	var buf bytes.Buffer
+	ops.outputPGOMerge(&buf, "pgo")
+	frombuilddir := ops.Config.Buildpath + "/obj/pgo-gen"
+	if line := strings.SplitN(buf.String(), "\n", 2)[0]; line != "build "+ops.pgoProfile("pgo")+": pgo_merge "+frombuilddir+"/pgo/pgo-gen/prog-0.stamp" {
+		t.Errorf("Bad pgo_merge edge %q", line)
+	}
+
+	defer func() {
+		if p, ok := recover().(*ParseError); !ok || p.Err != BadPGOFrom {
+			t.Errorf("Expected BadPGOFrom, got %v", p)
+		}
+	}()
+	ops.Config.ActiveFlavors = []string{"dev", "pgo"}
+	ops.outputPGOMerge(&buf, "pgo")
+}
+
+func TestParseConfigSandbox(t *testing.T) {
+	r := strings.NewReader(`
+flavors[dev audit]
+sandbox:audit[]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+
+	if !ops.FlavorConfigs["audit"].Sandbox || ops.FlavorConfigs["dev"].Sandbox {
+		t.Fatalf("Bad sandbox flavor configs")
+	}
+
+	ops.currentFlavor = "audit"
+	expt := `seb -tool sandbox -builddesc=lib/Builddesc -buildpath=build -in="lib/a.c $objdir/a.h" -out="$objdir/a.o" -depfile=$objdir/a.o.d --`
+	if sb := ops.sandboxVar("lib/Builddesc", "cc", "$objdir/a.o", []string{"lib/a.c", "$objdir/a.h"}); sb != expt {
+		t.Errorf("Bad sandbox var %q", sb)
+	}
+	if sb := ops.sandboxVar("lib/Builddesc", "gobuild", "$objdir/a", nil); sb != "" {
+		t.Errorf("Expected gobuild not to be sandboxed, got %q", sb)
+	}
+	ops.currentFlavor = "dev"
+	if sb := ops.sandboxVar("lib/Builddesc", "cc", "$objdir/a.o", nil); sb != "" {
+		t.Errorf("Expected dev not to be sandboxed, got %q", sb)
+	}
+	ops.Options.Sandbox = true
+	if sb := ops.sandboxVar("lib/Builddesc", "link", "$objdir/a", nil); sb == "" {
+		t.Errorf("Expected -sandbox to sandbox dev")
+	}
+}
+
+func TestParseConfigReproducible(t *testing.T) {
+	r := strings.NewReader(`
+reproducible[]
+buildpath[fromconfig]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.Options.Buildpath = "/tmp/repro/a"
+	ops.ParseConfig("", s, nil)
+
+	if !ops.Config.Reproducible {
+		t.Errorf("Expected reproducible to be set")
+	}
+	if ops.Config.Buildpath != "/tmp/repro/a" {
+		t.Errorf("Expected -buildpath to override CONFIG, got %q", ops.Config.Buildpath)
+	}
+
+	ops.SourceDateEpoch = "1700000000"
+	var buf bytes.Buffer
+	ops.outputReproducible(&buf)
+	for _, expt := range []string{"-ffile-prefix-map=$buildpath=build", "repro_env=SOURCE_DATE_EPOCH=1700000000\n", "ar_modifiers=D\n"} {
+		if !strings.Contains(buf.String(), expt) {
+			t.Errorf("Expected %q in output, got:\n%s", expt, buf.String())
+		}
+	}
+}
+
+// Runs the gobuild_tool of the rules with a fake seb, checking that the
+// reproducible go flags reach it.
+func TestReproducibleGobuildTool(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.Config.Reproducible = true
+	var buf bytes.Buffer
+	ops.outputGoFlagsVars(&buf)
+	vars := map[string]string{"gowork": "off", "go_offline_env": ""}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		vars[kv[0]] = kv[1]
+	}
+	i := strings.Index(assets.RulesNinja, "\ngobuild_tool=")
+	if i < 0 {
+		t.Fatal("Missing gobuild_tool")
+	}
+	tool := assets.RulesNinja[i+len("\ngobuild_tool="):]
+	tool = tool[:strings.IndexByte(tool, '\n')]
+	expand := func(s string) string {
+		return regexp.MustCompile(`\$(\$|\w+)`).ReplaceAllStringFunc(s, func(v string) string {
+			if v == "$$" {
+				return "$"
+			}
+			return vars[v[1:]]
+		})
+	}
+	vars["gobuild_flags"] = expand(vars["gobuild_flags"])
+	vars["gobuild_test_flags"] = expand(vars["gobuild_test_flags"])
+	cmdline := expand(tool)
+
+	dir, err := ioutil.TempDir("", "gobuild_tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "seb"), []byte("#!/bin/sh\nprintf '%s\\n' \"$GOBUILD_FLAGS\" \"$GOBUILD_TEST_FLAGS\" \"$@\"\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", cmdline+" -mode=test")
+	cmd.Env = append(os.Environ(), "PATH="+dir+":"+os.Getenv("PATH"), "GOBUILD_FLAGS=-v", "GOBUILD_TEST_FLAGS=-count=1 -short")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s failed: %v\n%s", cmdline, err, out)
+	}
+	if expt := "-v -trimpath -buildvcs=false\n-count=1 -short\n-tool\ngobuild\n-mode=test\n"; string(out) != expt {
+		t.Errorf("Bad gobuild_tool run %q, expected %q", out, expt)
+	}
+}
+
+func TestBuildversionCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "buildversion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	git := func(env []string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@example.com")
+		cmd.Env = append(cmd.Env, env...)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git(nil, "init", "-q")
+	git([]string{"GIT_COMMITTER_DATE=1600000000 +0000"}, "commit", "-q", "--allow-empty", "-m", "1")
+	git([]string{"GIT_COMMITTER_DATE=1700000000 +0000"}, "commit", "-q", "--allow-empty", "-m", "2")
+	first := git(nil, "rev-parse", "HEAD~1")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if c := buildversionCommit("1"); c != first {
+		t.Errorf("Bad commit for buildversion 1: %q, expected %q", c, first)
+	}
+	for _, bv := range []string{"", "x", "0", "3"} {
+		if c := buildversionCommit(bv); c != "HEAD" {
+			t.Errorf("Bad commit for buildversion %q: %q", bv, c)
+		}
+	}
+
+	if old, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+		defer os.Setenv("SOURCE_DATE_EPOCH", old)
+	}
+	ops := NewGlobalOps()
+	ops.Buildversion = "1"
+	ops.SetSourceDateEpoch()
+	if ops.SourceDateEpoch != "1600000000" {
+		t.Errorf("Bad SOURCE_DATE_EPOCH %q", ops.SourceDateEpoch)
+	}
+}
+
+func TestCompilerTool(t *testing.T) {
+	for _, tc := range []struct{ cc, flavor, tool, expt string }{
+		{"gcc", "gcc", "ar", "gcc-ar"},
+		{"gcc-9", "gcc", "ar", "gcc-ar-9"},
+		{"aarch64-linux-gnu-gcc", "gcc", "ar", "aarch64-linux-gnu-gcc-ar"},
+		{"clang-14", "clang", "ar", "llvm-ar-14"},
+		{"cc -std=gnu11", "gcc", "ar", "gcc-ar"},
+		{"cc", "clang", "profdata", "llvm-profdata"},
+	} {
+		if got := compilerTool(tc.cc, tc.flavor, tc.tool, tc.tool); got != tc.expt {
+			t.Errorf("compilerTool(%q) = %q, expected %q", tc.cc, got, tc.expt)
+		}
+	}
+}
+
+func TestGcovTool(t *testing.T) {
+	for _, tc := range []struct{ cc, flavor, expt string }{
+		{"gcc", "gcc", "gcov"},
+		{"gcc-12", "gcc", "gcov-12"},
+		{"aarch64-linux-gnu-gcc", "gcc", "aarch64-linux-gnu-gcov"},
+		{"clang-14", "clang", "llvm-cov-14 gcov"},
+		{"cc", "gcc", "gcov"},
+		{"", "clang", "llvm-cov gcov"},
+	} {
+		if got := gcovTool(tc.cc, tc.flavor); got != tc.expt {
+			t.Errorf("gcovTool(%q) = %q, expected %q", tc.cc, got, tc.expt)
+		}
+	}
+}
+
+func TestParseConfigGoCoverMin(t *testing.T) {
+	r := strings.NewReader(`
+go_cover_min[80.5]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+	if ops.Config.GoCoverMin != "80.5" {
+		t.Errorf("Bad go_cover_min %q", ops.Config.GoCoverMin)
+	}
+
+	defer func() {
+		if perr, ok := recover().(*ParseError); !ok || perr.Err != BadGoCoverMin {
+			t.Errorf("Expected BadGoCoverMin, got %v", perr)
+		}
+	}()
+	r = strings.NewReader(`
+go_cover_min[120]
+`)
+	NewGlobalOps().ParseConfig("", NewScanner(ioutil.NopCloser(r), "test"), nil)
+}
+
+func TestParseConfigSplitDebug(t *testing.T) {
+	r := strings.NewReader(`
+flavors[dev release]
+split_debug:release[]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+
+	if !ops.FlavorConfigs["release"].SplitDebug || ops.FlavorConfigs["dev"].SplitDebug {
+		t.Fatalf("Bad split_debug flavor configs")
+	}
+
+	target := &Target{Rule: "link", SplitDebug: true}
+	ops.currentFlavor = "release"
+	expt := []string{
+		"split_debug=seb -tool split-debug -out=$dest_bin/a -debug=$flavorroot/debug/dest_bin/a.debug -buildid-dir=$flavorroot/debug/.build-id -objcopy=$objcopy --",
+		"build_id_flags=-Wl,--build-id",
+	}
+	if vars := ops.splitDebugVars(target, "$dest_bin/a"); !reflect.DeepEqual(vars, expt) {
+		t.Errorf("Bad split_debug vars %q", vars)
+	}
+	ops.currentFlavor = "dev"
+	if vars := ops.splitDebugVars(target, "$dest_bin/a"); vars != nil {
+		t.Errorf("Expected dev not to split debug info, got %q", vars)
+	}
+}
+
+func TestParseConfigOffline(t *testing.T) {
+	r := strings.NewReader(`
+offline[]
+`)
+	s := NewScanner(ioutil.NopCloser(r), "test")
+
+	ops := NewGlobalOps()
+	ops.ParseConfig("", s, nil)
+	if !ops.Config.Offline {
+		t.Errorf("offline not set")
+	}
+	tgt := &Target{}
+	AddGodeps(tgt, ops)
+	if !reflect.DeepEqual(tgt.Deps, []string{ops.GoVendorStamp()}) {
+		t.Errorf("Bad deps %v", tgt.Deps)
+	}
+}
+
+func TestWriteGoWork(t *testing.T) {
+	top, err := ioutil.TempDir("", "gowork")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(top)
+	for _, f := range []struct{ name, content string }{
+		{"a/go.mod", "module example.com/a\n\ngo 1.21\n"},
+		{"b/go.mod", "module example.com/b\n\ngo 1.22.1\n\nrequire example.com/a v1.0.0\n"},
+	} {
+		if err := os.MkdirAll(path.Join(top, path.Dir(f.name)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(top, f.name), []byte(f.content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mod := findGoModule(path.Join(top, "b/cmd/b")); mod != path.Join(top, "b") {
+		t.Errorf("Bad module %q", mod)
+	}
+	if _, requires := parseGoMod(path.Join(top, "b/go.mod")); !requires {
+		t.Errorf("Expected b to require modules")
+	}
+
+	buildpath := path.Join(top, "build")
+	os.Mkdir(buildpath, 0777)
+	if err := writeGoWork(buildpath, []string{path.Join(top, "a"), path.Join(top, "b")}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path.Join(buildpath, "go.work"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expt := "// Generated by seb from the modules of the Go descriptors.\n\ngo 1.22.1\n\nuse (\n\t../a\n\t../b\n)\n"
+	if string(data) != expt {
+		t.Errorf("Bad go.work:\n%s", data)
+	}
+}
+
+func TestOutputFlavorNinjaSanitizers(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.CC = "clang"
+	ops.CompilerFlavor = "clang"
+	for fl, gosan := range map[string]string{"asan": "asan", "ubsan": "", "tsan": "race", "msan": "msan"} {
+		var buf bytes.Buffer
+		ops.outputFlavorNinja(&buf, fl)
+		out := buf.String()
+		if !strings.Contains(out, "\nsanitize_copts=-fsanitize=") || !strings.Contains(out, "\ngo_sanitize="+gosan+"\n") {
+			t.Errorf("Bad %s flavor ninja:\n%s", fl, out)
+		}
+		// The default warning flags are used.
+		if strings.Contains(out, "cwarnflags") {
+			t.Errorf("%s flavor sets cwarnflags:\n%s", fl, out)
+		}
+	}
+
+	// The sanitizer is passed to all the go builds and test runs.
+	for _, rule := range []string{"gobuild", "gobuildlib", "gotest", "gobench", "gocover"} {
+		i := strings.Index(assets.RulesNinja, "\nrule "+rule+"\n")
+		if i < 0 {
+			t.Fatalf("Missing rule %s", rule)
+		}
+		cmd := assets.RulesNinja[i:]
+		cmd = cmd[:strings.Index(cmd, "\n    description")]
+		if !strings.Contains(cmd, `-sanitize="$go_sanitize"`) {
+			t.Errorf("Rule %s doesn't pass the sanitizer:%s", rule, cmd)
+		}
+	}
+}
+
+func TestOutputFlavorNinjaMsanGcc(t *testing.T) {
+	ops := NewGlobalOps()
+	ops.CC = "gcc"
+	ops.CompilerFlavor = "gcc"
+
+	defer func() {
+		if p, ok := recover().(*ParseError); !ok || p.Err != BadMsanCompiler || p.Token != "gcc" {
+			t.Errorf("Expected BadMsanCompiler, got %v", p)
+		}
+	}()
+	ops.outputFlavorNinja(ioutil.Discard, "msan")
 }
@@ -0,0 +1,135 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CTestDesc struct {
+	LinkDesc
+
+	Args     []string
+	Env      []string
+	Timeout  string // Duration, empty for no limit.
+	ExitCode int
+	TAP      bool
+}
+
+var (
+	BadTimeout  = errors.New("Bad timeout, need a number of seconds or a duration like 2m")
+	BadExitCode = errors.New("Bad exit_code, need a number")
+)
+
+const ctestVar = "_ctest"
+
+// Targets collected into these variables are built by the check target of
+// each flavor.
+var checkVars = map[string]bool{ctestVar: true, testsVar: true}
+
+func (tmpl *CTestDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
+	return &CTestDesc{
+		LinkDesc: *tmpl.LinkDesc.NewFromTemplate(bd, tname, flavors),
+	}
+}
+
+func (c *CTestDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
+	desc := c.GenericParse(c, ops, realsrcdir, args, LinkerExtra("pch", "args", "env", "timeout", "exit_code", "tap"))
+	c.LinkerParse(realsrcdir, args)
+	c.Args = append(c.Args, args["args"]...)
+	c.Env = append(c.Env, args["env"]...)
+	if v := args["timeout"]; len(v) > 0 {
+		c.Timeout = parseTimeout(v[len(v)-1], c.Builddesc)
+	}
+	if v := args["exit_code"]; len(v) > 0 {
+		code, err := strconv.Atoi(v[len(v)-1])
+		if err != nil {
+			panic(&ParseError{BadExitCode, v[len(v)-1], c.Builddesc})
+		}
+		c.ExitCode = code
+	}
+	c.TAP = c.TAP || args["tap"] != nil
+	return desc
+}
+
+// Parses a timeout argument, plain numbers are seconds.
+func parseTimeout(arg, bd string) string {
+	if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+		return arg + "s"
+	}
+	if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+		return arg
+	}
+	panic(&ParseError{BadTimeout, arg, bd})
+}
+
+func (c *CTestDesc) Finalize(ops *GlobalOps) {
+	c.FinalizeCC(ops)
+
+	name := c.TargetName
+	objs := c.SuffixedObjs(".o", nil)
+
+	goobj := c.FinalizeGoSrcs(ops, "lib")
+	objs = append(objs, goobj...)
+	objs = append(objs, ops.ResolveLibsOurStatic(c.Libs)...)
+
+	ldlibs := ops.ResolveLibsExternal(c.Libs)
+	link := ops.ResolveLibsLinker(c.Link, c.Libs)
+	eas := []string{"ldlibs=" + strings.Join(ldlibs, " ")}
+	c.AddTarget(name, link, objs, "obj", "", eas, nil)
+
+	// The test is run from the directory of the Builddesc.
+	testdir := c.Srcdir
+	if testdir == "" {
+		testdir = "."
+	}
+	flags := []string{"-dir=" + testdir, fmt.Sprint("-exit-code=", c.ExitCode)}
+	if c.Timeout != "" {
+		flags = append(flags, "-timeout="+c.Timeout)
+	}
+	if c.TAP {
+		flags = append(flags, "-tap")
+	}
+	eas = []string{
+		"test_flags=" + strings.Join(flags, " "),
+		"test_env=" + strings.Join(c.Env, " "),
+		"test_args=" + strings.Join(c.Args, " "),
+	}
+	target := c.AddTarget(path.Join("ctest", name), "ctest", []string{name}, "destroot", "", eas, c.TargetOptions)
+	target.CollectAs = ctestVar
+
+	c.FinalizeAnalyse(ops)
+	c.GeneralDesc.Finalize(ops)
+}
+
+// Returns the targets of the descriptor built by the check target.
+func flavorCheckTargets(desc Descriptor) []string {
+	return flavorCollectedTargets(desc, checkVars)
+}
+
+// Returns the targets of the descriptor collected into any of vars. Unlike
+// CollectedVars, this can be used for the descriptors of a single flavor.
+func flavorCollectedTargets(desc Descriptor, vars map[string]bool) []string {
+	var ret []string
+	for tname, t := range desc.AllTargets() {
+		if vars[t.CollectAs] {
+			ret = append(ret, path.Join(t.ResolveDest(), tname))
+		}
+	}
+	return ret
+}
+
+var CTestTemplate = CTestDesc{
+	LinkDesc: LinkDesc{
+		GeneralDesc: GeneralDesc{
+			TargetOptions: map[string]bool{"all": true},
+		},
+		Picrules: false,
+		Link:     "link",
+	},
+}
@@ -18,6 +18,7 @@ import (
 type GeneralDesc struct {
 	Destdir       string          // Destination for the target.
 	TargetOptions map[string]bool // Default options for the target (see Descriptor.AddTarget)
+	Host          bool            // Built with the host toolchain since it's run during the build.
 
 	Srcdir    string
 	Builddesc string
@@ -70,6 +71,9 @@ var DefaultDescriptors = map[string]Descriptor{
 	"GOPROG":        &GoprogTemplate,
 	"GOMODULE":      &GomoduleTemplate,
 	"GOTEST":        &GotestTemplate,
+	"CTEST":         &CTestTemplate,
+	"TEST_SCRIPT":   &TestScriptTemplate,
+	"FUZZ_PROG":     &FuzzProgTemplate,
 	"TOOL_PROG":     &ToolProgTemplate,
 	"TOOL_INSTALL":  &ToolInstallTemplate,
 	"LIB":           &LibTemplate,
@@ -311,6 +315,7 @@ func (g *GeneralDesc) ResolveDeps(ops *GlobalOps, tname string) []string {
 	// depend on the compilation tool.
 	rule := g.Targets[tname].Rule
 	ret = append(ret, ops.Config.Ruledeps[rule]...)
+	ret = append(ret, ops.flavorRuledeps(rule)...)
 	return ret
 }
 
@@ -320,6 +325,11 @@ func (g *GeneralDesc) ResolveOrderDeps(target *Target) []string {
 
 func (g *GeneralDesc) OutputHeader(w io.Writer, objdir string) {
 	fmt.Fprintf(w, "objdir=$builddir/%s\n", objdir)
+	if g.Host {
+		for _, v := range hostToolchainVars {
+			fmt.Fprintf(w, "%s\n", v)
+		}
+	}
 	for _, ev := range g.Extravars {
 		fmt.Fprintf(w, "include %s\n", ev)
 	}
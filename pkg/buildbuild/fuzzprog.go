@@ -0,0 +1,163 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type FuzzProgDesc struct {
+	LinkDesc
+
+	Corpus   string // Seed corpus directory, relative the top directory.
+	FuzzTime string // Duration or number of runs like 1000x.
+	Args     []string
+	Env      []string
+}
+
+var (
+	BadFuzzCompiler = errors.New("FUZZ_PROG needs clang, libFuzzer isn't available with this compiler")
+)
+
+const fuzzVar = "_fuzz"
+
+// Flags used to compile and link the harness with libFuzzer.
+const fuzzSanitizeFlags = "-fsanitize=fuzzer,address"
+
+// Flags used to compile the libraries linked by the harness, adding the
+// coverage instrumentation without the libFuzzer main function.
+const fuzzLibSanitizeFlags = "-fsanitize=fuzzer-no-link,address"
+
+func (tmpl *FuzzProgDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
+	return &FuzzProgDesc{
+		LinkDesc: *tmpl.LinkDesc.NewFromTemplate(bd, tname, flavors),
+	}
+}
+
+func (f *FuzzProgDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
+	desc := f.GenericParse(f, ops, realsrcdir, args, LinkerExtra("pch", "corpus", "fuzztime", "args", "env"))
+	f.LinkerParse(realsrcdir, args)
+	if v := args["corpus"]; len(v) > 0 {
+		f.Corpus = path.Join(realsrcdir, v[len(v)-1])
+	}
+	f.FuzzTime = parseFuzzTime(args["fuzztime"], f.Builddesc)
+	f.Args = append(f.Args, args["args"]...)
+	f.Env = append(f.Env, args["env"]...)
+	f.Buildvars["copts"] = append(f.Buildvars["copts"], fuzzSanitizeFlags)
+	return desc
+}
+
+// Converts a fuzztime to the libFuzzer flag limiting the run.
+func libFuzzerTimeFlag(fuzztime string) string {
+	if strings.HasSuffix(fuzztime, "x") {
+		return "-runs=" + strings.TrimSuffix(fuzztime, "x")
+	}
+	d, _ := time.ParseDuration(fuzztime)
+	// libFuzzer only takes whole seconds, round up.
+	return fmt.Sprint("-max_total_time=", int64((d+time.Second-1)/time.Second))
+}
+
+// Panics unless the harness is compiled with clang in all the flavors it's
+// built for, gcc doesn't have libFuzzer.
+func (f *FuzzProgDesc) checkCompiler(ops *GlobalOps) {
+	if err := ops.FindCompilerCC(); err != nil {
+		panic(err)
+	}
+	for _, fl := range ops.Config.ActiveFlavors {
+		if !f.ValidForFlavor(fl) {
+			continue
+		}
+		if cc, compilerFlavor := ops.FlavorCompiler(fl); compilerFlavor != "clang" {
+			panic(&ParseError{BadFuzzCompiler, cc, f.Builddesc})
+		}
+	}
+}
+
+func (f *FuzzProgDesc) Finalize(ops *GlobalOps) {
+	f.checkCompiler(ops)
+	f.FinalizeCC(ops)
+
+	name := f.TargetName
+	objs := f.SuffixedObjs(".o", nil)
+	objs = append(objs, ops.ResolveLibsOurFuzz(f.Libs)...)
+
+	ldlibs := ops.ResolveLibsExternal(f.Libs)
+	link := ops.ResolveLibsLinker(f.Link, f.Libs)
+	eas := []string{"ldlibs=" + strings.Join(ldlibs, " "), "ldopts=$ldopts " + fuzzSanitizeFlags}
+	// The harness is built by default, but only fuzzed when asked for.
+	f.AddTarget(name, link, objs, "obj", "", eas, f.TargetOptions)
+
+	// New inputs are added to the first corpus directory, so the seeds are
+	// only read. Both the corpus and the crashes are kept next to the stamp.
+	fuzzdir := path.Join("$destroot", "fuzz", name)
+	fuzztime := f.FuzzTime
+	if fuzztime == "" {
+		fuzztime = defaultFuzzTime
+	}
+	fuzzargs := []string{libFuzzerTimeFlag(fuzztime), "-artifact_prefix=" + fuzzdir + "-crashes/"}
+	fuzzargs = append(fuzzargs, f.Args...)
+	fuzzargs = append(fuzzargs, fuzzdir+"-corpus")
+	var deps []string
+	if f.Corpus != "" {
+		fuzzargs = append(fuzzargs, f.Corpus)
+		deps = append(deps, f.Corpus)
+	}
+	eas = []string{
+		"fuzzdir=" + fuzzdir,
+		"test_env=" + strings.Join(f.Env, " "),
+		"test_args=" + strings.Join(fuzzargs, " "),
+	}
+	target := f.AddTarget(path.Join("fuzz", name), "fuzz_prog", []string{name}, "destroot", "", eas, nil)
+	target.Deps = deps
+	target.CollectAs = fuzzVar
+
+	f.FinalizeAnalyse(ops)
+	f.GeneralDesc.Finalize(ops)
+}
+
+// Returns true if the library is linked by a fuzz harness. It's then also
+// built with the fuzzer instrumentation, in $libdir/fuzz.
+func (ops *GlobalOps) isFuzzLib(name string) bool {
+	if ops.fuzzLibs == nil {
+		ops.fuzzLibs = make(map[string]bool)
+		for _, desc := range ops.Descriptors {
+			if f, ok := desc.(*FuzzProgDesc); ok {
+				for _, lib := range ops.ResolveLibs(f.Libs) {
+					ops.fuzzLibs[lib] = true
+				}
+			}
+		}
+	}
+	return ops.fuzzLibs[name]
+}
+
+// Adds a copy of the library and its objects compiled with the fuzzer
+// instrumentation, in $libdir/fuzz and $objdir/fuzz. They're only output in
+// clang flavors.
+func (l *LibDesc) addFuzzVariant(objs []string) {
+	l.addVariant("fuzz", objs, []string{"copts=$copts " + fuzzLibSanitizeFlags})
+}
+
+// The static libraries built with the fuzzer instrumentation, linked by
+// the harnesses.
+func (ops *GlobalOps) ResolveLibsOurFuzz(libs []string) []string {
+	var ret []string
+	for _, lib := range ops.ResolveLibsOur(libs) {
+		ret = append(ret, "$libdir/fuzz/"+lib.LibName())
+	}
+	return ret
+}
+
+var FuzzProgTemplate = FuzzProgDesc{
+	LinkDesc: LinkDesc{
+		GeneralDesc: GeneralDesc{
+			TargetOptions: map[string]bool{"all": true},
+		},
+		Picrules: false,
+		Link:     "link",
+	},
+}
@@ -47,6 +47,8 @@ type GlobalOps struct {
 		WithoutFlavors map[string]bool
 		Debug          bool
 		Quiet          bool
+		Sandbox        bool   // Sandbox all flavors, as if sandbox was set in CONFIG.
+		Buildpath      string // Overrides buildpath in CONFIG if set.
 	}
 	// Result of parsing CONFIG.
 	Config        Config
@@ -62,6 +64,8 @@ type GlobalOps struct {
 
 	// Cached output of BuildversionScript
 	Buildversion string
+	// Commit time used as SOURCE_DATE_EPOCH for reproducible builds.
+	SourceDateEpoch string
 
 	// All defined descriptors, some are for all flavors, some are duplicated for each flavor.
 	Descriptors []Descriptor
@@ -79,6 +83,14 @@ type GlobalOps struct {
 	// Targets can be collected in variables and then used in other targets.
 	CollectedVars map[string][]string
 
+	// The flavor currently being output.
+	currentFlavor string
+
+	// Libraries linked by tools, see isHostLib.
+	hostLibs map[string]bool
+	// Libraries linked by fuzz harnesses, see isFuzzLib.
+	fuzzLibs map[string]bool
+
 	// Callback to build plugins. As of go 1.8beta1, plugins can only be loaded from "main" package.
 	// See https://github.com/golang/go/issues/18120
 	BuildPlugin func(ops *GlobalOps, ppath string) error
@@ -9,17 +9,25 @@ import (
 
 type GoProgDesc struct {
 	LinkDesc
+	GoBuildFlags
 	Pkg    string
 	Mode   string
 	NoCgo  bool
 	GOOS   string
 	GOARCH string
+
+	SizeBudget int64  // Maximum size of the output, 0 if unlimited.
+	VersionVar string // Variable set to the build version, e.g. main.Version.
 }
 
 type GoTestDesc struct {
 	LinkDesc
+	GoBuildFlags
 	Pkg        string
 	Benchflags string
+	CoverPkg   []string // Packages to measure coverage of, instead of the tested one.
+	Fuzz       []string // Fuzz tests to add targets for.
+	FuzzTime   string   // How long to run each fuzz test, empty for the default.
 }
 
 func (tmpl *GoProgDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
@@ -36,10 +44,10 @@ func (tmpl *GoTestDesc) NewFromTemplate(bd, tname string, flavors []string) Desc
 }
 
 func (g *GoProgDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
-	lextra := LinkerExtra("gopkg", "nocgo", "goos", "goarch")
+	lextra := LinkerExtra(GoBuildExtra("gopkg", "nocgo", "goos", "goarch", "size_budget", "version_var")...)
 	// Go plugins currently does not support cgo disabled.
 	if g.Mode == "module" {
-		lextra = LinkerExtra("gopkg", "goos", "goarch")
+		lextra = LinkerExtra(GoBuildExtra("gopkg", "goos", "goarch", "size_budget", "version_var")...)
 	}
 	desc := g.GenericParse(g, ops, realsrcdir, args, lextra)
 	g.LinkerParse(realsrcdir, args)
@@ -47,6 +55,9 @@ func (g *GoProgDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]
 	g.NoCgo = args["nocgo"] != nil
 	g.GOOS = strings.Join(args["goos"], " ")
 	g.GOARCH = strings.Join(args["goarch"], " ")
+	g.SizeBudget = parseSizeBudget(args["size_budget"], g.Builddesc)
+	g.VersionVar = parseVersionVar(args["version_var"], g.Builddesc)
+	g.ParseGoBuildFlags(args)
 	return desc
 }
 
@@ -54,6 +65,13 @@ func AddGodeps(t *Target, ops *GlobalOps) {
 	if len(ops.Config.Godeps) > 0 {
 		t.Deps = append(t.Deps, ops.GodepsStamp())
 	}
+	// Without go_track_deps the targets are always run anyway.
+	if ops.Config.GoTrackDeps != "" {
+		t.Deps = append(t.Deps, ops.GoVersionStamp())
+	}
+	if ops.Config.Offline {
+		t.Deps = append(t.Deps, ops.GoVendorStamp())
+	}
 }
 
 func (g *GoProgDesc) Finalize(ops *GlobalOps) {
@@ -67,6 +85,8 @@ func (g *GoProgDesc) Finalize(ops *GlobalOps) {
 	if g.Pkg != "" {
 		eas = append(eas, "gopkg="+g.Pkg)
 	}
+	eas = append(eas, g.goBuildExtraargs()...)
+	g.addGoVet(ops, eas)
 	if g.NoCgo {
 		eas = append(eas, fmt.Sprintf("gomode=%s-nocgo", g.Mode))
 	} else {
@@ -87,15 +107,24 @@ func (g *GoProgDesc) Finalize(ops *GlobalOps) {
 	}
 	tgopts := filterGoTargetOptions(g.TargetOptions, ops)
 	target := g.AddTarget(tname, "gobuild", []string{g.Srcdir}, g.Destdir, "", eas, tgopts)
+	target.SplitDebug = true
 	AddGodeps(target, ops)
+	g.addVersionVar(target)
+	g.AddSizeCheck(tname, g.SizeBudget)
 	g.GeneralDesc.Finalize(ops)
 }
 
 func (g *GoTestDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
-	desc := g.GenericParse(g, ops, realsrcdir, args, LinkerExtra("gopkg", "benchflags"))
+	desc := g.GenericParse(g, ops, realsrcdir, args, LinkerExtra(GoBuildExtra("gopkg", "benchflags", "coverpkg", "fuzz", "fuzztime")...))
 	g.LinkerParse(realsrcdir, args)
 	g.Pkg = strings.Join(args["gopkg"], " ")
 	g.Benchflags = strings.Join(args["benchflags"], " ")
+	g.CoverPkg = append(g.CoverPkg, args["coverpkg"]...)
+	g.Fuzz = append(g.Fuzz, parseFuzz(args["fuzz"], g.Builddesc)...)
+	if ft := parseFuzzTime(args["fuzztime"], g.Builddesc); ft != "" {
+		g.FuzzTime = ft
+	}
+	g.ParseGoBuildFlags(args)
 	return desc
 }
 
@@ -111,6 +140,8 @@ func (g *GoTestDesc) Finalize(ops *GlobalOps) {
 	if g.Pkg != "" {
 		eas = append(eas, "gopkg="+g.Pkg)
 	}
+	eas = append(eas, g.goBuildExtraargs()...)
+	g.addGoVet(ops, eas)
 
 	eas = append(eas, "gomode=test-prog")
 	tgopts := filterGoTargetOptions(g.TargetOptions, ops)
@@ -123,14 +154,21 @@ func (g *GoTestDesc) Finalize(ops *GlobalOps) {
 	AddGodeps(target, ops)
 	target.CollectAs = "_gotest"
 
-	target = g.AddTarget("gocover/"+name+"-coverage", "gocover", []string{g.Srcdir}, "destroot", "", eas, opts)
+	coveas := eas
+	if len(g.CoverPkg) > 0 {
+		coveas = append(eas[:len(eas):len(eas)], "gocoverpkg="+strings.Join(g.CoverPkg, ","))
+	}
+	target = g.AddTarget("gocover/"+name+"-coverage", "gocover", []string{g.Srcdir}, "destroot", "", coveas, opts)
 	AddGodeps(target, ops)
+	target.CollectAs = gocoverProfileVar
 
 	target = g.AddTarget("gocover/"+name+".html", "gocover_html", []string{"gocover/" + name + "-coverage"}, "destroot", "", eas, nil)
 	target.CollectAs = "_gocover"
 
 	g.AddTarget("gocover/"+name+"-coverage.html", "gocover_html", []string{"gocover/" + name + "-coverage"}, "destroot", "", eas, nil)
 
+	g.addFuzzTargets(ops, eas, opts)
+
 	if g.Benchflags != "" {
 		eas = append(eas, "benchflags="+g.Benchflags)
 	} else {
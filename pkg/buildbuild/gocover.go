@@ -0,0 +1,39 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const gocoverProfileVar = "_gocoverprofile"
+
+// The profiles merged into the coverage report of each flavor.
+var coverProfileVars = map[string]bool{gocoverProfileVar: true}
+
+// The merged coverage of a flavor is put here, in a directory so that it
+// can't clash with the reports of the GOTEST descriptors.
+const gocoverMergedDir = "$destroot/gocover/merged"
+
+// Outputs the gocover target of the flavor, building the coverage report of
+// each GOTEST and the merged one.
+func (ops *GlobalOps) outputGoCover(w io.Writer, destdir string, profiles []string) {
+	reports := ops.CollectedVars["_gocover"]
+	if len(profiles) > 0 {
+		out := gocoverMergedDir + "/coverage.out"
+		json := gocoverMergedDir + "/coverage.json"
+		text := gocoverMergedDir + "/coverage.txt"
+		html := gocoverMergedDir + "/coverage.html"
+		fmt.Fprintf(w, "build %s | %s %s: gocover_merge %s\n", out, json, text, strings.Join(profiles, " "))
+		fmt.Fprintf(w, "    gocover_flags=-json=%s -text=%s", json, text)
+		if ops.Config.GoCoverMin != "" {
+			fmt.Fprintf(w, " -min=%s", ops.Config.GoCoverMin)
+		}
+		fmt.Fprintf(w, "\n")
+		fmt.Fprintf(w, "build %s: gocover_html %s\n", html, out)
+		reports = append(reports[:len(reports):len(reports)], html, json)
+	}
+	fmt.Fprintf(w, "build %s/gocover: phony %s\n", destdir, strings.Join(reports, " "))
+}
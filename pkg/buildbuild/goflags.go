@@ -0,0 +1,58 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"strings"
+)
+
+// Go build flags of a GOPROG or GOTEST, forwarded to the gobuild tool.
+type GoBuildFlags struct {
+	Tags      []string
+	Gcflags   []string
+	GoLdflags []string
+	Race      bool
+}
+
+// Return keys handled by GoBuildFlags.ParseGoBuildFlags to pass to
+// GenericParse.
+func GoBuildExtra(extra ...string) []string {
+	return append(extra, "gotags", "gcflags", "go_ldflags", "race")
+}
+
+func (f *GoBuildFlags) ParseGoBuildFlags(args map[string][]string) {
+	f.Tags = append(f.Tags, args["gotags"]...)
+	f.Gcflags = append(f.Gcflags, args["gcflags"]...)
+	f.GoLdflags = append(f.GoLdflags, args["go_ldflags"]...)
+	f.Race = f.Race || args["race"] != nil
+}
+
+// Returns the extra args setting the variables used by the gobuild rules.
+// race overrides the sanitizer of the flavor.
+func (f *GoBuildFlags) goBuildExtraargs() []string {
+	var eas []string
+	if len(f.Tags) > 0 {
+		eas = append(eas, "gotags="+strings.Join(f.Tags, ","))
+	}
+	if len(f.Gcflags) > 0 {
+		eas = append(eas, "gcflags="+strings.Join(f.Gcflags, " "))
+	}
+	if len(f.GoLdflags) > 0 {
+		eas = append(eas, "go_ldflags="+strings.Join(f.GoLdflags, " "))
+	}
+	if f.Race {
+		eas = append(eas, "go_sanitize=race")
+	}
+	return eas
+}
+
+// Adds a target running go vet on the package, included in the analyse
+// target of the flavor.
+func (l *LinkDesc) addGoVet(ops *GlobalOps, eas []string) {
+	tname := l.TargetName + ".target_analyze"
+	// The source directory can be named like the GOPROG target, the ./
+	// makes sure it's resolved to the directory.
+	target := l.AddTarget(tname, "govet", []string{"./" + l.Srcdir}, "obj", "", eas, map[string]bool{"incdeps": true})
+	AddGodeps(target, ops)
+	l.addAnalyser(ops, tname)
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	BadFuzz     = errors.New("Bad fuzz target, need the name of a FuzzXxx function")
+	BadFuzzTime = errors.New("Bad fuzztime, need a duration like 30s or a number of iterations like 1000x")
+)
+
+const gofuzzVar = "_gofuzz"
+
+// How long each fuzz target runs unless fuzztime is given.
+const defaultFuzzTime = "30s"
+
+func parseFuzz(args []string, bd string) []string {
+	for _, f := range args {
+		if !strings.HasPrefix(f, "Fuzz") {
+			panic(&ParseError{BadFuzz, f, bd})
+		}
+	}
+	return args
+}
+
+// Parses a fuzztime argument, with the syntax of go test -fuzztime, using
+// the last value.
+func parseFuzzTime(args []string, bd string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	arg := args[len(args)-1]
+	if n, err := strconv.Atoi(strings.TrimSuffix(arg, "x")); strings.HasSuffix(arg, "x") && err == nil && n > 0 {
+		return arg
+	}
+	if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+		return arg
+	}
+	panic(&ParseError{BadFuzzTime, arg, bd})
+}
+
+// Adds a target running each fuzz test for a bounded time.
+func (g *GoTestDesc) addFuzzTargets(ops *GlobalOps, eas []string, opts map[string]bool) {
+	fuzztime := g.FuzzTime
+	if fuzztime == "" {
+		fuzztime = defaultFuzzTime
+	}
+	for _, fuzz := range g.Fuzz {
+		feas := append(eas[:len(eas):len(eas)], "gofuzz="+fuzz, "fuzztime="+fuzztime)
+		target := g.AddTarget("gofuzz/"+g.TargetName+"/"+fuzz, "gofuzz", []string{g.Srcdir}, "destroot", "", feas, opts)
+		AddGodeps(target, ops)
+		target.CollectAs = gofuzzVar
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	BadVersionVar = errors.New("Bad version_var, need a package qualified variable like main.Version")
+)
+
+// Parses a version_var argument, using the last value.
+func parseVersionVar(args []string, bd string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	arg := args[len(args)-1]
+	dot := strings.LastIndexByte(arg, '.')
+	if dot <= 0 || dot == len(arg)-1 || strings.ContainsAny(arg, " \"'") {
+		panic(&ParseError{BadVersionVar, arg, bd})
+	}
+	return arg
+}
+
+// Adds the flags making the gobuild tool set the version variables with
+// -ldflags -X. Only the link step depends on them, so the packages stay
+// cached. The dependency on the version header makes the program rebuild
+// when the build version changes.
+func (g *GoProgDesc) addVersionVar(target *Target) {
+	if g.VersionVar == "" {
+		return
+	}
+	target.Deps = append(target.Deps, "$incdir/build_version_$buildversion.h")
+	target.Extraargs = append(target.Extraargs, `go_version_flags=-version-var=`+g.VersionVar+` -version="$buildversion" -flavor="$buildflavor" -conditions="$buildconditions"`)
+}
@@ -0,0 +1,192 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	GoVendorMissing = errors.New("Go module has no vendor directory, needed by offline, run go mod vendor")
+)
+
+// The oldest go version supporting go.work.
+const minGoWorkVersion = "1.18"
+
+// Returns the directory containing the go.mod of dir or one of its parents,
+// or "" if there isn't any. Paths are relative the top directory.
+func findGoModule(dir string) string {
+	for {
+		if dir == "" {
+			dir = "."
+		}
+		if _, err := os.Stat(path.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		if dir == "." || dir == "/" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// Returns the modules containing the packages of the Go descriptors, mapped
+// to the Builddesc of one of the descriptors. Descriptors with gopkg are
+// skipped since the package is usually downloaded.
+func (ops *GlobalOps) goModules() map[string]string {
+	mods := make(map[string]string)
+	for _, desc := range ops.Descriptors {
+		var srcdir, bd string
+		switch d := desc.(type) {
+		case *GoProgDesc:
+			if d.Pkg != "" {
+				continue
+			}
+			srcdir, bd = d.Srcdir, d.Builddesc
+		case *GoTestDesc:
+			if d.Pkg != "" {
+				continue
+			}
+			srcdir, bd = d.Srcdir, d.Builddesc
+		default:
+			continue
+		}
+		if mod := findGoModule(srcdir); mod != "" && mods[mod] == "" {
+			mods[mod] = bd
+		}
+	}
+	return mods
+}
+
+func sortedModules(mods map[string]string) []string {
+	ret := make([]string, 0, len(mods))
+	for mod := range mods {
+		ret = append(ret, mod)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Returns the version of the go directive in a go.mod, "" if there's none,
+// and whether it requires any modules.
+func parseGoMod(gomod string) (version string, requires bool) {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[0] == "go" {
+			version = fields[1]
+		}
+		if len(fields) > 0 && fields[0] == "require" {
+			requires = true
+		}
+	}
+	return
+}
+
+// Writes a go.work using the modules to the build path, if it changed.
+func writeGoWork(toppath string, mods []string) error {
+	abstop, err := filepath.Abs(toppath)
+	if err != nil {
+		return err
+	}
+	version := minGoWorkVersion
+	var uses []string
+	for _, mod := range mods {
+		if v, _ := parseGoMod(path.Join(mod, "go.mod")); comparableVersion(v) > comparableVersion(version) {
+			version = v
+		}
+		absmod, err := filepath.Abs(mod)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(abstop, absmod)
+		if err != nil {
+			return err
+		}
+		uses = append(uses, rel)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Generated by seb from the modules of the Go descriptors.\n\ngo %s\n\nuse (\n", version)
+	for _, u := range uses {
+		fmt.Fprintf(&buf, "\t%s\n", u)
+	}
+	fmt.Fprintf(&buf, ")\n")
+
+	gowork := path.Join(toppath, "go.work")
+	if old, _ := ioutil.ReadFile(gowork); bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	return ioutil.WriteFile(gowork, buf.Bytes(), 0666)
+}
+
+// Outputs the variables controlling how the go command finds modules, used
+// by gobuild_tool. If the Go descriptors are in more than one module, a
+// go.work using them is generated. In offline mode each module is instead
+// built from its own vendor directory, without network access. The module
+// directories are also listed in gomoddirs, used where the packages of more
+// than one module are needed without the generated go.work.
+func (ops *GlobalOps) outputGoWorkVars(w io.Writer, toppath string) {
+	mods := sortedModules(ops.goModules())
+	fmt.Fprintf(w, "gomoddirs=%s\n", strings.Join(mods, " "))
+	switch {
+	case ops.Config.Offline:
+		fmt.Fprintf(w, "gowork=off\n")
+		fmt.Fprintf(w, "go_offline_env=GOFLAGS=-mod=vendor GOPROXY=off\n")
+	case len(mods) > 1:
+		mkpath(toppath)
+		if err := writeGoWork(toppath, mods); err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(w, "gowork=%s\n", path.Join(toppath, "go.work"))
+	default:
+		fmt.Fprintf(w, "gowork=$$GOWORK\n")
+	}
+}
+
+// Stamp written when the vendor directories of the modules are in sync.
+func (ops *GlobalOps) GoVendorStamp() string {
+	return path.Join(ops.Config.Buildpath, "obj/_go/vendor_check")
+}
+
+// Outputs the target checking that the vendor directories of the modules
+// are in sync with go.mod and have all the imported packages. All Go targets
+// depend on it in offline mode.
+func (ops *GlobalOps) outputGoVendorCheck(w io.Writer, toppath string) {
+	if !ops.Config.Offline {
+		return
+	}
+	modbds := ops.goModules()
+	mods := sortedModules(modbds)
+	var ins []string
+	for _, mod := range mods {
+		gomod := path.Join(mod, "go.mod")
+		ins = append(ins, gomod)
+		// Modules without requirements don't need to vendor anything.
+		if _, requires := parseGoMod(gomod); !requires {
+			continue
+		}
+		modules := path.Join(mod, "vendor/modules.txt")
+		if _, err := os.Stat(modules); err != nil {
+			panic(&ParseError{GoVendorMissing, mod, modbds[mod]})
+		}
+		ins = append(ins, modules)
+	}
+	fmt.Fprintf(w, "build %s: go_vendor_check %s\n", ops.GoVendorStamp(), strings.Join(ins, " "))
+	mkpath(toppath, "obj/_go")
+}
@@ -78,6 +78,7 @@ func (id *InstallDesc) Finalize(ops *GlobalOps) {
 var ToolInstallTemplate = InstallDesc{
 	GeneralDesc: GeneralDesc{
 		Destdir: "dest_tool",
+		Host:    true,
 	},
 }
 
@@ -30,7 +30,7 @@ func (tmpl *LibDesc) NewFromTemplate(bd, tname string, flavors []string) Descrip
 }
 
 func (l *LibDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
-	desc := l.GenericParse(l, ops, realsrcdir, args, LinkerExtra("includes", "incprefix"))
+	desc := l.GenericParse(l, ops, realsrcdir, args, LinkerExtra("includes", "incprefix", "pch"))
 	l.LinkerParse(realsrcdir, args)
 
 	l.Includes = append(l.Includes, args["includes"]...)
@@ -67,6 +67,12 @@ func (l *LibDesc) Finalize(ops *GlobalOps) {
 			l.AddTarget("lib"+libname+".a", "ar", objs, l.Destdir, "", nil, l.TargetOptions)
 			l.AddTarget("lib"+libname+"_pic.a", "ar", picobjs, l.Destdir, "", nil, l.TargetOptions)
 		}
+		if ops.isHostLib(libname) {
+			l.addHostVariant(objs)
+		}
+		if ops.isFuzzLib(libname) {
+			l.addFuzzVariant(objs)
+		}
 	}
 
 	l.Deps["depend_includes_"+libname] = l.ResolveIncdeps(ops)
@@ -76,6 +82,46 @@ func (l *LibDesc) Finalize(ops *GlobalOps) {
 	l.GeneralDesc.Finalize(ops)
 }
 
+// Adds a copy of the library and its objects in a subdirectory named after
+// the variant, compiled with the extra variables. The target option with the
+// variant name lets OutputDescriptor skip them in flavors not needing them.
+// The precompiled header is skipped since it's built without the variables.
+func (l *LibDesc) addVariant(variant string, objs []string, eas []string) {
+	var vobjs []string
+	for _, o := range objs {
+		t := l.Targets[o]
+		if t == nil {
+			continue
+		}
+		vt := *t
+		vt.Extraargs = nil
+		for _, ea := range t.Extraargs {
+			if !strings.HasPrefix(ea, "pch=") && !strings.HasPrefix(ea, "pchflags=") {
+				vt.Extraargs = append(vt.Extraargs, ea)
+			}
+		}
+		vt.Extraargs = append(vt.Extraargs, eas...)
+		vt.Deps = nil
+		for _, d := range t.Deps {
+			if !strings.HasPrefix(d, "$objdir/pch/") {
+				vt.Deps = append(vt.Deps, d)
+			}
+		}
+		vt.Options = map[string]bool{variant: true, "incdeps": t.Options["incdeps"]}
+		vname := path.Join(variant, o)
+		l.Targets[vname] = &vt
+		if d := l.Deps[o]; d != nil {
+			l.Deps[vname] = d
+		}
+		vobjs = append(vobjs, vname)
+	}
+	rule := "ar"
+	if l.LinkSet {
+		rule = "partiallink"
+	}
+	l.AddTarget(path.Join(variant, l.LibName()), rule, vobjs, l.Destdir, "", eas, map[string]bool{variant: true})
+}
+
 func (l *LibDesc) IsDummyLib() bool {
 	return len(l.Objs) == 0
 }
@@ -205,7 +251,23 @@ func (ops *GlobalOps) ResolveLibsOurStatic(libs []string) []string {
 	return ret
 }
 
+// The static libraries built with the host toolchain, linked by tools. The
+// $host_libdir variable is $libdir unless the flavor uses a cross
+// compilation toolchain.
+func (ops *GlobalOps) ResolveLibsOurHost(libs []string) []string {
+	var ret []string
+	for _, lib := range ops.ResolveLibsOur(libs) {
+		ret = append(ret, "$host_libdir/"+lib.LibName())
+	}
+	return ret
+}
+
+// With pic_only in CONFIG the static libraries already contain pic objects,
+// and are used instead of the pic ones.
 func (ops *GlobalOps) ResolveLibsOurPic(libs []string) []string {
+	if ops.Config.PicOnly {
+		return ops.ResolveLibsOurStatic(libs)
+	}
 	var ret []string
 	for _, lib := range ops.ResolveLibsOur(libs) {
 		ret = append(ret, "$libdir/"+lib.PiclibName())
@@ -227,6 +289,9 @@ func (ops *GlobalOps) ResolveLibsOurStaticAsLib(libs []string) ([]string, []stri
 }
 
 func (ops *GlobalOps) ResolveLibsOurPicAsLib(libs []string) ([]string, []string) {
+	if ops.Config.PicOnly {
+		return ops.ResolveLibsOurStaticAsLib(libs)
+	}
 	var objs, llibs []string
 	for _, lib := range ops.ResolveLibsOur(libs) {
 		name, islib := lib.NameAsPiclib()
@@ -14,6 +14,7 @@ type LinkDesc struct {
 	GeneralDesc
 
 	Picrules bool
+	PicOnly  bool // Only the pic_o objects are built, set from CONFIG when finalizing.
 	Link     string
 
 	Incdirs  []string
@@ -25,6 +26,12 @@ type LinkDesc struct {
 
 	GoNoInit bool
 
+	Pch       string // Header to precompile, relative PchSrcdir.
+	PchSrcdir string
+
+	Unity        int      // Max number of sources per unity batch, 0 to disable.
+	UnityBatched []string // Objects replaced by unity batches in Objs.
+
 	NoAnalyse   bool
 	DontAnalyse map[string]bool
 
@@ -45,7 +52,7 @@ var linkerBuildvars = []string{"copts", "cflags", "cxxflags", "conlyflags", "cwa
 
 // Return keys handled by LinkDesc.Parse to pass to GenericParse
 func LinkerExtra(extra ...string) []string {
-	extra = append(extra, "incdirs", "no_analyse", "libs", "go_noinit")
+	extra = append(extra, "incdirs", "no_analyse", "libs", "go_noinit", "unity")
 	extra = append(extra, linkerBuildvars...)
 	for k := range PluginLinkerParams {
 		extra = append(extra, k)
@@ -90,6 +97,15 @@ func (l *LinkDesc) LinkerParse(srcdir string, args map[string][]string) {
 
 	l.Libs = append(l.Libs, args["libs"]...)
 
+	if len(args["unity"]) > 0 {
+		l.parseUnity(args["unity"])
+	}
+
+	if len(args["pch"]) > 0 {
+		l.Pch = args["pch"][0]
+		l.PchSrcdir = srcdir
+	}
+
 	for pv, pfun := range PluginLinkerParams {
 		if len(args[pv]) > 0 {
 			pfun(l, args[pv])
@@ -110,27 +126,49 @@ func (l *LinkDesc) FinalizeIncdeps(ops *GlobalOps) {
 }
 
 func (l *LinkDesc) FinalizeCC(ops *GlobalOps) {
+	l.FinalizeUnity(ops)
+	if ops.Config.PicOnly {
+		// Every object is compiled once as pic. Libraries use the pic_o
+		// targets for both archives, other descriptors get picflag added.
+		l.PicOnly = l.Picrules
+		for _, o := range l.Objs {
+			if l.Picrules {
+				delete(l.Targets, o+".o")
+			} else if t := l.Targets[o+".o"]; t != nil {
+				t.Extraargs = append(t.Extraargs, "picflag=-fPIC")
+			}
+		}
+	}
 	if len(l.Objs) > 0 {
 		l.FinalizeIncdeps(ops)
 		ops.VersionChecks["cc"] = ops.FindCompilerCC
+		l.FinalizePch(ops)
 	}
 }
 
 func (l *LinkDesc) FinalizeAnalyse(ops *GlobalOps) {
-	objs := l.SuffixedObjs(".analyse", func(base string) bool { return !l.DontAnalyse[base] })
+	// Unity batches are analysed per source.
+	objs := l.SuffixedObjs(".analyse", func(base string) bool { return !l.DontAnalyse[base] && l.Targets[base+".analyse"] != nil })
+	for _, o := range l.UnityBatched {
+		if !l.DontAnalyse[o] {
+			objs = append(objs, o+".analyse")
+		}
+	}
 
 	if len(objs) > 0 {
 		tname := l.TargetName
-		srcdir := l.Srcdir
-
 		l.AddTarget(tname+".target_analyze", "copy_analyse", objs, "obj", "", nil, nil)
+		l.addAnalyser(ops, tname+".target_analyze")
+	}
+}
 
-		an := &Analyser{
-			TargetName:     path.Join(srcdir, tname, tname+".target_analyze"),
-			OnlyForFlavors: l.OnlyForFlavors,
-		}
-		ops.Analyses = append(ops.Analyses, an)
+// Adds an object directory target to the analyse target of the flavors.
+func (l *LinkDesc) addAnalyser(ops *GlobalOps, tname string) {
+	an := &Analyser{
+		TargetName:     path.Join(l.Srcdir, l.TargetName, tname),
+		OnlyForFlavors: l.OnlyForFlavors,
 	}
+	ops.Analyses = append(ops.Analyses, an)
 }
 
 func (l *LinkDesc) FinalizeGoSrcs(ops *GlobalOps, mode string) []string {
@@ -164,6 +202,7 @@ func (l *LinkDesc) FinalizeGoSrcs(ops *GlobalOps, mode string) []string {
 	}
 	lib := l.AddTarget("gosrc.a", "gobuildlib", []string{"$objdir/go"}, "objdir", "", eas, opts)
 	lib.Deps = append(lib.Deps, l.GoSrc...)
+	AddGodeps(lib, ops)
 	lib.IncdepsExcept["$objdir/gosrc.h"] = true
 
 	l.AddTarget("gosrc.h", "phony", []string{"$objdir/gosrc.a"}, "objdir", "", nil, nil)
@@ -171,7 +210,12 @@ func (l *LinkDesc) FinalizeGoSrcs(ops *GlobalOps, mode string) []string {
 	return []string{"$objdir/gosrc.a"}
 }
 
+// Returns the objects with the given suffix. If PicOnly is set, asking for
+// .o objects returns the .pic_o ones since those are the only ones built.
 func (l *LinkDesc) SuffixedObjs(suff string, filter func(base string) bool) []string {
+	if l.PicOnly && suff == ".o" {
+		suff = ".pic_o"
+	}
 	objs := make([]string, 0, len(l.Objs))
 	for _, o := range l.Objs {
 		if filter == nil || filter(o) {
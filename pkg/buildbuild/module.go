@@ -6,6 +6,10 @@ import "strings"
 
 type ModuleDesc struct {
 	LinkDesc
+
+	Exports         string // List of the exported symbols, relative ExportsSrcdir.
+	ExportsBaseline string // Symbols the module is checked against, relative ExportsSrcdir.
+	ExportsSrcdir   string
 }
 
 func (tmpl *ModuleDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
@@ -15,8 +19,15 @@ func (tmpl *ModuleDesc) NewFromTemplate(bd, tname string, flavors []string) Desc
 }
 
 func (m *ModuleDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
-	desc := m.GenericParse(m, ops, realsrcdir, args, LinkerExtra())
+	desc := m.GenericParse(m, ops, realsrcdir, args, LinkerExtra("pch", "exports", "exports_baseline"))
 	m.LinkerParse(realsrcdir, args)
+	if len(args["exports"]) > 0 {
+		m.Exports = args["exports"][0]
+	}
+	if len(args["exports_baseline"]) > 0 {
+		m.ExportsBaseline = args["exports_baseline"][0]
+	}
+	m.ExportsSrcdir = realsrcdir
 	return desc
 }
 
@@ -32,8 +43,25 @@ func (m *ModuleDesc) Finalize(ops *GlobalOps) {
 
 	ldlibs := ops.ResolveLibsExternal(m.Libs)
 	link := ops.ResolveLibsLinker(m.Link, m.Libs)
-	eas := []string{"ldflags=-rdynamic -fPIC -shared", "ldlibs=" + strings.Join(ldlibs, " ")}
-	m.AddTarget(mod, link, objs, m.Destdir, "", eas, m.TargetOptions)
+	ldflags := "-rdynamic -fPIC -shared"
+	vscript := m.TargetName + ".map"
+	if m.Exports != "" {
+		ldflags += " -Wl,--version-script=$objdir/" + vscript
+	}
+	eas := []string{"ldflags=" + ldflags, "ldlibs=" + strings.Join(ldlibs, " ")}
+	target := m.AddTarget(mod, link, objs, m.Destdir, "", eas, m.TargetOptions)
+	target.SplitDebug = true
+
+	// The symbol list, which may contain patterns, is turned into a version
+	// script. The linked module is checked against the separate baseline,
+	// so that adding a symbol to the list is still caught.
+	if m.Exports != "" {
+		m.AddTarget(vscript, "version_script", []string{m.Exports}, "obj", m.ExportsSrcdir, nil, nil)
+		target.Deps = append(target.Deps, vscript)
+	}
+	if m.ExportsBaseline != "" {
+		m.AddTarget(m.TargetName+".exports_check", "exports_check", []string{mod, m.ExportsBaseline}, "obj", m.ExportsSrcdir, nil, map[string]bool{"all": true})
+	}
 
 	m.FinalizeAnalyse(ops)
 	m.GeneralDesc.Finalize(ops)
@@ -0,0 +1,176 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	BadLTOMode = errors.New("Bad lto mode, need lto:flavor[], lto:flavor[full] or lto:flavor[thin]")
+	BadPGOUse  = errors.New("pgo_use flavor must have pgo_generate set")
+	BadPGOFrom = errors.New("pgo_use flavor needs its pgo_generate flavor to be built, it's not active")
+)
+
+// Collected variable with the training runs of PROGs.
+const pgoTrainingVar = "_pgo_training"
+
+// Returns the C compiler and its flavor (gcc or clang) used for the flavor.
+func (ops *GlobalOps) FlavorCompiler(flavor string) (cc, compilerFlavor string) {
+	cc, compilerFlavor = ops.CC, ops.CompilerFlavor
+	if tc := ops.FlavorToolchain(flavor); tc != nil {
+		cc = tc.CCompiler()
+		if strings.Contains(cc, "clang") {
+			compilerFlavor = "clang"
+		} else {
+			compilerFlavor = "gcc"
+		}
+	}
+	return
+}
+
+// Returns the binutils style tool matching the compiler, e.g. gcc-ar-9 for
+// gcc-9 or llvm-ar-14 for clang-14. gccTool and llvmTool are the suffixes to
+// use, like "ar".
+func compilerTool(cc, compilerFlavor, gccTool, llvmTool string) string {
+	ccbin := strings.Fields(cc)[0]
+	if idx := strings.LastIndex(ccbin, "gcc"); idx >= 0 {
+		return ccbin[:idx] + "gcc-" + gccTool + ccbin[idx+3:]
+	}
+	if idx := strings.LastIndex(ccbin, "clang"); idx >= 0 {
+		return ccbin[:idx] + "llvm-" + llvmTool + ccbin[idx+5:]
+	}
+	if compilerFlavor == "clang" {
+		return "llvm-" + llvmTool
+	}
+	return "gcc-" + gccTool
+}
+
+// The directory where instrumented binaries in a pgo_generate flavor write
+// their profile data. Has to be absolute since the training runs can change
+// the current directory.
+func (ops *GlobalOps) pgoDataDir(flavor string) string {
+	dir := path.Join(ops.Config.Buildpath, "obj", flavor, "pgo/data")
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+// The merged profile produced for a pgo_use flavor.
+func (ops *GlobalOps) pgoProfile(flavor string) string {
+	_, compilerFlavor := ops.FlavorCompiler(flavor)
+	if compilerFlavor == "clang" {
+		return path.Join(ops.Config.Buildpath, "obj", flavor, "pgo/merged.profdata")
+	}
+	return path.Join(ops.Config.Buildpath, "obj", flavor, "pgo/gcda/.stamp")
+}
+
+// Variables for link time and profile guided optimization.
+func (ops *GlobalOps) outputOptimizationNinja(w io.Writer, flavor string) {
+	conf := ops.FlavorConfigs[flavor]
+	if conf == nil {
+		return
+	}
+	cc, compilerFlavor := ops.FlavorCompiler(flavor)
+
+	if conf.LTO != "" {
+		mode := conf.LTO
+		if mode == "auto" {
+			mode = "full"
+			if compilerFlavor == "clang" {
+				mode = "thin"
+			}
+		}
+		flag := "-flto"
+		if mode == "thin" {
+			flag = "-flto=thin"
+		}
+		fmt.Fprintf(w, "lto_copts=%s\n", flag)
+		fmt.Fprintf(w, "lto_ldopts=%s\n", flag)
+		// Archives of LTO objects need the compiler plugin to get a symbol index.
+		fmt.Fprintf(w, "ar=%s\n", compilerTool(cc, compilerFlavor, "ar", "ar"))
+	}
+
+	if conf.PGOGenerate {
+		dir := ops.pgoDataDir(flavor)
+		fmt.Fprintf(w, "pgo_copts=-fprofile-generate=%s\n", dir)
+		fmt.Fprintf(w, "pgo_ldopts=-fprofile-generate=%s\n", dir)
+	}
+	if conf.PGOUse != "" {
+		profile := ops.pgoProfile(flavor)
+		if compilerFlavor == "clang" {
+			fmt.Fprintf(w, "pgo_copts=-fprofile-use=%s -Wno-profile-instr-out-of-date -Wno-profile-instr-unprofiled\n", profile)
+		} else {
+			dir := path.Dir(profile)
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			fmt.Fprintf(w, "pgo_copts=-fprofile-use=%s -fprofile-correction -Wno-missing-profile -Wno-error=coverage-mismatch\n", dir)
+		}
+	}
+}
+
+// Build the merged profile for a pgo_use flavor from the training runs in
+// the generating flavor.
+func (ops *GlobalOps) outputPGOMerge(w io.Writer, flavor string) {
+	conf := ops.FlavorConfigs[flavor]
+	if conf == nil || conf.PGOUse == "" {
+		return
+	}
+	from := conf.PGOUse
+	// The training runs are done in the generating flavor, so it can't be
+	// excluded with --without-flavor.
+	active := false
+	for _, fl := range ops.Config.ActiveFlavors {
+		active = active || fl == from
+	}
+	if !active {
+		panic(&ParseError{BadPGOFrom, from, "CONFIG"})
+	}
+	if fc := ops.FlavorConfigs[from]; fc == nil || !fc.PGOGenerate {
+		panic(&ParseError{BadPGOUse, from, "CONFIG"})
+	}
+	cc, compilerFlavor := ops.FlavorCompiler(flavor)
+
+	// The training runs of the descriptors built in the generating flavor,
+	// with their paths relative to its $builddir.
+	frombuilddir := path.Join(ops.Config.Buildpath, "obj", from)
+	var training []string
+	for _, desc := range ops.Descriptors {
+		if !desc.ValidForFlavor(from) {
+			continue
+		}
+		for _, t := range flavorCollectedTargets(desc, map[string]bool{pgoTrainingVar: true}) {
+			training = append(training, strings.Replace(t, "$builddir", frombuilddir, 1))
+		}
+	}
+	sort.Strings(training)
+	fmt.Fprintf(w, "build %s: pgo_merge %s\n", ops.pgoProfile(flavor), strings.Join(training, " "))
+	fmt.Fprintf(w, "    pgo_data=%s\n", ops.pgoDataDir(from))
+	fmt.Fprintf(w, "    pgo_compiler=%s\n", compilerFlavor)
+	fmt.Fprintf(w, "    pgo_from=%s\n", from)
+	fmt.Fprintf(w, "    pgo_to=%s\n", flavor)
+	if compilerFlavor == "clang" {
+		fmt.Fprintf(w, "    profdata=%s\n", compilerTool(cc, compilerFlavor, "", "profdata"))
+	}
+}
+
+// Rule dependencies only applying to the flavor currently being output.
+func (ops *GlobalOps) flavorRuledeps(rule string) []string {
+	conf := ops.FlavorConfigs[ops.currentFlavor]
+	if conf == nil {
+		return nil
+	}
+	deps := conf.Ruledeps[rule]
+	if conf.PGOUse != "" && (rule == "cc" || rule == "cxx" || rule == "cc_pch" || rule == "cxx_pch") {
+		deps = append(deps[:len(deps):len(deps)], ops.pgoProfile(ops.currentFlavor))
+	}
+	return deps
+}
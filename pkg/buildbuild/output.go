@@ -36,6 +36,11 @@ func (ops *GlobalOps) GodepsStamp() string {
 	return path.Join(ops.Config.Buildpath, "obj/_go/.stamp")
 }
 
+// Stamp containing the output of go version, only rewritten when it changes.
+func (ops *GlobalOps) GoVersionStamp() string {
+	return path.Join(ops.Config.Buildpath, "obj/_go/go_version")
+}
+
 // Strips args of anything after -- and returns it joined.
 // In the future might remove some arguments before -- as well.
 func BuildBuildArgs(args []string) string {
@@ -85,14 +90,25 @@ func (ops *GlobalOps) OutputTop() (err error) {
 	fmt.Fprintf(w, "buildpath=%s\n", toppath)
 	fmt.Fprintf(w, "cc=%s\n", ops.CC)
 	fmt.Fprintf(w, "cxx=%s\n", ops.CXX)
+	if ops.Config.CompilerLauncher != "" {
+		fmt.Fprintf(w, "compiler_launcher=%s\n", ops.Config.CompilerLauncher)
+	}
+	if ops.Config.ActionCacheDir != "" || ops.Config.ActionCacheURL != "" {
+		fmt.Fprintf(w, "action_cache=seb -tool cache -dir=%s -url=%s --\n", ops.Config.ActionCacheDir, ops.Config.ActionCacheURL)
+	}
+	if ops.Config.Reproducible {
+		ops.outputReproducible(w)
+	}
+	fmt.Fprintf(w, "ar=ar\n")
+	fmt.Fprintf(w, "ld=ld\n")
+	fmt.Fprintf(w, "objcopy=objcopy\n")
 
 	// Copy some environment variables, then allow configvars ninja files
 	// to override them. The reason to do it this way is that dependencies
 	// don't work with environment variables. Changing a configvars file
 	// does trigger rebuilds properly.
-	fmt.Fprintf(w, "gobuild_flags=$$GOBUILD_FLAGS\n")
-	fmt.Fprintf(w, "gobuild_test_flags=$$GOBUILD_TEST_FLAGS\n")
-	fmt.Fprintf(w, "cgo_enabled=$$CGO_ENABLED\n")
+	ops.outputGoFlagsVars(w)
+	ops.outputGoWorkVars(w, toppath)
 
 	fmt.Fprintf(w, "build_build = %s\n", BuildBuildArgs(os.Args))
 	fmt.Fprintf(w, "builtin_invars = %s\n", ops.Config.BuiltinInvars)
@@ -110,7 +126,7 @@ func (ops *GlobalOps) OutputTop() (err error) {
 	for _, bp := range ops.Config.Buildparams {
 		fmt.Fprintln(w, bp)
 	}
-	ops.outputCompilerNinja(w)
+	ops.outputCompilerNinja(w, ops.CompilerFlavor)
 	for _, cv := range ops.Config.Configvars {
 		fmt.Fprintf(w, "include %s\n", cv)
 	}
@@ -118,11 +134,27 @@ func (ops *GlobalOps) OutputTop() (err error) {
 		fmt.Fprintf(w, "include %s\n", r)
 	}
 	ops.outputRulesNinja(w)
+	// Tools run during the build, so they always use the host toolchain,
+	// even in flavors using a cross compilation one.
+	fmt.Fprintf(w, "host_cc=$cc\n")
+	fmt.Fprintf(w, "host_cxx=$cxx\n")
+	fmt.Fprintf(w, "host_ar=$ar\n")
+	fmt.Fprintf(w, "host_ld=$ld\n")
+	fmt.Fprintf(w, "host_warncompiler=$warncompiler\n")
 	if len(ops.Config.Godeps) > 0 {
 		fmt.Fprintf(w, "build %s: %s %s\n", ops.GodepsStamp(), ops.Config.GodepsRule,
 			strings.Join(ops.Config.Godeps, " "))
 		mkpath(toppath, "obj/_go")
 	}
+	if ops.Config.GoTrackDeps != "" {
+		// The phony without inputs is never up to date, so go version is
+		// checked on every build. Thanks to restat the Go targets are only
+		// rebuilt if it changed.
+		fmt.Fprintf(w, "build %s: go_version | %s.always\n", ops.GoVersionStamp(), ops.GoVersionStamp())
+		fmt.Fprintf(w, "build %s.always: phony\n", ops.GoVersionStamp())
+		mkpath(toppath, "obj/_go")
+	}
+	ops.outputGoVendorCheck(w, toppath)
 
 	for _, f := range ops.Config.ActiveFlavors {
 		ops.OutputFlavor(toppath, f)
@@ -155,6 +187,18 @@ func (ops *GlobalOps) OutputTop() (err error) {
 	return w.Flush()
 }
 
+// Outputs the go flags and environment used by gobuild_tool. The flags are
+// quoted there, so they can contain several words.
+func (ops *GlobalOps) outputGoFlagsVars(w io.Writer) {
+	if ops.Config.Reproducible {
+		fmt.Fprintf(w, "gobuild_flags=$$GOBUILD_FLAGS -trimpath -buildvcs=false\n")
+	} else {
+		fmt.Fprintf(w, "gobuild_flags=$$GOBUILD_FLAGS\n")
+	}
+	fmt.Fprintf(w, "gobuild_test_flags=$$GOBUILD_TEST_FLAGS\n")
+	fmt.Fprintf(w, "cgo_enabled=$$CGO_ENABLED\n")
+}
+
 func (ops *GlobalOps) SetBuildversion() {
 	data, err := exec.Command("sh", "-c", ops.Config.BuildversionScript).Output()
 	if err != nil {
@@ -177,12 +221,17 @@ func (ops *GlobalOps) OutputFlavor(topdir, flavor string) {
 	mkpath(destdir, prefix)
 	mkpath(builddir)
 
+	ops.currentFlavor = flavor
+	defer func() { ops.currentFlavor = "" }()
+
 	subninjas := make(map[string]bool)
-	var defaults []string
+	var defaults, checks, coverProfiles []string
 	for _, desc := range ops.Descriptors {
 		if !desc.ValidForFlavor(flavor) {
 			continue
 		}
+		checks = append(checks, flavorCheckTargets(desc)...)
+		coverProfiles = append(coverProfiles, flavorCollectedTargets(desc, coverProfileVars)...)
 
 		objbase := desc.DefaultObjectDir()
 		objdir := objbase
@@ -203,6 +252,8 @@ func (ops *GlobalOps) OutputFlavor(topdir, flavor string) {
 	fmt.Fprintf(w, "buildvars=%s\n", buildvars)
 	fmt.Fprintf(w, "include $buildvars\n")
 
+	ops.outputToolchainNinja(w, flavor)
+	ops.outputOptimizationNinja(w, flavor)
 	ops.outputFlavorNinja(w, flavor)
 	var evs []string
 	if flavorConf != nil {
@@ -213,6 +264,8 @@ func (ops *GlobalOps) OutputFlavor(topdir, flavor string) {
 		fmt.Fprintf(w, "include %s\n", ev)
 	}
 	ops.outputStaticNinja(w)
+	ops.outputHostNinja(w, flavor)
+	ops.outputPchNinja(w, flavor)
 	for sn := range subninjas {
 		fmt.Fprintf(w, "subninja %s/%s.ninja\n", builddir, sn)
 	}
@@ -234,7 +287,11 @@ func (ops *GlobalOps) OutputFlavor(topdir, flavor string) {
 		fmt.Fprintf(w, " %s/%s", builddir, an.TargetName)
 	}
 	w.WriteByte('\n')
-	fmt.Fprintf(w, "build %s/gocover: phony %s\n", destdir, strings.Join(ops.CollectedVars["_gocover"], " "))
+	ops.outputGoCover(w, destdir, coverProfiles)
+	sort.Strings(checks)
+	fmt.Fprintf(w, "build %s/check: phony %s\n", destdir, strings.Join(checks, " "))
+	ops.outputCCover(w, flavor, destdir, checks)
+	ops.outputPGOMerge(w, flavor)
 
 	fmt.Fprintf(w, "build %s: phony %s\n", flavor, strings.Join(defaults, " "))
 
@@ -263,13 +320,18 @@ dest_lib=$destroot/lib
 	if flavorConf != nil {
 		fmt.Fprintf(&bvbuf, "flavor_cflags=%s\n", flavorConf.Cflags)
 	}
-	fmt.Fprintf(&bvbuf, "\n")
-	conds := make([]string, 0, len(ops.Config.Conditions))
-	for c := range ops.Config.Conditions {
-		conds = append(conds, c)
+	writeBuildvars(buildvars, bvbuf.Bytes(), ops.FlavorConditions(flavor))
+	// Tools use the host conditions.
+	if ops.FlavorToolchain(flavor) != nil {
+		writeBuildvars(path.Join(builddir, "host_buildvars.ninja"), bvbuf.Bytes(), ops.HostConditions())
 	}
-	conds = append(conds, ops.CompilerFlavor)
-	sort.Strings(conds)
+}
+
+func writeBuildvars(buildvars string, vars []byte, conds []string) {
+	var bvbuf bytes.Buffer
+	bvbuf.Write(vars)
+	fmt.Fprintf(&bvbuf, "buildconditions=%s\n", strings.Join(conds, ","))
+	fmt.Fprintf(&bvbuf, "\n")
 	for _, c := range conds {
 		fmt.Fprintf(&bvbuf, "%s=1\n", c)
 	}
@@ -278,7 +340,7 @@ dest_lib=$destroot/lib
 	if bytes.Compare(oldbv, bvbuf.Bytes()) == 0 {
 		return
 	}
-	err = ioutil.WriteFile(buildvars, bvbuf.Bytes(), 0666)
+	err := ioutil.WriteFile(buildvars, bvbuf.Bytes(), 0666)
 	if err != nil {
 		panic(err)
 	}
@@ -304,6 +366,16 @@ func (ops *GlobalOps) OutputDescriptor(desc Descriptor, builddir, objdir string)
 		if len(target.Sources) == 0 && len(deps) == 0 && !target.Options["emptysrcs"] {
 			continue
 		}
+		// Host variants are only needed with a cross compilation toolchain.
+		if target.Options["host"] && ops.FlavorToolchain(ops.currentFlavor) == nil {
+			continue
+		}
+		// Fuzz variants need clang, FUZZ_PROG checks its flavors use it.
+		if target.Options["fuzz"] {
+			if _, compilerFlavor := ops.FlavorCompiler(ops.currentFlavor); compilerFlavor != "clang" {
+				continue
+			}
+		}
 
 		rule := target.Rule
 		dest := path.Join(target.ResolveDest(), tname)
@@ -322,12 +394,16 @@ func (ops *GlobalOps) OutputDescriptor(desc Descriptor, builddir, objdir string)
 		orderDeps := desc.ResolveOrderDeps(target)
 		srcs := desc.ResolveSrcs(ops, tname, target.Sources...)
 
+		outs := dest
 		if target.Options["always-all"] {
 			fmt.Fprintf(w, "build %s: phony %s.phony\n", dest, dest)
-			fmt.Fprintf(w, "build %s.phony: %s ", dest, rule)
-		} else {
-			fmt.Fprintf(w, "build %s: %s ", dest, rule)
+			outs = dest + ".phony"
 		}
+		splitDebug := ops.splitDebugVars(target, dest)
+		if splitDebug != nil {
+			outs += " | " + splitDebugFile(dest)
+		}
+		fmt.Fprintf(w, "build %s: %s ", outs, rule)
 		fmt.Fprint(w, strings.Join(srcs, " "))
 
 		if len(deps) > 0 {
@@ -349,6 +425,12 @@ func (ops *GlobalOps) OutputDescriptor(desc Descriptor, builddir, objdir string)
 		if len(target.Srcopts) > 0 {
 			fmt.Fprint(w, "    srcopts=", strings.Join(target.Srcopts, " "), "\n")
 		}
+		for _, v := range splitDebug {
+			fmt.Fprint(w, "    ", v, "\n")
+		}
+		if sb := ops.sandboxVar(desc.GetBuilddesc(), rule, dest, append(append(srcs[:len(srcs):len(srcs)], deps...), orderDeps...)); sb != "" {
+			fmt.Fprint(w, "    sandbox=", sb, "\n")
+		}
 		if target.Options["always-all"] {
 			fmt.Fprintf(w, "default %s.phony\n", dest)
 			defaults = append(defaults, dest+".phony")
@@ -374,16 +456,16 @@ func (ops *GlobalOps) outputDefaultsNinja(w io.Writer) {
 	}
 }
 
-func (ops *GlobalOps) outputCompilerNinja(w io.Writer) {
+func (ops *GlobalOps) outputCompilerNinja(w io.Writer, compilerFlavor string) {
 	if ops.Config.CompilerRuleDir != "" {
-		pth := ops.Config.CompilerRuleDir + "/" + ops.CompilerFlavor + ".ninja"
+		pth := ops.Config.CompilerRuleDir + "/" + compilerFlavor + ".ninja"
 		if _, err := os.Stat(pth); err == nil {
 			fmt.Fprintf(w, "include %s\n", pth)
 		}
 	} else if ninja := os.Getenv("SEBUILD_COMPILER_NINJA"); ninja != "" {
 		fmt.Fprintf(w, "include %s\n", ninja)
 	} else {
-		switch ops.CompilerFlavor {
+		switch compilerFlavor {
 		case "gcc":
 			fmt.Fprint(w, assets.CompilerGccNinja)
 		case "clang":
@@ -402,30 +484,49 @@ func (ops *GlobalOps) outputRulesNinja(w io.Writer) {
 	}
 }
 
+// Includes the flavor ninja files, starting with the ones of any flavors
+// this one inherits from.
 func (ops *GlobalOps) outputFlavorNinja(w io.Writer, flavor string) {
-	if ops.Config.FlavorRuleDir != "" {
-		pth := ops.Config.FlavorRuleDir + "/" + flavor + ".ninja"
-		if _, err := os.Stat(pth); err == nil {
-			fmt.Fprintf(w, "include %s\n", pth)
-		}
-	} else if ninja := os.Getenv("SEBUILD_FLAVOR_NINJA_" + flavor); ninja != "" {
-		fmt.Fprintf(w, "include %s\n", ninja)
-	} else if ninja := os.Getenv("SEBUILD_FLAVOR_NINJA"); ninja != "" {
-		fmt.Fprintf(w, "include %s\n", ninja)
-	} else {
-		switch flavor {
-		case "dev":
-			fmt.Fprint(w, assets.FlavorDevNinja)
-		case "gcov":
-			fmt.Fprint(w, assets.FlavorGcovNinja)
-		case "release":
-			fmt.Fprint(w, assets.FlavorReleaseNinja)
+	cc, compilerFlavor := ops.FlavorCompiler(flavor)
+	for _, fl := range ops.FlavorChain(flavor) {
+		if ops.Config.FlavorRuleDir != "" {
+			pth := ops.Config.FlavorRuleDir + "/" + fl + ".ninja"
+			if _, err := os.Stat(pth); err == nil {
+				fmt.Fprintf(w, "include %s\n", pth)
+			}
+		} else if ninja := os.Getenv("SEBUILD_FLAVOR_NINJA_" + fl); ninja != "" {
+			fmt.Fprintf(w, "include %s\n", ninja)
+		} else if ninja := os.Getenv("SEBUILD_FLAVOR_NINJA"); ninja != "" {
+			if fl == flavor {
+				fmt.Fprintf(w, "include %s\n", ninja)
+			}
+		} else {
+			switch fl {
+			case "dev":
+				fmt.Fprint(w, assets.FlavorDevNinja)
+			case "gcov":
+				fmt.Fprint(w, assets.FlavorGcovNinja)
+			case "release":
+				fmt.Fprint(w, assets.FlavorReleaseNinja)
+			case "asan":
+				fmt.Fprint(w, assets.FlavorAsanNinja)
+			case "ubsan":
+				fmt.Fprint(w, assets.FlavorUbsanNinja)
+			case "tsan":
+				fmt.Fprint(w, assets.FlavorTsanNinja)
+			case "msan":
+				// Fail here rather than on the unknown compiler flag.
+				if compilerFlavor != "clang" {
+					panic(&ParseError{BadMsanCompiler, cc, "CONFIG"})
+				}
+				fmt.Fprint(w, assets.FlavorMsanNinja)
+			}
 		}
-	}
-	if ops.Config.CompilerFlavorRuleDir != "" {
-		pth := ops.Config.CompilerFlavorRuleDir + "/" + ops.CompilerFlavor + "-" + flavor + ".ninja"
-		if _, err := os.Stat(pth); err == nil {
-			fmt.Fprintf(w, "include %s\n", pth)
+		if ops.Config.CompilerFlavorRuleDir != "" {
+			pth := ops.Config.CompilerFlavorRuleDir + "/" + compilerFlavor + "-" + fl + ".ninja"
+			if _, err := os.Stat(pth); err == nil {
+				fmt.Fprintf(w, "include %s\n", pth)
+			}
 		}
 	}
 }
@@ -0,0 +1,82 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Headers with these extensions are only precompiled for C++ sources.
+// Others, notably .h, are precompiled for both C and C++.
+var cxxHeaderExtensions = map[string]bool{
+	".hh":  true,
+	".hpp": true,
+	".hxx": true,
+	".H":   true,
+}
+
+// Adds the precompiled header targets and makes the compile targets use
+// them. The header is precompiled once per compile rule and pic setting in
+// use, since the compiler refuses a precompiled header built with different
+// flags. Sources with srcopts are compiled with other flags, so they and the
+// analyse targets include the header itself instead, the latter as clang
+// can't read the gcc format.
+//
+// The header is copied next to the precompiled one and force included from
+// there, both gcc and clang then look for the precompiled header next to it.
+// Its extension depends on the compiler of the flavor, see outputPchNinja.
+func (l *LinkDesc) FinalizePch(ops *GlobalOps) {
+	if l.Pch == "" {
+		return
+	}
+	cxxOnly := cxxHeaderExtensions[path.Ext(l.Pch)]
+
+	for _, o := range l.Objs {
+		for _, suff := range []string{".o", ".pic_o"} {
+			t := l.Targets[o+suff]
+			if t == nil || (t.Rule != "cxx" && (t.Rule != "cc" || cxxOnly)) {
+				continue
+			}
+			if len(t.Srcopts) > 0 {
+				t.Extraargs = append(t.Extraargs, "pchflags=-include "+path.Join(l.PchSrcdir, l.Pch))
+				continue
+			}
+			variant := t.Rule
+			var eas []string
+			for _, ea := range t.Extraargs {
+				if strings.HasPrefix(ea, "picflag=") {
+					variant += "_pic"
+					eas = append(eas, ea)
+				}
+			}
+			hdr := path.Join("pch", variant, l.Pch)
+			tname := hdr + "$pch_ext"
+			if l.Targets[tname] == nil {
+				l.AddTarget(hdr, "install_header", []string{l.Pch}, "obj", l.PchSrcdir, nil, nil)
+				l.AddTarget(tname, t.Rule+"_pch", []string{l.Pch}, "obj", l.PchSrcdir, eas, map[string]bool{"incdeps": true})
+			}
+			pch := "$objdir/" + tname
+			t.Deps = append(t.Deps, "$objdir/"+hdr, pch)
+			// The compiler doesn't list the precompiled header in the depfile.
+			t.Extraargs = append(t.Extraargs, "pch="+pch, "pchflags=-include $objdir/"+hdr)
+		}
+	}
+	for _, o := range append(l.Objs[:len(l.Objs):len(l.Objs)], l.UnityBatched...) {
+		if t := l.Targets[o+".analyse"]; t != nil && (t.Rule == "cxx_analyse" || !cxxOnly) {
+			t.Extraargs = append(t.Extraargs, "pchflags=-include "+path.Join(l.PchSrcdir, l.Pch))
+		}
+	}
+}
+
+// Sets the extension of the precompiled headers, the one gcc or clang looks
+// for next to the force included header.
+func (ops *GlobalOps) outputPchNinja(w io.Writer, flavor string) {
+	ext := ".gch"
+	if _, compilerFlavor := ops.FlavorCompiler(flavor); compilerFlavor == "clang" {
+		ext = ".pch"
+	}
+	fmt.Fprintf(w, "pch_ext=%s\n", ext)
+}
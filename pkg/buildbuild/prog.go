@@ -2,10 +2,17 @@
 
 package buildbuild
 
-import "strings"
+import (
+	"fmt"
+	"path"
+	"strings"
+)
 
 type ProgDesc struct {
 	LinkDesc
+
+	PGOTraining []string // Comma separated arguments for each training run.
+	SizeBudget  int64    // Maximum size of the program, 0 if unlimited.
 }
 
 func (tmpl *ProgDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
@@ -15,8 +22,10 @@ func (tmpl *ProgDesc) NewFromTemplate(bd, tname string, flavors []string) Descri
 }
 
 func (p *ProgDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
-	desc := p.GenericParse(p, ops, realsrcdir, args, LinkerExtra())
+	desc := p.GenericParse(p, ops, realsrcdir, args, LinkerExtra("pgo_training", "pch", "size_budget"))
 	p.LinkerParse(realsrcdir, args)
+	p.PGOTraining = append(p.PGOTraining, args["pgo_training"]...)
+	p.SizeBudget = parseSizeBudget(args["size_budget"], p.Builddesc)
 	return desc
 }
 
@@ -28,12 +37,31 @@ func (p *ProgDesc) Finalize(ops *GlobalOps) {
 
 	goobj := p.FinalizeGoSrcs(ops, "lib")
 	objs = append(objs, goobj...)
-	objs = append(objs, ops.ResolveLibsOurStatic(p.Libs)...)
+	if p.Host {
+		objs = append(objs, ops.ResolveLibsOurHost(p.Libs)...)
+	} else {
+		objs = append(objs, ops.ResolveLibsOurStatic(p.Libs)...)
+	}
 
 	ldlibs := ops.ResolveLibsExternal(p.Libs)
 	link := ops.ResolveLibsLinker(p.Link, p.Libs)
 	eas := []string{"ldlibs=" + strings.Join(ldlibs, " ")}
-	p.AddTarget(prog, link, objs, p.Destdir, "", eas, p.TargetOptions)
+	target := p.AddTarget(prog, link, objs, p.Destdir, "", eas, p.TargetOptions)
+	// Tools are only run during the build.
+	target.SplitDebug = !p.Host
+	p.AddSizeCheck(prog, p.SizeBudget)
+
+	// Training runs are only built if a pgo_use flavor depends on them.
+	traindir := p.Srcdir
+	if traindir == "" {
+		traindir = "."
+	}
+	for i, train := range p.PGOTraining {
+		tname := fmt.Sprintf("pgo/%s-%d.stamp", path.Join(p.Srcdir, prog), i)
+		eas := []string{"train_dir=" + traindir, "train_args=" + strings.Replace(train, ",", " ", -1)}
+		target := p.AddTarget(tname, "pgo_train", []string{prog}, "builddir", "", eas, nil)
+		target.CollectAs = pgoTrainingVar
+	}
 
 	p.FinalizeAnalyse(ops)
 	p.GeneralDesc.Finalize(ops)
@@ -54,6 +82,7 @@ var ToolProgTemplate = ProgDesc{
 	LinkDesc: LinkDesc{
 		GeneralDesc: GeneralDesc{
 			Destdir: "dest_tool",
+			Host:    true,
 		},
 		Picrules: false,
 		Link:     "link",
@@ -0,0 +1,66 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Sets SourceDateEpoch to the time of the commit the buildversion was
+// calculated from. An already set SOURCE_DATE_EPOCH is used as is, and 0
+// if not built from git.
+func (ops *GlobalOps) SetSourceDateEpoch() {
+	if ops.SourceDateEpoch != "" {
+		return
+	}
+	ops.SourceDateEpoch = os.Getenv("SOURCE_DATE_EPOCH")
+	if ops.SourceDateEpoch == "" {
+		if ops.Buildversion == "" {
+			ops.SetBuildversion()
+		}
+		data, _ := exec.Command("git", "log", "-1", "--format=%ct", buildversionCommit(ops.Buildversion)).Output()
+		ops.SourceDateEpoch = strings.TrimSpace(string(data))
+	}
+	if ops.SourceDateEpoch == "" {
+		ops.SourceDateEpoch = "0"
+	}
+}
+
+// Returns the commit having the buildversion, which with the default
+// buildversion_script is the number of commits up to and including it.
+// HEAD is used for versions that aren't such a count.
+func buildversionCommit(buildversion string) string {
+	n, err := strconv.Atoi(buildversion)
+	if err != nil || n <= 0 {
+		return "HEAD"
+	}
+	data, err := exec.Command("git", "rev-list", "--reverse", "HEAD").Output()
+	if err != nil {
+		return "HEAD"
+	}
+	commits := strings.Fields(string(data))
+	if n > len(commits) {
+		return "HEAD"
+	}
+	return commits[n-1]
+}
+
+// Writes the variables making the C and C++ rules reproducible. The source
+// and build paths are mapped to fixed ones in debug info and __FILE__,
+// archives are created without timestamps and __DATE__ and __TIME__ use
+// the commit time.
+func (ops *GlobalOps) outputReproducible(w io.Writer) {
+	ops.SetSourceDateEpoch()
+	cwd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(w, "repro_copts=-ffile-prefix-map=%s=. -ffile-prefix-map=$buildpath=build\n", cwd)
+	fmt.Fprintf(w, "repro_env=SOURCE_DATE_EPOCH=%s\n", ops.SourceDateEpoch)
+	fmt.Fprintf(w, "ar_modifiers=D\n")
+}
@@ -0,0 +1,81 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"strings"
+)
+
+const dependIncludesPrefix = "$builddir/depend_includes_"
+
+// Rules prefixing their command with $sandbox. Others, like the go rules
+// relying on the go build cache, are never sandboxed.
+var sandboxRules = map[string]bool{
+	"cc":          true,
+	"cxx":         true,
+	"cc_pch":      true,
+	"cxx_pch":     true,
+	"link":        true,
+	"linkxx":      true,
+	"partiallink": true,
+	"ar":          true,
+	"flexx":       true,
+	"yaccxx":      true,
+	"gperf":       true,
+	"in":          true,
+}
+
+// Rules writing a depfile to $out.d.
+var sandboxDepfileRules = map[string]bool{
+	"cc":      true,
+	"cxx":     true,
+	"cc_pch":  true,
+	"cxx_pch": true,
+}
+
+// Returns the sandbox variable for a target in the current flavor, or an
+// empty string if it's not sandboxed. All the inputs ninja knows about are
+// passed to the tool, it will also allow the ones in the depfile.
+func (ops *GlobalOps) sandboxVar(builddesc, rule, dest string, inputs []string) string {
+	if !sandboxRules[rule] {
+		return ""
+	}
+	if conf := ops.FlavorConfigs[ops.currentFlavor]; !ops.Options.Sandbox && (conf == nil || !conf.Sandbox) {
+		return ""
+	}
+	inputs = ops.sandboxExpandIncdeps(inputs, make(map[string]bool))
+	depfile := ""
+	if sandboxDepfileRules[rule] {
+		depfile = " -depfile=" + dest + ".d"
+	}
+	return fmt.Sprintf(`seb -tool sandbox -builddesc=%s -buildpath=%s -in="%s" -out="%s"%s --`,
+		builddesc, ops.Config.Buildpath, strings.Join(inputs, " "), dest, depfile)
+}
+
+// The depend_includes phony targets can't be resolved by the sandbox tool,
+// so replace them with the headers they depend on.
+func (ops *GlobalOps) sandboxExpandIncdeps(inputs []string, seen map[string]bool) []string {
+	var ret []string
+	for _, in := range inputs {
+		if !strings.HasPrefix(in, dependIncludesPrefix) {
+			ret = append(ret, in)
+			continue
+		}
+		if seen[in] {
+			continue
+		}
+		seen[in] = true
+		tname := strings.TrimPrefix(in, "$builddir/")
+		desc, ok := ops.Libs[strings.TrimPrefix(in, dependIncludesPrefix)].(Descriptor)
+		if !ok {
+			ret = append(ret, in)
+			continue
+		}
+		if t := desc.AllTargets()[tname]; t != nil {
+			ret = append(ret, desc.ResolveSrcs(ops, tname, t.Sources...)...)
+		}
+		ret = append(ret, ops.sandboxExpandIncdeps(desc.ResolveDeps(ops, tname), seen)...)
+	}
+	return ret
+}
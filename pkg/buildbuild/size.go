@@ -0,0 +1,49 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var BadSizeBudget = errors.New("Bad size_budget, need a number of bytes with an optional K, M or G suffix")
+
+// Parses a size_budget argument, returning the number of bytes. The last
+// value is used, so that flavored arguments override unflavored ones. 0 is
+// no budget, so that a flavor can turn off an unflavored one.
+func parseSizeBudget(args []string, bd string) int64 {
+	if len(args) == 0 {
+		return 0
+	}
+	arg := args[len(args)-1]
+	num, mult := arg, int64(1)
+	switch {
+	case strings.HasSuffix(arg, "K"):
+		mult = 1 << 10
+	case strings.HasSuffix(arg, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(arg, "G"):
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = arg[:len(arg)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		panic(&ParseError{BadSizeBudget, arg, bd})
+	}
+	return n * mult
+}
+
+// Adds a default target failing if the linked target is larger than the
+// budget.
+func (l *LinkDesc) AddSizeCheck(tname string, budget int64) {
+	if budget == 0 {
+		return
+	}
+	eas := []string{fmt.Sprint("size_budget=", budget)}
+	l.AddTarget(tname+".size_check", "size_check", []string{tname}, "obj", "", eas, map[string]bool{"all": true})
+}
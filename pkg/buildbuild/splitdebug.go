@@ -0,0 +1,36 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Returns the debug file written next to dest in split_debug flavors.
+// The tool also links it from $flavorroot/debug/.build-id, but that name
+// depends on the contents of the output so ninja can't know about it.
+func splitDebugFile(dest string) string {
+	return path.Join("$flavorroot/debug", strings.TrimPrefix(dest, "$")) + ".debug"
+}
+
+// Returns the ninja variables for splitting the debug information out of
+// target in the current flavor, or nil if it's not split.
+func (ops *GlobalOps) splitDebugVars(target *Target, dest string) []string {
+	if !target.SplitDebug {
+		return nil
+	}
+	if conf := ops.FlavorConfigs[ops.currentFlavor]; conf == nil || !conf.SplitDebug {
+		return nil
+	}
+	buildID := "-Wl,--build-id"
+	if target.Rule == "gobuild" {
+		buildID = "-build-id"
+	}
+	return []string{
+		fmt.Sprintf("split_debug=seb -tool split-debug -out=%s -debug=%s -buildid-dir=$flavorroot/debug/.build-id -objcopy=$objcopy --",
+			dest, splitDebugFile(dest)),
+		"build_id_flags=" + buildID,
+	}
+}
@@ -22,6 +22,7 @@ type Target struct {
 	IncdepsExcept map[string]bool
 
 	MultiTarget []string // A single build generating multiple targets.
+	SplitDebug  bool     // Linked output that gets its debug information split out in split_debug flavors.
 }
 
 var (
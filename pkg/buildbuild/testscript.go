@@ -0,0 +1,89 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+type TestScriptDesc struct {
+	GeneralDesc
+
+	Script  string
+	Data    []string
+	Args    []string
+	Env     []string
+	Timeout string // Duration, empty for no limit.
+	Workdir string // Relative Srcdir, empty to run in a temporary directory.
+}
+
+var BadScript = errors.New("TEST_SCRIPT needs exactly one script")
+
+const testsVar = "_tests"
+
+func (tmpl *TestScriptDesc) NewFromTemplate(bd, tname string, flavors []string) Descriptor {
+	return &TestScriptDesc{
+		GeneralDesc: *tmpl.GeneralDesc.NewFromTemplate(bd, tname, flavors),
+	}
+}
+
+func (ts *TestScriptDesc) Parse(ops *GlobalOps, realsrcdir string, args map[string][]string) Descriptor {
+	desc := ts.GenericParse(ts, ops, realsrcdir, args, []string{"script", "data", "args", "env", "timeout", "workdir"})
+	if len(args["script"]) > 0 {
+		if ts.Script != "" || len(args["script"]) > 1 {
+			panic(&ParseError{BadScript, strings.Join(args["script"], " "), ts.Builddesc})
+		}
+		ts.Script = args["script"][0]
+	}
+	ts.Data = append(ts.Data, ops.GlobDir(ts.Srcdir, args["data"])...)
+	ts.Args = append(ts.Args, args["args"]...)
+	ts.Env = append(ts.Env, args["env"]...)
+	if v := args["timeout"]; len(v) > 0 {
+		ts.Timeout = parseTimeout(v[len(v)-1], ts.Builddesc)
+	}
+	if v := args["workdir"]; len(v) > 0 {
+		ts.Workdir = v[len(v)-1]
+	}
+	return desc
+}
+
+func (ts *TestScriptDesc) Finalize(ops *GlobalOps) {
+	if ts.Script == "" {
+		panic(&ParseError{BadScript, ts.TargetName, ts.Builddesc})
+	}
+	for _, d := range ts.Data {
+		ts.Srcdirs[d] = ts.Srcdir
+	}
+	srcdir := ts.Srcdir
+	if srcdir == "" {
+		srcdir = "."
+	}
+	flags := []string{"-tmp", "-srcdir=" + srcdir, "-destroot=$destroot"}
+	if ts.Workdir != "" {
+		flags = append(flags, "-dir="+path.Join(srcdir, ts.Workdir))
+	}
+	if ts.Timeout != "" {
+		flags = append(flags, "-timeout="+ts.Timeout)
+	}
+	if len(ts.Data) > 0 {
+		flags = append(flags, `-data="`+strings.Join(ts.ResolveSrcs(ops, "", ts.Data...), " ")+`"`)
+	}
+	eas := []string{
+		"test_flags=" + strings.Join(flags, " "),
+		"test_env=" + strings.Join(ts.Env, " "),
+		"test_args=" + strings.Join(ts.Args, " "),
+	}
+	target := ts.AddTarget(path.Join("tests", ts.TargetName), "test_script", []string{ts.Script}, "destroot", ts.Srcdir, eas, ts.TargetOptions)
+	target.Deps = append(target.Deps, ts.Data...)
+	target.CollectAs = testsVar
+
+	ts.GeneralDesc.Finalize(ops)
+}
+
+var TestScriptTemplate = TestScriptDesc{
+	GeneralDesc: GeneralDesc{
+		TargetOptions: map[string]bool{"all": true},
+	},
+}
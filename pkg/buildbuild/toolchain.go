@@ -0,0 +1,319 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// A cross compilation toolchain, defined with the toolchains argument in
+// CONFIG. Any unset tool is guessed from the triple, e.g. a triple of
+// aarch64-linux-gnu gives the C compiler aarch64-linux-gnu-gcc.
+type Toolchain struct {
+	Name    string
+	Triple  string
+	Sysroot string
+	CC      string
+	CXX     string
+	AR      string
+	LD      string
+	Objcopy string
+}
+
+var (
+	BadToolchainFormat = errors.New("Bad toolchains format, need toolchains[name:key=value]")
+	UnknownToolchain   = errors.New("Toolchain does not exist")
+)
+
+// Parses a toolchains argument element, on the format name:key=value.
+func (ops *GlobalOps) parseToolchainArg(arg, bd string) {
+	col := strings.IndexRune(arg, ':')
+	eq := strings.IndexRune(arg, '=')
+	if col <= 0 || eq < col {
+		panic(&ParseError{BadToolchainFormat, arg, bd})
+	}
+	name := arg[:col]
+	key := arg[col+1 : eq]
+	value := arg[eq+1:]
+
+	tc := ops.Config.Toolchains[name]
+	if tc == nil {
+		tc = &Toolchain{Name: name}
+		ops.Config.Toolchains[name] = tc
+	}
+	switch key {
+	case "triple":
+		tc.Triple = value
+	case "sysroot":
+		tc.Sysroot = value
+	case "cc":
+		tc.CC = value
+	case "cxx":
+		tc.CXX = value
+	case "ar":
+		tc.AR = value
+	case "ld":
+		tc.LD = value
+	case "objcopy":
+		tc.Objcopy = value
+	default:
+		panic(&ParseError{BadToolchainFormat, arg, bd})
+	}
+}
+
+func (tc *Toolchain) tool(set, name string) string {
+	if set != "" {
+		return set
+	}
+	if tc.Triple == "" {
+		return name
+	}
+	return tc.Triple + "-" + name
+}
+
+func (tc *Toolchain) CCompiler() string {
+	return tc.tool(tc.CC, "gcc")
+}
+
+func (tc *Toolchain) CXXCompiler() string {
+	if tc.CXX == "" && tc.CC != "" {
+		// Same heuristics as for the detected compiler.
+		if idx := strings.Index(tc.CC, "gcc"); idx >= 0 {
+			return tc.CC[:idx] + "g++" + tc.CC[idx+3:]
+		}
+		if strings.Contains(tc.CC, "clang") {
+			return strings.Replace(tc.CC, "clang", "clang++", 1)
+		}
+	}
+	return tc.tool(tc.CXX, "g++")
+}
+
+func (tc *Toolchain) Archiver() string {
+	return tc.tool(tc.AR, "ar")
+}
+
+func (tc *Toolchain) Linker() string {
+	return tc.tool(tc.LD, "ld")
+}
+
+func (tc *Toolchain) ObjcopyTool() string {
+	return tc.tool(tc.Objcopy, "objcopy")
+}
+
+// Returns the GOOS and GOARCH values matching the toolchain triple.
+// Falls back to the runtime values for parts that can't be recognized.
+func (tc *Toolchain) GoOSArch() (goos, goarch string) {
+	goos, goarch = runtime.GOOS, runtime.GOARCH
+	if tc.Triple == "" {
+		return
+	}
+	parts := strings.Split(tc.Triple, "-")
+	switch arch := parts[0]; {
+	case arch == "x86_64" || arch == "amd64":
+		goarch = "amd64"
+	case arch == "aarch64" || arch == "arm64":
+		goarch = "arm64"
+	case len(arch) == 4 && arch[0] == 'i' && strings.HasSuffix(arch, "86"):
+		goarch = "386"
+	case strings.HasPrefix(arch, "arm"):
+		goarch = "arm"
+	case arch == "powerpc64le":
+		goarch = "ppc64le"
+	case arch == "powerpc64":
+		goarch = "ppc64"
+	case arch == "mipsel":
+		goarch = "mipsle"
+	default:
+		goarch = arch
+	}
+	for _, p := range parts[1:] {
+		switch {
+		case p == "android":
+			return "android", goarch
+		case strings.HasPrefix(p, "linux"):
+			goos = "linux"
+		case strings.HasPrefix(p, "darwin") || p == "apple":
+			goos = "darwin"
+		case strings.HasPrefix(p, "freebsd"):
+			goos = "freebsd"
+		case strings.HasPrefix(p, "netbsd"):
+			goos = "netbsd"
+		case strings.HasPrefix(p, "openbsd"):
+			goos = "openbsd"
+		case strings.HasPrefix(p, "mingw") || p == "windows":
+			goos = "windows"
+		}
+	}
+	return
+}
+
+// Conditions set by the toolchain, replacing the host ones.
+func (tc *Toolchain) Conditions() []string {
+	goos, goarch := tc.GoOSArch()
+	return []string{goos, archCondition(goarch)}
+}
+
+func hostConditions() []string {
+	return []string{runtime.GOOS, archCondition(runtime.GOARCH)}
+}
+
+// We traditionally use x86_64 rather than amd64.
+func archCondition(goarch string) string {
+	if goarch == "amd64" {
+		return "x86_64"
+	}
+	return goarch
+}
+
+// Returns the toolchain used for the flavor, or nil to use the host one.
+func (ops *GlobalOps) FlavorToolchain(flavor string) *Toolchain {
+	name := ops.Config.Toolchain
+	if fc := ops.FlavorConfigs[flavor]; fc != nil && fc.Toolchain != "" {
+		name = fc.Toolchain
+	}
+	if name == "" {
+		return nil
+	}
+	return ops.Config.Toolchains[name]
+}
+
+// Sorted conditions written to the flavor buildvars file. If the flavor
+// uses a toolchain, its conditions and compiler replace the host ones.
+func (ops *GlobalOps) FlavorConditions(flavor string) []string {
+	conds := make(map[string]bool, len(ops.Config.Conditions))
+	for c, v := range ops.Config.Conditions {
+		conds[c] = v
+	}
+	if tc := ops.FlavorToolchain(flavor); tc != nil && tc != ops.Config.Toolchains[ops.Config.Toolchain] {
+		// Global conditions are already from the default toolchain if there is one.
+		from := hostConditions()
+		if dtc := ops.Config.Toolchains[ops.Config.Toolchain]; dtc != nil {
+			from = dtc.Conditions()
+		}
+		for _, c := range from {
+			delete(conds, c)
+		}
+		for _, c := range tc.Conditions() {
+			conds[c] = true
+		}
+	}
+	_, compilerFlavor := ops.FlavorCompiler(flavor)
+	return sortedConditions(conds, compilerFlavor)
+}
+
+// Sorted conditions of the host, used for the tools run during the build.
+func (ops *GlobalOps) HostConditions() []string {
+	conds := make(map[string]bool, len(ops.Config.Conditions))
+	for c, v := range ops.Config.Conditions {
+		conds[c] = v
+	}
+	if dtc := ops.Config.Toolchains[ops.Config.Toolchain]; dtc != nil {
+		for _, c := range dtc.Conditions() {
+			delete(conds, c)
+		}
+		for _, c := range hostConditions() {
+			conds[c] = true
+		}
+	}
+	return sortedConditions(conds, ops.CompilerFlavor)
+}
+
+func sortedConditions(conds map[string]bool, compilerFlavor string) []string {
+	ret := make([]string, 0, len(conds)+1)
+	for c := range conds {
+		ret = append(ret, c)
+	}
+	ret = append(ret, compilerFlavor)
+	sort.Strings(ret)
+	return ret
+}
+
+// Replaces the host conditions with the ones for the default toolchain.
+func (ops *GlobalOps) setToolchainConditions() {
+	tc := ops.Config.Toolchains[ops.Config.Toolchain]
+	for _, c := range hostConditions() {
+		delete(ops.Config.Conditions, c)
+	}
+	for _, c := range tc.Conditions() {
+		ops.Config.Conditions[c] = true
+	}
+}
+
+func (ops *GlobalOps) outputToolchainNinja(w io.Writer, flavor string) {
+	tc := ops.FlavorToolchain(flavor)
+	if tc == nil {
+		return
+	}
+	if _, compilerFlavor := ops.FlavorCompiler(flavor); compilerFlavor != ops.CompilerFlavor {
+		ops.outputCompilerNinja(w, compilerFlavor)
+	}
+	fmt.Fprintf(w, "cc=%s\n", tc.CCompiler())
+	fmt.Fprintf(w, "cxx=%s\n", tc.CXXCompiler())
+	fmt.Fprintf(w, "ar=%s\n", tc.Archiver())
+	fmt.Fprintf(w, "ld=%s\n", tc.Linker())
+	fmt.Fprintf(w, "objcopy=%s\n", tc.ObjcopyTool())
+	if tc.Sysroot != "" {
+		fmt.Fprintf(w, "sysroot_flags=--sysroot=%s\n", tc.Sysroot)
+	}
+	goos, goarch := tc.GoOSArch()
+	fmt.Fprintf(w, "goos=%s\n", goos)
+	fmt.Fprintf(w, "goarch=%s\n", goarch)
+}
+
+// Variables making a descriptor or target use the host toolchain and
+// conditions.
+var hostToolchainVars = []string{
+	"cc=$host_cc",
+	"cxx=$host_cxx",
+	"ar=$host_ar",
+	"ld=$host_ld",
+	"sysroot_flags=",
+	"warncompiler=$host_warncompiler",
+	"goos=",
+	"goarch=",
+	"inconf=$host_inconf",
+}
+
+// Outputs the variables used by the tools, after the static ninja. With a
+// cross compilation toolchain the tools link host variants of the libraries
+// and their .in files use the host conditions, from a separate buildvars
+// file written by OutputFlavor.
+func (ops *GlobalOps) outputHostNinja(w io.Writer, flavor string) {
+	if ops.FlavorToolchain(flavor) == nil {
+		fmt.Fprintf(w, "host_libdir=$libdir\n")
+		fmt.Fprintf(w, "host_inconf=$inconf\n")
+		return
+	}
+	fmt.Fprintf(w, "host_libdir=$libdir/host\n")
+	fmt.Fprintf(w, "host_inconf=$buildtools/host/in.conf\n")
+	fmt.Fprintf(w, "build $host_inconf: inconfig $configvars $inconfig | $builddir/host_buildvars.ninja\n")
+	fmt.Fprintf(w, "    buildvars=$builddir/host_buildvars.ninja\n")
+}
+
+// Returns true if the library is linked by a tool. It's then also built with
+// the host toolchain in flavors using a cross compilation one.
+func (ops *GlobalOps) isHostLib(name string) bool {
+	if ops.hostLibs == nil {
+		ops.hostLibs = make(map[string]bool)
+		for _, desc := range ops.Descriptors {
+			if p, ok := desc.(*ProgDesc); ok && p.Host {
+				for _, lib := range ops.ResolveLibs(p.Libs) {
+					ops.hostLibs[lib] = true
+				}
+			}
+		}
+	}
+	return ops.hostLibs[name]
+}
+
+// Adds a copy of the library and its objects built with the host toolchain,
+// in $libdir/host and $objdir/host. They're only output in flavors using a
+// cross compilation toolchain.
+func (l *LibDesc) addHostVariant(objs []string) {
+	l.addVariant("host", objs, hostToolchainVars)
+}
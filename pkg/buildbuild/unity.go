@@ -0,0 +1,85 @@
+// Copyright 2026 Schibsted
+
+package buildbuild
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	BadUnity = errors.New("Bad unity argument, need unity[N] with N > 0")
+)
+
+// Parses the unity argument. The last value is used, so that flavored
+// arguments override unflavored ones.
+func (l *LinkDesc) parseUnity(args []string) {
+	n, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || n <= 0 {
+		panic(&ParseError{BadUnity, args[len(args)-1], l.Builddesc})
+	}
+	l.Unity = n
+}
+
+// Batches the C and C++ objects into unity sources, each including up to
+// l.Unity of the original sources. The batches replace the objects in
+// l.Objs while the original ones are kept in l.UnityBatched, to still
+// analyse them one by one. Sources with srcopts are left out, since the
+// options would apply to the whole batch.
+func (l *LinkDesc) FinalizeUnity(ops *GlobalOps) {
+	if l.Unity <= 0 {
+		return
+	}
+	type batch struct {
+		base string
+		srcs []string
+	}
+	var objs []string
+	open := make(map[string]*batch)
+	nbatches := make(map[string]int)
+	for _, o := range l.Objs {
+		t := l.Targets[o+".o"]
+		if t == nil || (t.Rule != "cc" && t.Rule != "cxx") || len(t.Srcopts) > 0 || len(t.Sources) != 1 {
+			objs = append(objs, o)
+			continue
+		}
+		b := open[t.Rule]
+		if b == nil {
+			b = &batch{base: fmt.Sprintf("unity/%s-%d", t.Rule, nbatches[t.Rule])}
+			nbatches[t.Rule]++
+			open[t.Rule] = b
+			objs = append(objs, b.base)
+		}
+		src := t.Sources[0]
+		b.srcs = append(b.srcs, l.ResolveSrcs(ops, o+".o", src)...)
+		if len(b.srcs) == l.Unity {
+			l.addUnityBatch(t.Rule, b.base, b.srcs)
+			delete(open, t.Rule)
+		}
+
+		delete(l.Targets, o+".o")
+		delete(l.Targets, o+".pic_o")
+		l.UnityBatched = append(l.UnityBatched, o)
+	}
+	for _, rule := range []string{"cc", "cxx"} {
+		if b := open[rule]; b != nil {
+			l.addUnityBatch(rule, b.base, b.srcs)
+		}
+	}
+	l.Objs = objs
+}
+
+func (l *LinkDesc) addUnityBatch(rule, base string, srcs []string) {
+	ext := ".c"
+	if rule == "cxx" {
+		ext = ".cc"
+	}
+	l.AddTarget(base+ext, "unity", srcs, "obj", "", nil, nil)
+
+	opts := map[string]bool{"incdeps": true}
+	l.AddTarget(base+".o", rule, []string{base + ext}, "obj", "", nil, opts)
+	if l.Picrules {
+		l.AddTarget(base+".pic_o", rule, []string{base + ext}, "obj", "", []string{"picflag=-fPIC"}, opts)
+	}
+}